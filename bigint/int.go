@@ -176,7 +176,8 @@ func (i *Int) Int64() int64 {
 }
 
 // MontgomeryReduce implements montgomery reduction algorithm on bigint.Int data type.
-// This function can also be found in polynomial/ntt.go
+// It returns x * 2^-bitLen mod q for x in [0, q * 2^bitLen), where qInv = -q^-1 mod 2^bitLen
+// and montgomeryMod = 2^bitLen - 1. See Modulus for the word-sized version.
 func MontgomeryReduce(x, q, qInv, montgomeryMod *Int, bitLen uint32) *Int{
 	u := new(Int).Mul(x, qInv)
 	u.And(u, montgomeryMod)
@@ -189,34 +190,28 @@ func MontgomeryReduce(x, q, qInv, montgomeryMod *Int, bitLen uint32) *Int{
 	return x
 }
 
-// montgomeryReduce implements montgomery reduction algorithm on int64 data type.
-// This function can also be found in polynomial/ntt.go
-func montgomeryReduce(a int64) int64 {
-	u := a * 7679
-	u &= (1 << 18) - 1
-	u *= 7681
-	a += u
-	a = int64(a >> 18)
-	if a >= 7681 {
-		return a - 7681
-	}
-	return a
+// BarrettConstant returns floor(2^shift / q), the precomputed param of BarrettReduce
+func BarrettConstant(q *Int, shift uint32) *Int {
+	mu := new(Int).Lsh(NewInt(1), shift)
+	return mu.Div(mu, q)
 }
 
-// BarrettReduce implements short barrett reduction algorithm on bigint.Int data type.
-// This function can also be found in polynomial/ntt.go
-func BarrettReduce(x, q *Int) *Int {
-	u := new(Int).Rsh(x, uint32(13)) // ((uint32_t) a * sinv) >> 16
+// BarrettReduce implements barrett reduction algorithm on bigint.Int data type.
+// It returns x mod q in [0, q) for |x| < 2^shift, where mu = BarrettConstant(q, shift).
+// See Modulus for the word-sized version.
+func BarrettReduce(x, q, mu *Int, shift uint32) *Int {
+	// With mu = 2^shift / q - d for some d in [0, 1), x * mu / 2^shift = x / q - x * d / 2^shift,
+	// and |x * d / 2^shift| < 1 when |x| < 2^shift. The estimated quotient floor(x * mu / 2^shift)
+	// is thus floor(x / q) or floor(x / q) - 1 for x >= 0, and floor(x / q) or floor(x / q) + 1 for x < 0,
+	// so the remainder is in [0, 2q) or [-q, q) and a single correction suffices.
+	u := new(Int).Mul(x, mu)
+	u.Rsh(u, shift)
 	u.Mul(u, q)
 	x.Sub(x, u)
+	if x.Value.Sign() < 0 {
+		x.Add(x, q)
+	} else if x.Compare(q) != -1 {
+		x.Sub(x, q)
+	}
 	return x
-}
-
-// barrettReduce implements short barrett reduction algorithm on int64 data type.
-// This function can also be found in polynomial/ntt.go
-func barrettReduce(a int64) int64 {
-	u := int64(a >> 13) // ((uint32_t) a * sinv) >> 16
-	u *= 7681
-	a -= int64(u)
-	return a
 }
\ No newline at end of file
@@ -323,24 +323,27 @@ func BenchmarkMontgomeryReduce(b *testing.B) {
 }
 
 func BenchmarkMontgomeryReduceDebug(b *testing.B) {
+	m, _ := NewModulus(7681)
 	for i := 0; i < b.N; i++ {
-		x := int64(987654321)
-		montgomeryReduce(x)
+		x := uint64(987654321)
+		m.MontgomeryReduce(0, x)
 	}
 }
 
 func BenchmarkBarrettReduce(b *testing.B) {
 	q := NewInt(7681)
+	mu := BarrettConstant(q, 28)
 	x := NewIntFromString("6703088")
 	for i := 0; i < b.N; i++ {
-		BarrettReduce(x, q)
+		BarrettReduce(x, q, mu, 28)
 	}
 }
 
 func BenchmarkBarrettReduceDebug(b *testing.B) {
+	m, _ := NewModulus(7681)
 	for i := 0; i < b.N; i++ {
-		x := int64(6703088)
-		barrettReduce(x)
+		x := uint64(6703088)
+		m.Reduce(x)
 	}
 }
 
@@ -0,0 +1,142 @@
+package bigint
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// ModulusMaxBitLen is the largest bit length of a word-sized Modulus,
+// two bits are left free so that lazy additions of residues never overflow.
+const ModulusMaxBitLen = 62
+
+// Modulus is a word-sized modulus q with its precomputed reduction constants.
+// It implements modular arithmetic on uint64 for any odd q up to 62 bits,
+// using Montgomery reduction (R = 2^64), Barrett reduction and Shoup multiplication.
+type Modulus struct {
+	Q uint64
+	barrettHi, barrettLo uint64 // floor(2^128 / q)
+	qInvNeg uint64 // -q^-1 mod 2^64, param of montgomery reduction
+	r2 uint64 // 2^128 mod q, used to convert values to the montgomery form
+}
+
+// NewModulus creates a Modulus for q, q has to be odd and smaller than 2^62
+func NewModulus(q uint64) (*Modulus, error) {
+	if q < 3 || q&1 == 0 || bits.Len64(q) > ModulusMaxBitLen {
+		return nil, errors.New("modulus should be odd and smaller than 2^62")
+	}
+	m := &Modulus{Q: q}
+
+	// floor(2^128 / q) = (2^64 * 2^64) / q, computed by long division over two words
+	var r uint64
+	m.barrettHi, r = bits.Div64(1, 0, q)
+	m.barrettLo, _ = bits.Div64(r, 0, q)
+
+	// q^-1 mod 2^64 with Newton iterations, each one doubles the number of correct bits
+	qInv := q
+	for i := 0; i < 5; i++ {
+		qInv *= 2 - q*qInv
+	}
+	m.qInvNeg = -qInv
+
+	// 2^128 mod q = (2^64 mod q)^2 mod q
+	_, r = bits.Div64(1, 0, q)
+	m.r2 = m.Mul(r, r)
+	return m, nil
+}
+
+// BitLen returns the bit length of q
+func (m *Modulus) BitLen() uint32 {
+	return uint32(bits.Len64(m.Q))
+}
+
+// Add returns a + b mod q, with a, b < q
+func (m *Modulus) Add(a, b uint64) uint64 {
+	r := a + b
+	if r >= m.Q {
+		r -= m.Q
+	}
+	return r
+}
+
+// Sub returns a - b mod q, with a, b < q
+func (m *Modulus) Sub(a, b uint64) uint64 {
+	if a >= b {
+		return a - b
+	}
+	return a + m.Q - b
+}
+
+// Neg returns -a mod q, with a < q
+func (m *Modulus) Neg(a uint64) uint64 {
+	if a == 0 {
+		return 0
+	}
+	return m.Q - a
+}
+
+// Reduce returns x mod q for any word x
+func (m *Modulus) Reduce(x uint64) uint64 {
+	return m.BarrettReduce(0, x)
+}
+
+// BarrettReduce returns x mod q, where x = hi * 2^64 + lo has to be smaller than q * 2^64
+func (m *Modulus) BarrettReduce(hi, lo uint64) uint64 {
+	// estimate floor(x * floor(2^128 / q) / 2^128) from the partial products of the high words
+	t0, _ := bits.Mul64(lo, m.barrettLo)
+	a1Hi, a1Lo := bits.Mul64(lo, m.barrettHi)
+	a2Hi, a2Lo := bits.Mul64(hi, m.barrettLo)
+	s, c1 := bits.Add64(t0, a1Lo, 0)
+	_, c2 := bits.Add64(s, a2Lo, 0)
+	quotient := hi*m.barrettHi + a1Hi + a2Hi + c1 + c2
+	// the estimated quotient is at most 3 smaller than the real one
+	r := lo - quotient*m.Q
+	for r >= m.Q {
+		r -= m.Q
+	}
+	return r
+}
+
+// Mul returns a * b mod q using Barrett reduction, with b < q
+func (m *Modulus) Mul(a, b uint64) uint64 {
+	return m.BarrettReduce(bits.Mul64(a, b))
+}
+
+// MontgomeryReduce returns x * 2^-64 mod q, where x = hi * 2^64 + lo has to be smaller than q * 2^64
+func (m *Modulus) MontgomeryReduce(hi, lo uint64) uint64 {
+	u := lo * m.qInvNeg
+	uqHi, uqLo := bits.Mul64(u, m.Q)
+	_, c := bits.Add64(lo, uqLo, 0) // the low word is zero by construction of u
+	r := hi + uqHi + c
+	if r >= m.Q {
+		r -= m.Q
+	}
+	return r
+}
+
+// MontgomeryForm returns a * 2^64 mod q, with a < q
+func (m *Modulus) MontgomeryForm(a uint64) uint64 {
+	return m.MontgomeryMul(a, m.r2)
+}
+
+// MontgomeryMul returns a * b * 2^-64 mod q, with a, b < q.
+// If b is given in montgomery form, the result is a * b mod q.
+func (m *Modulus) MontgomeryMul(a, b uint64) uint64 {
+	return m.MontgomeryReduce(bits.Mul64(a, b))
+}
+
+// ShoupConstant returns floor(w * 2^64 / q), the precomputed constant of ShoupMul, with w < q
+func (m *Modulus) ShoupConstant(w uint64) uint64 {
+	c, _ := bits.Div64(w, 0, m.Q)
+	return c
+}
+
+// ShoupMul returns a * w mod q for any word a, given wShoup = ShoupConstant(w).
+// Multiplications by a fixed w, e.g. the twiddle factors of the NTT, are faster than with Mul.
+func (m *Modulus) ShoupMul(a, w, wShoup uint64) uint64 {
+	quotient, _ := bits.Mul64(a, wShoup)
+	r := a*w - quotient*m.Q
+	if r >= m.Q {
+		r -= m.Q
+	}
+	return r
+}
@@ -0,0 +1,104 @@
+package bigint
+
+import (
+	"testing"
+	"math/rand"
+)
+
+// test vectors for Modulus, from the Kyber-v1 prime to the largest supported bit length
+var modulusVec = []uint64{
+	7681,
+	12289,
+	8380417,
+	1152921504382476289,
+	4611686018326724609,
+}
+
+// mulMod returns a * b mod q computed with math/big
+func mulMod(a, b, q uint64) uint64 {
+	var x, y, m Int
+	x.Value.SetUint64(a)
+	y.Value.SetUint64(b)
+	m.Value.SetUint64(q)
+	x.Mul(&x, &y)
+	return x.Mod(&x, &m).Value.Uint64()
+}
+
+func TestNewModulus(t *testing.T) {
+	for _, q := range []uint64{0, 1, 2, 7680, 1 << 62 + 1} {
+		if _, err := NewModulus(q); err == nil {
+			t.Errorf("Error in NewModulus: %v should be rejected", q)
+		}
+	}
+}
+
+// Cross-verify the reductions of Modulus with math/big
+func TestModulus(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, q := range modulusVec {
+		m, err := NewModulus(q)
+		if err != nil {
+			t.Fatalf("Error in NewModulus(%v): %v", q, err)
+		}
+		// 2^64 mod q, the montgomery form of 1
+		r := mulMod(1 << 32, 1 << 32, q)
+		for i := 0; i < 1000; i++ {
+			a := rnd.Uint64() % q
+			b := rnd.Uint64() % q
+			x := rnd.Uint64()
+			if got, want := m.Add(a, b), (a + b) % q; got != want {
+				t.Errorf("Error in Add(%v, %v) mod %v, expected %v, got %v", a, b, q, want, got)
+			}
+			if got, want := m.Sub(a, b), (a + q - b) % q; got != want {
+				t.Errorf("Error in Sub(%v, %v) mod %v, expected %v, got %v", a, b, q, want, got)
+			}
+			if got, want := m.Neg(a), (q - a) % q; got != want {
+				t.Errorf("Error in Neg(%v) mod %v, expected %v, got %v", a, q, want, got)
+			}
+			if got, want := m.Reduce(x), x % q; got != want {
+				t.Errorf("Error in Reduce(%v) mod %v, expected %v, got %v", x, q, want, got)
+			}
+			if got, want := m.Mul(a, b), mulMod(a, b, q); got != want {
+				t.Errorf("Error in Mul(%v, %v) mod %v, expected %v, got %v", a, b, q, want, got)
+			}
+			if got, want := m.ShoupMul(x, b, m.ShoupConstant(b)), mulMod(x % q, b, q); got != want {
+				t.Errorf("Error in ShoupMul(%v, %v) mod %v, expected %v, got %v", x, b, q, want, got)
+			}
+			aMont := m.MontgomeryForm(a)
+			if want := mulMod(a, r, q); aMont != want {
+				t.Errorf("Error in MontgomeryForm(%v) mod %v, expected %v, got %v", a, q, want, aMont)
+			}
+			if got, want := m.MontgomeryMul(b, aMont), mulMod(a, b, q); got != want {
+				t.Errorf("Error in MontgomeryMul(%v, %v) mod %v, expected %v, got %v", b, aMont, q, want, got)
+			}
+		}
+	}
+}
+
+// test vectors for function BarrettReduce, with x bounded by 2^shift in absolute value
+type argBarrettReduce struct {
+	x, q *Int
+	shift uint32
+}
+var barrettReduceVec = []argBarrettReduce{
+	{NewInt(6703088), NewInt(7681), 28},
+	{NewInt(-6703088), NewInt(7681), 28},
+	{NewInt(7680), NewInt(7681), 28},
+	{NewInt(-7681), NewInt(7681), 28},
+	{NewIntFromString("21267647932558653966460912964485513215"), NewIntFromString("4611686018326724609"), 128},
+	{NewIntFromString("-21267647932558653966460912964485513215"), NewIntFromString("4611686018326724609"), 128},
+	{NewIntFromString("1267650600228229401496703205375"), NewIntFromString("1267650600228229401496703205653"), 202},
+}
+
+func TestBarrettReduce(t *testing.T) {
+	var want Int
+	for i, testPair := range barrettReduceVec {
+		want.Mod(testPair.x, testPair.q)
+		x := new(Int)
+		x.SetBigInt(testPair.x)
+		mu := BarrettConstant(testPair.q, testPair.shift)
+		if !BarrettReduce(x, testPair.q, mu, testPair.shift).EqualTo(&want) {
+			t.Errorf("Error BarrettReduce test pair %v, expected %v, got %v", i, want.Value.String(), x.Value.String())
+		}
+	}
+}
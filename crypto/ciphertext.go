@@ -8,19 +8,21 @@ import (
 
 type Ciphertext struct {
 	value [2]*ring.Ring
+	noise float64  // log2 of the heuristic bound on the invariant noise, 0 if unknown, see NoiseBudgetEstimate
+	seed []byte  // seed of value[1] for the ciphertexts of SymmetricEncryptor, nil otherwise
 }
 
 // NewCiphertext creates a new ciphertext
-func NewCiphertext(n uint32, q bigint.Int, nttParams *polynomial.NttParams) *Ciphertext {
+func NewCiphertext(n uint32, q bigint.Int, nttParams *polynomial.NttParams) (*Ciphertext, error) {
 	ciphertext := new(Ciphertext)
 	err := *new(error)
 	ciphertext.value[0], err = ring.NewRing(n, q, nttParams)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	ciphertext.value[1], err = ring.NewRing(n, q, nttParams)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return ciphertext
+	return ciphertext, nil
 }
@@ -1,8 +1,13 @@
 package crypto
 
+import (
+	"github.com/dedis/lago/ring"
+)
+
 type Decryptor struct {
 	ctx *FVContext	  // FV context
 	secretkey *SecretKey   // secret key
+	levelkeys []*ring.Ring  // secret key reduced to the levels of the context, see secretKeyAt
 }
 
 // NewDecryptor creates a new Decryptor for decryption
@@ -10,19 +15,58 @@ func NewDecryptor(ctx *FVContext, secretkey *SecretKey) *Decryptor {
 	decryptor := new(Decryptor)
 	decryptor.ctx = ctx
 	decryptor.secretkey = secretkey
+	decryptor.levelkeys = make([]*ring.Ring, len(ctx.levels))
 	return decryptor
 }
 
+// secretKeyAt returns the context of the level of ciphertext and the secret key reduced to it
+func (decryptor *Decryptor) secretKeyAt(ciphertext *Ciphertext) (*FVContext, *ring.Ring, error) {
+	level, err := decryptor.ctx.Level(ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := decryptor.ctx.levels[level]
+	if ctx == decryptor.ctx {
+		return ctx, decryptor.secretkey.Value, nil
+	}
+	if decryptor.levelkeys[level] == nil {
+		if decryptor.levelkeys[level], err = reduceRing(ctx, decryptor.secretkey.Value); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ctx, decryptor.levelkeys[level], nil
+}
+
 // Decrypt decrypts ciphertext to plaintext with decryptor parameters,
-// both ciphertext and plaintext are in NTT form.
-func (decryptor *Decryptor) Decrypt(ciphertext *Ciphertext) *Plaintext {
-	plaintext := NewPlaintext(decryptor.ctx.N, decryptor.ctx.Q, decryptor.ctx.NttParams)
-	plaintext.Value.MulCoeffs(ciphertext.value[1], *decryptor.secretkey)
-	plaintext.Value.Add(plaintext.Value, ciphertext.value[0])
-	plaintext.Value.Poly.InverseNTT()
-	center(plaintext.Value)
-	plaintext.Value.MulScalar(plaintext.Value, decryptor.ctx.T)
-	plaintext.Value.DivRound(plaintext.Value, decryptor.ctx.Q)
-	plaintext.Value.Mod(plaintext.Value, decryptor.ctx.T)
-	return plaintext
+// ciphertext is in NTT form and plaintext is in coefficient form. ciphertext can be at any level of the context,
+// the plaintext being modulo Q.
+func (decryptor *Decryptor) Decrypt(ciphertext *Ciphertext) (*Plaintext, error) {
+	ctx, sk, err := decryptor.secretKeyAt(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = m.MulCoeffs(ciphertext.value[1], sk); err != nil {
+		return nil, err
+	}
+	if _, err = m.Add(m, ciphertext.value[0]); err != nil {
+		return nil, err
+	}
+	m.Poly.InverseNTT()
+	center(m)
+	m.MulScalar(m, ctx.T)
+	m.DivRound(m, ctx.Q)
+	m.Mod(m, ctx.T)
+
+	plaintext, err := NewPlaintext(decryptor.ctx.N, decryptor.ctx.Q, decryptor.ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if err = plaintext.Value.Poly.SetCoefficients(m.GetCoefficients()); err != nil {
+		return nil, err
+	}
+	return plaintext, nil
 }
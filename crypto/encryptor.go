@@ -8,56 +8,146 @@ import (
 type Encryptor struct {
 	ctx *FVContext	  // FV context
 	publickey *PublicKey  // public key
+	prng ring.PRNG  // source of the randomness of the encryptions, a new ring.NewPRNG for each one if nil
 }
 
 // NewEncryptor creates a new Encryptor for encryption
 func NewEncryptor(ctx *FVContext, publickey *PublicKey) *Encryptor {
+	return NewEncryptorWithPRNG(ctx, publickey, nil)
+}
+
+// NewEncryptorWithPRNG creates a new Encryptor sampling the randomness of the encryptions with prng,
+// e.g. a ring.NewXOF for reproducible encryptions. The encryptor is then not safe for concurrent use.
+func NewEncryptorWithPRNG(ctx *FVContext, publickey *PublicKey, prng ring.PRNG) *Encryptor {
 	encryptor := new(Encryptor)
 	encryptor.ctx = ctx
 	encryptor.publickey = publickey
+	encryptor.prng = prng
 	return encryptor
 }
 
-// Encrypt encrypts plaintext to ciphertext with encryptor parameters,
-// both plaintext and ciphertext are in NTT form.
-func (encryptor *Encryptor) Encrypt(plaintext *Plaintext) *Ciphertext {
-	plaintext.Value.Poly.NTT()
+// Encrypt encrypts plaintext to ciphertext with encryptor parameters, plaintext can be in either form and
+// is left unchanged, its coefficients are taken mod T. ciphertext is in NTT form.
+func (encryptor *Encryptor) Encrypt(plaintext *Plaintext) (*Ciphertext, error) {
+	prng, err := randomSource(encryptor.prng)
+	if err != nil {
+		return nil, err
+	}
 	// deltaM = delta * m
-	deltaM, err := ring.NewRing(encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams)
+	deltaM, err := plaintextNTT(encryptor.ctx, plaintext, false)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	deltaM.MulScalar(plaintext.Value, encryptor.ctx.Delta)
+	deltaM.MulScalar(deltaM, encryptor.ctx.Delta)
 
 	// u sampled from R_2, e1 and e2 sampled from gaussian
-	u, err := ring.NewUniformPoly(encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams, *bigint.NewInt(2))
+	u, err := ring.NewUniformPoly(prng, encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams, *bigint.NewInt(2))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	u.Poly.NTT() // turn u to NTT form for polynomial multiplication
 
-	e1, err := ring.NewGaussPoly(encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams, encryptor.ctx.Sigma)
+	e1, err := ring.NewGaussPoly(prng, encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams, encryptor.ctx.Gauss)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	e1.Poly.NTT()
-	e2, err := ring.NewGaussPoly(encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams, encryptor.ctx.Sigma)
+	e2, err := ring.NewGaussPoly(prng, encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams, encryptor.ctx.Gauss)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	e2.Poly.NTT()
 
 	// Ciphertext = (c0, c1)
 	// c0 = delta * m + publickey[0] * u + e1
 	// c1 = publickey[1] * u + e2
-	ciphertext := NewCiphertext(encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams)
-	ciphertext.value[0].MulCoeffs(encryptor.publickey[0], u)
+	ciphertext, err := NewCiphertext(encryptor.ctx.N, encryptor.ctx.Q, encryptor.ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = ciphertext.value[0].MulCoeffs(encryptor.publickey[0], u); err != nil {
+		return nil, err
+	}
 	ciphertext.value[0].Add(ciphertext.value[0], deltaM)
 	ciphertext.value[0].Add(ciphertext.value[0], e1)
 
-	ciphertext.value[1].MulCoeffs(encryptor.publickey[1], u)
+	if _, err = ciphertext.value[1].MulCoeffs(encryptor.publickey[1], u); err != nil {
+		return nil, err
+	}
 	ciphertext.value[1].Add(ciphertext.value[1], e2)
+	ciphertext.noise = encryptor.ctx.freshNoise()
+
+	return ciphertext, nil
+}
+
+type SymmetricEncryptor struct {
+	ctx *FVContext	  // FV context
+	secretkey *SecretKey  // secret key
+	prng ring.PRNG  // source of the randomness of the encryptions, a new ring.NewPRNG for each one if nil
+}
+
+// NewSymmetricEncryptor creates a new SymmetricEncryptor, encrypting with the secret key
+// when the data owner holds it
+func NewSymmetricEncryptor(ctx *FVContext, secretkey *SecretKey) *SymmetricEncryptor {
+	return NewSymmetricEncryptorWithPRNG(ctx, secretkey, nil)
+}
+
+// NewSymmetricEncryptorWithPRNG creates a new SymmetricEncryptor sampling the seeds and errors of the encryptions
+// with prng. The encryptor is then not safe for concurrent use.
+func NewSymmetricEncryptorWithPRNG(ctx *FVContext, secretkey *SecretKey, prng ring.PRNG) *SymmetricEncryptor {
+	encryptor := new(SymmetricEncryptor)
+	encryptor.ctx = ctx
+	encryptor.secretkey = secretkey
+	encryptor.prng = prng
+	return encryptor
+}
+
+// Encrypt encrypts plaintext to ciphertext with the secret key, plaintext can be in either form and is left unchanged,
+// its coefficients are taken mod T. ciphertext is in NTT form. The ciphertext (-a * s + e + delta * m, a) has only the noise e, and its uniform
+// component a is expanded from a random seed of ring.SeedSize bytes, which FVContext.Marshal encodes instead of a.
+func (encryptor *SymmetricEncryptor) Encrypt(plaintext *Plaintext) (*Ciphertext, error) {
+	ctx := encryptor.ctx
+	prng, err := randomSource(encryptor.prng)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := newSeed(prng)
+	if err != nil {
+		return nil, err
+	}
+	deltaM, err := plaintextNTT(ctx, plaintext, false)
+	if err != nil {
+		return nil, err
+	}
+	deltaM.MulScalar(deltaM, ctx.Delta)
+
+	// a expanded from the seed, e sampled from gaussian
+	a, err := ring.NewUniformPolyFromSeed(ctx.N, ctx.Q, ctx.NttParams, seed)
+	if err != nil {
+		return nil, err
+	}
+	a.Poly.NTT()
+	e, err := ring.NewGaussPoly(prng, ctx.N, ctx.Q, ctx.NttParams, ctx.Gauss)
+	if err != nil {
+		return nil, err
+	}
+	e.Poly.NTT()
+
+	// Ciphertext = (c0, c1)
+	// c0 = -a * s + e + delta * m
+	// c1 = a
+	ciphertext, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = ciphertext.value[0].MulCoeffs(a, encryptor.secretkey.Value); err != nil {
+		return nil, err
+	}
+	ciphertext.value[0].Sub(e, ciphertext.value[0])
+	ciphertext.value[0].Add(ciphertext.value[0], deltaM)
+	ciphertext.value[1] = a
+	ciphertext.seed = seed
+	ciphertext.noise = ctx.symmetricNoise()
 
-	plaintext.Value.Poly.InverseNTT()
-	return ciphertext
+	return ciphertext, nil
 }
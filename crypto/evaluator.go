@@ -1,142 +1,361 @@
 package crypto
 
 import (
-	"github.com/dedis/lago/ring"
-	"github.com/dedis/lago/bigint"
+	"errors"
 	"math"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/ring"
+	"github.com/dedis/lago/polynomial"
 )
 
 type Evaluator struct {
 	ctx *FVContext	  // FV context
-	evalkey *EvaluationKey
-	evalsize uint32
+	relinkey *SwitchingKey  // switching key from s^2 to s
+	galoiskeys GaloisKeys  // switching keys of the galois automorphisms, see SetGaloisKeys
+	levelkeys map[levelKey]*SwitchingKey  // relinearization and galois keys reduced to the levels below, see ownKeyAt
 }
 
-// NewEvaluator creates a new evaluator for varies evaluation, e.g. add, sub, mul.
+// NewEvaluator creates a new evaluator for varies evaluation, e.g. add, sub, mul,
+// with an evaluation key of BitDecomposition in base 2^evalsize.
 func NewEvaluator(ctx *FVContext, evalkey *EvaluationKey, evalsize uint32) *Evaluator {
+	return NewEvaluatorWithKey(ctx, &SwitchingKey{Decomposition: BitDecomposition, Base: evalsize, Value: *evalkey})
+}
+
+// NewEvaluatorWithKey creates a new evaluator relinearizing with relinKey, e.g. Key.RelinearizationKey()
+func NewEvaluatorWithKey(ctx *FVContext, relinKey *SwitchingKey) *Evaluator {
 	evaluator := new(Evaluator)
 	evaluator.ctx = ctx
-	evaluator.evalkey = evalkey
-	evaluator.evalsize = evalsize
+	evaluator.relinkey = relinKey
+	evaluator.levelkeys = make(map[levelKey]*SwitchingKey)
 	return evaluator
 }
 
-func (evaluator *Evaluator)change2BigNttParams(r *ring.Ring) {
-	r.Q = evaluator.ctx.BigQ
-	r.Poly.SetNTTParams(evaluator.ctx.BigNttParams)
-}
-
-func (evaluator *Evaluator)change2NormalNttParams(r *ring.Ring) {
-	r.Q = evaluator.ctx.Q
-	r.Poly.SetNTTParams(evaluator.ctx.NttParams)
+// context returns the context of the level of the ciphertexts, which have to be at the same level
+func (evaluator *Evaluator) context(cts ...*Ciphertext) (*FVContext, error) {
+	ctx, err := evaluator.ctx.atLevel(cts[0].value[0].Q)
+	if err != nil {
+		return nil, err
+	}
+	for _, ct := range cts[1:] {
+		if !ct.value[0].Q.EqualTo(&ctx.Q) {
+			return nil, errors.New("ciphertexts should be at the same level")
+		}
+	}
+	return ctx, nil
 }
 
 // Add conducts the homomorphic addition between ciphertexts c1 and c2
-func (evaluator *Evaluator) Add(c1, c2 *Ciphertext) *Ciphertext {
-	c := NewCiphertext(evaluator.ctx.N, evaluator.ctx.Q, evaluator.ctx.NttParams)
-	c.value[0].Add(c1.value[0], c2.value[0])
-	c.value[1].Add(c1.value[1], c2.value[1])
-	return c
+func (evaluator *Evaluator) Add(c1, c2 *Ciphertext) (*Ciphertext, error) {
+	ctx, err := evaluator.context(c1, c2)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.value {
+		if _, err = c.value[i].Add(c1.value[i], c2.value[i]); err != nil {
+			return nil, err
+		}
+	}
+	c.noise = addLog(addLog(c1.noise, c2.noise), ctx.plainNoise())
+	return c, nil
 }
 
 // Sub conducts the homomorphic subtraction between ciphertexts c1 and c2
-func (evaluator *Evaluator) Sub(c1, c2 *Ciphertext) *Ciphertext {
-	c := NewCiphertext(evaluator.ctx.N, evaluator.ctx.Q, evaluator.ctx.NttParams)
-	c.value[0].Sub(c1.value[0], c2.value[0])
-	c.value[1].Sub(c1.value[1], c2.value[1])
-	return c
+func (evaluator *Evaluator) Sub(c1, c2 *Ciphertext) (*Ciphertext, error) {
+	ctx, err := evaluator.context(c1, c2)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.value {
+		if _, err = c.value[i].Sub(c1.value[i], c2.value[i]); err != nil {
+			return nil, err
+		}
+	}
+	c.noise = addLog(addLog(c1.noise, c2.noise), ctx.plainNoise())
+	return c, nil
 }
 
-// Multiply conducts the homomorphic multiplication between ciphertexts c1 and c2
-func (evaluator *Evaluator) Multiply(ct1, ct2 *Ciphertext) *Ciphertext {
-	c0, err := ring.NewRing(evaluator.ctx.N, evaluator.ctx.BigQ, evaluator.ctx.BigNttParams)
+// plaintextNTT returns the plaintext, in either form, with its coefficients reduced mod T,
+// as a ring modulo the ciphertext modulus of ctx in NTT form. The plaintext has the degree of ctx and any modulus.
+// The coefficients are in [0, T), or in (-T/2, T/2] if centered, which keeps the noise of multiplications small.
+func plaintextNTT(ctx *FVContext, plaintext *Plaintext, centered bool) (*ring.Ring, error) {
+	if plaintext.Value.N != ctx.N {
+		return nil, polynomial.ErrParamMismatch
+	}
+	p, err := cloneRing(plaintext.Value)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if p.IsNTT() {
+		p.Poly.InverseNTT()
 	}
-	c1, err := ring.NewRing(evaluator.ctx.N, evaluator.ctx.BigQ, evaluator.ctx.BigNttParams)
+	tDiv2 := bigint.NewInt(1)
+	tDiv2.Div(&ctx.T, bigint.NewInt(2))
+	coeffs := make([]bigint.Int, ctx.N)
+	for i, c := range p.GetCoefficients() {
+		coeffs[i].Mod(&c, &ctx.T)
+		if centered && coeffs[i].Compare(tDiv2) == 1 {
+			coeffs[i].Sub(&coeffs[i], &ctx.T)
+			coeffs[i].Mod(&coeffs[i], &ctx.Q)
+		}
+	}
+	m, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.Poly.SetCoefficients(coeffs); err != nil {
+		return nil, err
+	}
+	m.Poly.NTT()
+	return m, nil
+}
+
+// AddPlain conducts the homomorphic addition between ciphertext ct and plaintext,
+// plaintext can be in either form and its coefficients are taken mod T.
+func (evaluator *Evaluator) AddPlain(ct *Ciphertext, plaintext *Plaintext) (*Ciphertext, error) {
+	ctx, err := evaluator.context(ct)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	c2, err := ring.NewRing(evaluator.ctx.N, evaluator.ctx.BigQ, evaluator.ctx.BigNttParams)
+	deltaM, err := plaintextNTT(ctx, plaintext, false)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	tmp, err := ring.NewRing(evaluator.ctx.N, evaluator.ctx.BigQ, evaluator.ctx.BigNttParams)
+	deltaM.MulScalar(deltaM, ctx.Delta)
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	if _, err = c.value[0].Add(ct.value[0], deltaM); err != nil {
+		return nil, err
+	}
+	if _, err = c.value[1].Copy(ct.value[1]); err != nil {
+		return nil, err
+	}
+	c.noise = addLog(ct.noise, ctx.plainNoise())
+	return c, nil
+}
 
-	// set c0, c1, c2
-	ct1.value[0].Poly.InverseNTT()
-	ct1.value[1].Poly.InverseNTT()
-	ct2.value[0].Poly.InverseNTT()
-	ct2.value[1].Poly.InverseNTT()
+// SubPlain conducts the homomorphic subtraction of plaintext from ciphertext ct,
+// plaintext can be in either form and its coefficients are taken mod T.
+func (evaluator *Evaluator) SubPlain(ct *Ciphertext, plaintext *Plaintext) (*Ciphertext, error) {
+	ctx, err := evaluator.context(ct)
+	if err != nil {
+		return nil, err
+	}
+	deltaM, err := plaintextNTT(ctx, plaintext, false)
+	if err != nil {
+		return nil, err
+	}
+	deltaM.MulScalar(deltaM, ctx.Delta)
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.value[0].Sub(ct.value[0], deltaM); err != nil {
+		return nil, err
+	}
+	if _, err = c.value[1].Copy(ct.value[1]); err != nil {
+		return nil, err
+	}
+	c.noise = addLog(ct.noise, ctx.plainNoise())
+	return c, nil
+}
 
-	evaluator.change2BigNttParams(ct1.value[0])
-	evaluator.change2BigNttParams(ct1.value[1])
-	evaluator.change2BigNttParams(ct2.value[0])
-	evaluator.change2BigNttParams(ct2.value[1])
+// MulPlain conducts the homomorphic multiplication between ciphertext ct and plaintext,
+// plaintext can be in either form and its coefficients are taken mod T.
+// No relinearization is needed, and the noise grows with N * T instead of the noise of a second ciphertext.
+func (evaluator *Evaluator) MulPlain(ct *Ciphertext, plaintext *Plaintext) (*Ciphertext, error) {
+	ctx, err := evaluator.context(ct)
+	if err != nil {
+		return nil, err
+	}
+	m, err := plaintextNTT(ctx, plaintext, true)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.value {
+		if _, err = c.value[i].MulCoeffs(ct.value[i], m); err != nil {
+			return nil, err
+		}
+	}
+	// the noise and the wrapping of the product mod T are multiplied by N * T/2
+	t := float64(ctx.T.Int64())
+	c.noise = mulLog(addLog(ct.noise, ctx.plainNoise()), float64(ctx.N) * t / 2)
+	return c, nil
+}
+
+// MulScalar conducts the homomorphic multiplication between ciphertext ct and the integer scalar mod T
+func (evaluator *Evaluator) MulScalar(ct *Ciphertext, scalar bigint.Int) (*Ciphertext, error) {
+	ctx, err := evaluator.context(ct)
+	if err != nil {
+		return nil, err
+	}
+	// the scalar is centered mod T, and lifted mod Q
+	var k bigint.Int
+	k.Mod(&scalar, &ctx.T)
+	tDiv2 := bigint.NewInt(1)
+	tDiv2.Div(&ctx.T, bigint.NewInt(2))
+	if k.Compare(tDiv2) == 1 {
+		k.Sub(&k, &ctx.T)
+		k.Mod(&k, &ctx.Q)
+	}
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.value {
+		if _, err = c.value[i].MulScalar(ct.value[i], k); err != nil {
+			return nil, err
+		}
+		c.value[i].Mod(c.value[i], ctx.Q)
+	}
+	c.noise = mulLog(addLog(ct.noise, ctx.plainNoise()), math.Max(scalarAbs(&k, &ctx.Q), 1))
+	return c, nil
+}
 
-	c0.MulPoly(ct1.value[0], ct2.value[0])
+// Negate conducts the homomorphic negation of ciphertext ct
+func (evaluator *Evaluator) Negate(ct *Ciphertext) (*Ciphertext, error) {
+	ctx, err := evaluator.context(ct)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.value {
+		if _, err = c.value[i].Neg(ct.value[i]); err != nil {
+			return nil, err
+		}
+	}
+	c.noise = addLog(ct.noise, ctx.plainNoise())
+	return c, nil
+}
 
-	center(c0)
-	c0.MulScalar(c0, evaluator.ctx.T)
-	c0.DivRound(c0, evaluator.ctx.Q)
-	c0.Mod(c0, evaluator.ctx.Q)
-	evaluator.change2NormalNttParams(c0)
-	c0.Poly.NTT()
+// Multiply conducts the homomorphic multiplication between ciphertexts c1 and c2.
+// The tensor product is computed in the RNS bases Q and P, then scaled by T/Q with the full-RNS
+// algorithm of https://eprint.iacr.org/2018/117.pdf, so that no modulus larger than a machine word is needed.
+// The ciphertexts modulo a product of primes hold their residues in the basis Q, and stay in RNS form
+// from the lift of the operands to the result.
+func (evaluator *Evaluator) Multiply(ct1, ct2 *Ciphertext) (*Ciphertext, error) {
+	ctx, err := evaluator.context(ct1, ct2)
+	if err != nil {
+		return nil, err
+	}
 
-	c1.MulPoly(ct1.value[0], ct2.value[1])
-	tmp.MulPoly(ct1.value[1], ct2.value[0])
-	c1.Add(c1, tmp)
-	center(c1)
-	c1.MulScalar(c1, evaluator.ctx.T)
-	c1.DivRound(c1, evaluator.ctx.Q)
-	c1.Mod(c1, evaluator.ctx.Q)
-	evaluator.change2NormalNttParams(c1)
-	c1.Poly.NTT()
+	// lift the ciphertexts to the bases Q and P, in NTT form
+	a0Q, a0P, err := lift(ctx, ct1.value[0])
+	if err != nil {
+		return nil, err
+	}
+	a1Q, a1P, err := lift(ctx, ct1.value[1])
+	if err != nil {
+		return nil, err
+	}
+	b0Q, b0P, err := lift(ctx, ct2.value[0])
+	if err != nil {
+		return nil, err
+	}
+	b1Q, b1P, err := lift(ctx, ct2.value[1])
+	if err != nil {
+		return nil, err
+	}
 
-	c2.MulPoly(ct1.value[1], ct2.value[1])
-	center(c2)
-	c2.MulScalar(c2, evaluator.ctx.T)
-	c2.DivRound(c2, evaluator.ctx.Q)
-	c2.Mod(c2, evaluator.ctx.Q)
-	evaluator.change2NormalNttParams(c2)
+	// tensor product: d0 = a0 * b0, d1 = a0 * b1 + a1 * b0, d2 = a1 * b1
+	var dQ, dP [3]*polynomial.RNSPoly
+	tmpQ, _ := polynomial.NewRNSPolynomial(ctx.RNSParams)
+	tmpP, _ := polynomial.NewRNSPolynomial(ctx.AuxRNSParams)
+	for i := range dQ {
+		dQ[i], _ = polynomial.NewRNSPolynomial(ctx.RNSParams)
+		dP[i], _ = polynomial.NewRNSPolynomial(ctx.AuxRNSParams)
+	}
+	dQ[0].MulCoeffs(a0Q, b0Q)
+	dQ[1].MulCoeffs(a0Q, b1Q)
+	tmpQ.MulCoeffs(a1Q, b0Q)
+	dQ[1].AddMod(dQ[1], tmpQ)
+	dQ[2].MulCoeffs(a1Q, b1Q)
+	dP[0].MulCoeffs(a0P, b0P)
+	dP[1].MulCoeffs(a0P, b1P)
+	tmpP.MulCoeffs(a1P, b0P)
+	dP[1].AddMod(dP[1], tmpP)
+	dP[2].MulCoeffs(a1P, b1P)
 
-	evaluator.change2NormalNttParams(ct1.value[0])
-	evaluator.change2NormalNttParams(ct1.value[1])
-	evaluator.change2NormalNttParams(ct2.value[0])
-	evaluator.change2NormalNttParams(ct2.value[1])
-	ct1.value[0].Poly.NTT()
-	ct1.value[1].Poly.NTT()
-	ct2.value[0].Poly.NTT()
-	ct2.value[1].Poly.NTT()
+	// scale by T/Q: round(T * d_i / Q) is computed in the basis P, then converted back to the basis Q
+	var c [3]*ring.Ring
+	for i := range c {
+		dQ[i].InverseNTT()
+		dP[i].InverseNTT()
+		ctx.scaler.Scale(dQ[i], dP[i], tmpP)
+		ctx.extenderPQ.Convert(tmpP, tmpQ)
+		if i < 2 {
+			tmpQ.NTT()
+		}
+		c[i], err = ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+		if err != nil {
+			return nil, err
+		}
+		if err = c[i].Poly.SetRNS(tmpQ); err != nil {
+			return nil, err
+		}
+	}
+	c0, c1, c2 := c[0], c[1], c[2]
 
 	// relinearisation
-	c2_i, err := ring.NewRing(evaluator.ctx.N, evaluator.ctx.Q, evaluator.ctx.NttParams)
+	relinKey, err := evaluator.ownKeyAt(ctx, 0, evaluator.relinkey)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	l := int(math.Floor(float64(evaluator.ctx.Q.Value.BitLen() - 1) / float64(evaluator.evalsize))) + 1
-	mask := bigint.NewInt(1)
-	mask.Lsh(mask, evaluator.evalsize)
-	mask.Sub(mask, bigint.NewInt(1))
-	for i := 0; i < l; i++ {
-		c2_i.And(c2, *mask)
-		c2_i.Poly.NTT()
-		c2.Rsh(c2, evaluator.evalsize)
-
-		tmp.MulCoeffs(c2_i, (*evaluator.evalkey)[i][0])
-		c0.Add(c0, tmp)
-
-		tmp.MulCoeffs(c2_i, (*evaluator.evalkey)[i][1])
-		c1.Add(c1, tmp)
+	r0, r1, err := evaluator.keySwitch(c2, relinKey)
+	if err != nil {
+		return nil, err
 	}
-	c0.Mod(c0, evaluator.ctx.Q)
-	c1.Mod(c1, evaluator.ctx.Q)
+	c0.Add(c0, r0)
+	c1.Add(c1, r1)
 	// construct result ciphertext
 	newCiphertext := new(Ciphertext)
 	newCiphertext.value[0] = c0
 	newCiphertext.value[1] = c1
-	return newCiphertext
+	newCiphertext.noise = addLog(ctx.multiplyNoise(ct1.noise, ct2.noise), ctx.keySwitchNoise(relinKey))
+	return newCiphertext, nil
+}
+
+// lift returns r, in NTT form modulo Q, in the RNS bases Q and P of ctx, both of them in NTT form.
+// The residues modulo Q are read from r without math/big, then converted to the basis P in coefficient form.
+func lift(ctx *FVContext, r *ring.Ring) (*polynomial.RNSPoly, *polynomial.RNSPoly, error) {
+	rQ, err := polynomial.NewRNSPolynomial(ctx.RNSParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = r.Poly.GetRNS(rQ); err != nil {
+		return nil, nil, err
+	}
+	tmp, err := polynomial.NewRNSPolynomial(ctx.RNSParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmp.Copy(rQ)
+	if _, err = tmp.InverseNTT(); err != nil {
+		return nil, nil, err
+	}
+	rP, err := polynomial.NewRNSPolynomial(ctx.AuxRNSParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = ctx.extenderQP.Convert(tmp, rP); err != nil {
+		return nil, nil, err
+	}
+	rP.NTT()
+	return rQ, rP, nil
 }
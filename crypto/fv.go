@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"errors"
 	"github.com/dedis/lago/bigint"
 	"github.com/dedis/lago/polynomial"
 	"github.com/dedis/lago/ring"
@@ -14,27 +15,249 @@ type FVContext struct {
 	N uint32  // polynomial degree
 	T bigint.Int  // plaintext modulus
 	Q bigint.Int  // ciphertext modulus
-	BigQ bigint.Int  // big ciphertext modulus, used for relinearisation
 	Delta bigint.Int  // floor(ciphertext modulus / plaintext modulus)
 	InvDelta bigint.Int
 	Sigma float64
+	Gauss ring.GaussSampler  // sampler of the gaussian noise of standard deviation Sigma, a ring.CDTSampler by default
 	NttParams *polynomial.NttParams
-	BigNttParams *polynomial.NttParams
+	RNSParams *polynomial.RNSParams  // ciphertext modulus as an RNS basis, used in homomorphic multiplication
+	AuxRNSParams *polynomial.RNSParams  // auxiliary RNS basis, used in homomorphic multiplication
+	extenderQP *polynomial.BasisExtender
+	extenderPQ *polynomial.BasisExtender
+	scaler *polynomial.Scaler
+	SpecialP bigint.Int  // special prime of HybridDecomposition
+	specialNttParams *polynomial.NttParams
+	specialPInv bigint.Int  // P^-1 mod Q
+	Chain []*polynomial.NttParams  // NTT params of the moduli Q_l = q_0 * ... * q_l of the levels, see ModSwitch
+	levels []*FVContext  // contexts of the levels, the last one being the context itself
+	id []byte  // first IDSize bytes of the hash of the parameters, see FVContext.Marshal
 }
 
-// NewFVContext creates a new FV context containing all required parameters.
-func NewFVContext(N uint32, T, Q, BigQ bigint.Int) *FVContext {
+// auxBitLen is the bit length of the primes of the auxiliary RNS basis
+const auxBitLen = 61
+
+// NewFVContext creates a new FV context containing all required parameters, with the noise DefaultSigma.
+// The errors of the polynomial package, e.g. polynomial.ErrBadDegree, are returned for invalid N and Q.
+//
+// BigQ is still checked to be an NTT-friendly prime greater than Q^2, as it had to be.
+//
+// Deprecated: BigQ is not used, since Multiply scales the tensor product in the RNS bases of Q and of
+// an auxiliary modulus instead of modulo BigQ. Q has to be a prime of at most bigint.ModulusMaxBitLen bits,
+// while larger primes were accepted before: larger moduli are built as products of primes with Moduli.
+// Use NewFVContextFromParameters(NewParameters(N, T, Q)) or NewRNSParameters.
+func NewFVContext(N uint32, T, Q, BigQ bigint.Int) (*FVContext, error) {
+	fv, err := NewFVContextFromParameters(NewParameters(N, T, Q))
+	if err != nil {
+		return nil, err
+	}
+	if BigQ.Compare(new(bigint.Int).Mul(&Q, &Q)) != 1 {
+		return nil, errors.New("big ciphertext modulus BigQ should be greater than Q^2")
+	}
+	twoN := bigint.NewInt(2 * int64(N))
+	if !polynomial.IsPrime(&BigQ) || !new(bigint.Int).Mod(&BigQ, twoN).EqualTo(bigint.NewInt(1)) {
+		return nil, polynomial.ErrModulusNotNTTFriendly
+	}
+	return fv, nil
+}
+
+// NewFVContextFromParameters derives an FV context from params,
+// the same parameters always give the same context.
+// Q is either a prime or the product of Moduli, all of them equal to 1 mod 2N and of at most
+// bigint.ModulusMaxBitLen bits.
+// The levels of the modulus chain are derived from the prefixes of Moduli larger than T.
+func NewFVContextFromParameters(params *Parameters) (*FVContext, error) {
+	fv, err := newFVContext(params)
+	if err != nil {
+		return nil, err
+	}
+	if err = fv.generateSpecialPrime(params.QModuli()); err != nil {
+		return nil, err
+	}
+
+	// the levels below share the special prime of the context, so that the hybrid switching keys can be reduced to them
+	moduli := params.QModuli()
+	levels := []*FVContext{fv}
+	for l := len(moduli) - 1; l > 0; l-- {
+		levelParams := NewRNSParameters(params.N, params.T, moduli[:l])
+		levelParams.Sigma = params.Sigma
+		if params.T.Compare(&levelParams.Q) != -1 {
+			break
+		}
+		level, err := newFVContext(levelParams)
+		if err != nil {
+			return nil, err
+		}
+		level.setSpecialPrime(fv.SpecialP, fv.specialNttParams)
+		levels = append([]*FVContext{level}, levels...)
+	}
+	chain := make([]*polynomial.NttParams, len(levels))
+	for i := range levels {
+		chain[i] = levels[i].NttParams
+	}
+	for i := range levels {
+		levels[i].levels = levels[:i + 1]
+		levels[i].Chain = chain[:i + 1]
+	}
+	return fv, nil
+}
+
+// newFVContext derives the context of the level of ciphertext modulus params.Q, without special prime and chain
+func newFVContext(params *Parameters) (*FVContext, error) {
+	product := bigint.NewInt(1)
+	for _, q := range params.QModuli() {
+		product.Mul(product, &q)
+	}
+	if !product.EqualTo(&params.Q) {
+		return nil, errors.New("ciphertext modulus should be the product of its primes")
+	}
+	if params.T.Compare(bigint.NewInt(2)) == -1 || params.T.Compare(&params.Q) != -1 {
+		return nil, errors.New("plaintext modulus T should be in [2, Q)")
+	}
+	if !(params.Sigma > 0) {
+		return nil, errors.New("noise standard deviation sigma should be positive")
+	}
 	fv := new(FVContext)
-	fv.N = N
-	fv.T = T
-	fv.Q = Q
-	fv.BigQ = BigQ
-	fv.Delta.Div(&Q, &T)
-	fv.InvDelta.Inv(&fv.Delta, &Q)
-	fv.Sigma = 3.19  // distributed gaussian noise parameter, suggested by SEAL library.
-	fv.NttParams = polynomial.GenerateNTTParams(N, Q)
-	fv.BigNttParams = polynomial.GenerateNTTParams(N, BigQ)
-	return fv
+	fv.N = params.N
+	fv.T.SetBigInt(&params.T)
+	fv.Q.SetBigInt(&params.Q)
+	fv.Delta.Div(&fv.Q, &fv.T)
+	fv.InvDelta.Inv(&fv.Delta, &fv.Q)
+	fv.Sigma = params.Sigma
+	var err error
+	if fv.Gauss, err = ring.NewCDTSampler(fv.Sigma); err != nil {
+		return nil, err
+	}
+	fv.NttParams, err = polynomial.GenerateNTTParamsRNS(fv.N, params.QModuli())
+	if err != nil {
+		return nil, err
+	}
+	// the objects of the context are encoded with the parameter ID, see FVContext.Marshal
+	h, err := params.Hash()
+	if err != nil {
+		return nil, err
+	}
+	fv.id = h[:IDSize]
+	if err = fv.generateRNSParams(params.QModuli()); err != nil {
+		return nil, err
+	}
+	return fv, nil
+}
+
+// MaxLevel returns the level of the fresh ciphertexts of the context, the levels being numbered from 0
+func (fv *FVContext) MaxLevel() int {
+	return len(fv.levels) - 1
+}
+
+// Level returns the level of the ciphertext, i.e. l for ciphertexts modulo Q_l = q_0 * ... * q_l
+func (fv *FVContext) Level(ct *Ciphertext) (int, error) {
+	for l := range fv.levels {
+		if fv.levels[l].Q.EqualTo(&ct.value[0].Q) {
+			return l, nil
+		}
+	}
+	return 0, polynomial.ErrParamMismatch
+}
+
+// atLevel returns the context of the level of ciphertext modulus q
+func (fv *FVContext) atLevel(q bigint.Int) (*FVContext, error) {
+	for _, level := range fv.levels {
+		if level.Q.EqualTo(&q) {
+			return level, nil
+		}
+	}
+	return nil, polynomial.ErrParamMismatch
+}
+
+// Parameters returns the parameters the context is derived from
+func (fv *FVContext) Parameters() *Parameters {
+	params := NewRNSParameters(fv.N, fv.T, fv.RNSParams.Moduli)
+	params.Sigma = fv.Sigma
+	return params
+}
+
+// generateRNSParams generates the RNS bases Q, made of the primes of the ciphertext modulus, and P
+// used by the homomorphic multiplication.
+// The tensor product of two ciphertexts is bounded by N * Q^2 / 2, and its scaling by t/Q by N * T * Q / 2,
+// so the auxiliary basis P is chosen larger than 2 * N * T * Q.
+func (fv *FVContext) generateRNSParams(qModuli []bigint.Int) error {
+	// the basis Q is the one of the polynomials modulo Q when they hold their residues,
+	// so that the ciphertexts are lifted to it without math/big
+	var err error
+	if fv.RNSParams = fv.NttParams.RNSParams(); fv.RNSParams == nil {
+		if fv.RNSParams, err = polynomial.GenerateRNSParams(fv.N, qModuli); err != nil {
+			return err
+		}
+	}
+
+	// the primes of P have to be distinct from the ones of Q
+	bound := bigint.NewInt(int64(2 * fv.N))
+	bound.Mul(bound, &fv.T)
+	bound.Mul(bound, &fv.Q)
+	count := bound.Value.BitLen() / (auxBitLen - 1) + 1
+	primes, err := polynomial.GenerateNTTPrimes(fv.N, auxBitLen, count + len(qModuli))
+	if err != nil {
+		return err
+	}
+	var moduli []bigint.Int
+	for i := 0; len(moduli) < count; i++ {
+		if !containsModulus(qModuli, &primes[i]) {
+			moduli = append(moduli, primes[i])
+		}
+	}
+	fv.AuxRNSParams, err = polynomial.GenerateRNSParams(fv.N, moduli)
+	if err != nil {
+		return err
+	}
+
+	fv.extenderQP, err = polynomial.NewBasisExtender(fv.RNSParams, fv.AuxRNSParams)
+	if err != nil {
+		return err
+	}
+	fv.extenderPQ, err = polynomial.NewBasisExtender(fv.AuxRNSParams, fv.RNSParams)
+	if err != nil {
+		return err
+	}
+	fv.scaler, err = polynomial.NewScaler(fv.T, fv.RNSParams, fv.AuxRNSParams)
+	return err
+}
+
+// generateSpecialPrime chooses the special prime P of HybridDecomposition,
+// the largest NTT-friendly prime of bigint.ModulusMaxBitLen bits which is not a prime of Q.
+func (fv *FVContext) generateSpecialPrime(qModuli []bigint.Int) error {
+	primes, err := polynomial.GenerateNTTPrimes(fv.N, bigint.ModulusMaxBitLen, len(qModuli) + 1)
+	if err != nil {
+		return err
+	}
+	var p bigint.Int
+	for i := range primes {
+		if !containsModulus(qModuli, &primes[i]) {
+			p.SetBigInt(&primes[i])
+			break
+		}
+	}
+	nttParams, err := polynomial.GenerateNTTParams(fv.N, p)
+	if err != nil {
+		return err
+	}
+	fv.setSpecialPrime(p, nttParams)
+	return nil
+}
+
+// setSpecialPrime sets the special prime P of HybridDecomposition, with its NTT params
+func (fv *FVContext) setSpecialPrime(p bigint.Int, nttParams *polynomial.NttParams) {
+	fv.SpecialP.SetBigInt(&p)
+	fv.specialNttParams = nttParams
+	fv.specialPInv.Inv(&fv.SpecialP, &fv.Q)
+}
+
+// containsModulus checks if q is one of the moduli
+func containsModulus(moduli []bigint.Int, q *bigint.Int) bool {
+	for i := range moduli {
+		if moduli[i].EqualTo(q) {
+			return true
+		}
+	}
+	return false
 }
 
 // center shifts r from [0, q) to (-q/2, q/2]
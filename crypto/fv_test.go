@@ -1,8 +1,16 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"testing"
 	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/polynomial"
+	"github.com/dedis/lago/ring"
 	"io/ioutil"
 	"fmt"
 	"strings"
@@ -21,8 +29,7 @@ func TestFVContext(t *testing.T) {
 			t.Errorf("Error in data read from test_data: len(vs) = %d", len(vs))
 		}
 
-		// load BigQ
-		BigQ := vs[0]
+		// vs[0] holds the former big ciphertext modulus BigQ, which is not used anymore
 
 		// load Q
 		Q := vs[1]
@@ -40,9 +47,15 @@ func TestFVContext(t *testing.T) {
 		}
 
 		// create FV context
-		fv := NewFVContext(uint32(N), *bigint.NewInt(int64(T)), *bigint.NewIntFromString(Q), *bigint.NewIntFromString(BigQ))
+		fv, err := NewFVContextFromParameters(NewParameters(uint32(N), *bigint.NewInt(int64(T)), *bigint.NewIntFromString(Q)))
+		if err != nil {
+			t.Fatalf("Error in NewFVContext: %v", err)
+		}
 		// generate new keys
-		key := GenerateKey(fv)
+		key, err := GenerateKey(fv)
+		if err != nil {
+			t.Fatalf("Error in GenerateKey: %v", err)
+		}
 
 		// load first plaintext
 		plaintext1String := strings.Split(strings.TrimSpace(vs[4]), ", ")
@@ -54,7 +67,7 @@ func TestFVContext(t *testing.T) {
 			}
 			plaintext1Coeffs[i].SetInt(int64(tmp))
 		}
-		plaintext1 := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+		plaintext1, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
 		plaintext1.Value.Poly.SetCoefficients(plaintext1Coeffs)
 
 		// load second plaintext
@@ -67,7 +80,7 @@ func TestFVContext(t *testing.T) {
 			}
 			plaintext2Coeffs[i].SetInt(int64(tmp))
 		}
-		plaintext2 := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+		plaintext2, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
 		plaintext2.Value.Poly.SetCoefficients(plaintext2Coeffs)
 
 		// load add plaintext
@@ -105,11 +118,11 @@ func TestFVContext(t *testing.T) {
 
 		// encrypt
 		encryptor := NewEncryptor(fv, &key.PubKey)
-		ciphertext1 := encryptor.Encrypt(plaintext1)
-		ciphertext2 := encryptor.Encrypt(plaintext2)
+		ciphertext1, _ := encryptor.Encrypt(plaintext1)
+		ciphertext2, _ := encryptor.Encrypt(plaintext2)
 		// decrypt
 		decryptor := NewDecryptor(fv, &key.SecKey)
-		new_plaintext1 := decryptor.Decrypt(ciphertext1)
+		new_plaintext1, _ := decryptor.Decrypt(ciphertext1)
 
 		// test encrypt and decrypt
 		new_msg1 := new_plaintext1.Value.GetCoefficients()
@@ -123,8 +136,8 @@ func TestFVContext(t *testing.T) {
 		evaluator := NewEvaluator(fv, &key.EvaKey, key.EvaSize)
 
 		// add
-		add_cipher := evaluator.Add(ciphertext1, ciphertext2)
-		add_plain := decryptor.Decrypt(add_cipher)
+		add_cipher, _ := evaluator.Add(ciphertext1, ciphertext2)
+		add_plain, _ := decryptor.Decrypt(add_cipher)
 		// test add
 		add_msg := add_plain.Value.GetCoefficients()
 		for i := uint32(0); i < fv.N; i++ {
@@ -134,8 +147,8 @@ func TestFVContext(t *testing.T) {
 		}
 
 		// sub
-		sub_cipher := evaluator.Sub(ciphertext1, ciphertext2)
-		sub_plain := decryptor.Decrypt(sub_cipher)
+		sub_cipher, _ := evaluator.Sub(ciphertext1, ciphertext2)
+		sub_plain, _ := decryptor.Decrypt(sub_cipher)
 		// test sub
 		sub_msg := sub_plain.Value.GetCoefficients()
 		for i := uint32(0); i < fv.N; i++ {
@@ -145,8 +158,8 @@ func TestFVContext(t *testing.T) {
 		}
 
 		// multiply
-		multiply_cipher := evaluator.Multiply(ciphertext1, ciphertext2)
-		multiply_plain := decryptor.Decrypt(multiply_cipher)
+		multiply_cipher, _ := evaluator.Multiply(ciphertext1, ciphertext2)
+		multiply_plain, _ := decryptor.Decrypt(multiply_cipher)
 		// test multiply
 		multiply_msg := multiply_plain.Value.GetCoefficients()
 		for i := uint32(0); i < fv.N; i++ {
@@ -157,15 +170,1089 @@ func TestFVContext(t *testing.T) {
 	}
 }
 
+// Test that parameter mistakes are reported as errors
+func TestFVContextErrors(t *testing.T) {
+	if _, err := NewFVContext(100, *bigint.NewInt(10), *bigint.NewInt(8380417), *bigint.NewInt(0)); !errors.Is(err, polynomial.ErrBadDegree) {
+		t.Errorf("Error in NewFVContext: expected %v, got %v", polynomial.ErrBadDegree, err)
+	}
+	if _, err := NewFVContext(32, *bigint.NewInt(10), *bigint.NewInt(8380419), *bigint.NewInt(0)); !errors.Is(err, polynomial.ErrModulusNotNTTFriendly) {
+		t.Errorf("Error in NewFVContext: expected %v, got %v", polynomial.ErrModulusNotNTTFriendly, err)
+	}
+	// the deprecated BigQ is still checked against Q
+	bigQ := bigint.NewIntFromString("4611686018326724609")
+	if _, err := NewFVContext(32, *bigint.NewInt(10), *bigint.NewInt(8380417), *bigQ); err != nil {
+		t.Errorf("Error in NewFVContext: %v", err)
+	}
+	if _, err := NewFVContext(32, *bigint.NewInt(10), *bigint.NewInt(8380417), *bigint.NewInt(0)); err == nil {
+		t.Errorf("Error in NewFVContext: BigQ smaller than Q^2 should be rejected")
+	}
+	if _, err := NewFVContext(32, *bigint.NewInt(10), *bigint.NewInt(8380417), *new(bigint.Int).Add(bigQ, bigint.NewInt(2))); !errors.Is(err, polynomial.ErrModulusNotNTTFriendly) {
+		t.Errorf("Error in NewFVContext: expected %v, got %v", polynomial.ErrModulusNotNTTFriendly, err)
+	}
+
+	// ciphertexts of different contexts cannot be combined
+	fv1, _ := NewFVContextFromParameters(NewParameters(32, *bigint.NewInt(10), *bigint.NewInt(8380417)))
+	fv2, _ := NewFVContextFromParameters(NewParameters(64, *bigint.NewInt(10), *bigint.NewInt(8380417)))
+	key1, _ := GenerateKey(fv1)
+	key2, _ := GenerateKey(fv2)
+	plaintext1, _ := NewPlaintext(fv1.N, fv1.Q, fv1.NttParams)
+	plaintext2, _ := NewPlaintext(fv2.N, fv2.Q, fv2.NttParams)
+	if _, err := NewEncryptor(fv1, &key1.PubKey).Encrypt(plaintext2); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Encrypt: expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+	ciphertext1, _ := NewEncryptor(fv1, &key1.PubKey).Encrypt(plaintext1)
+	ciphertext2, _ := NewEncryptor(fv2, &key2.PubKey).Encrypt(plaintext2)
+	evaluator := NewEvaluator(fv1, &key1.EvaKey, key1.EvaSize)
+	if _, err := evaluator.Add(ciphertext1, ciphertext2); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Add: expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+	if _, err := evaluator.Multiply(ciphertext1, ciphertext2); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Multiply: expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+}
+
+// Test that ciphertexts, plaintexts and keys survive a binary round trip,
+// and that data of another context is rejected
+func TestSerialization(t *testing.T) {
+	fv, _ := NewFVContextFromParameters(NewParameters(32, *bigint.NewInt(10), *bigint.NewInt(8380417)))
+	key, _ := GenerateKey(fv)
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	coeffs := make([]bigint.Int, fv.N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i) % 10)
+	}
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+	ciphertext, _ := NewEncryptor(fv, &key.PubKey).Encrypt(plaintext)
+
+	// key round trip
+	data, err := fv.Marshal(key)
+	if err != nil {
+		t.Fatalf("Error in Marshal(Key): %v", err)
+	}
+	newKey, _ := NewKey(fv.N, fv.Q, fv.NttParams, 1)
+	if err = fv.Unmarshal(data, newKey); err != nil {
+		t.Fatalf("Error in Unmarshal(Key): %v", err)
+	}
+	if newKey.EvaSize != key.EvaSize || len(newKey.EvaKey) != len(key.EvaKey) {
+		t.Errorf("Error in Unmarshal(Key): expected EvaSize %v, got %v", key.EvaSize, newKey.EvaSize)
+	}
+	// a key is left unchanged by invalid data, even if it is only invalid at the end
+	before, _ := fv.Marshal(newKey)
+	if err = fv.Unmarshal(data[:len(data) - 1], newKey); err == nil {
+		t.Errorf("Error in Unmarshal(Key): truncated data should be rejected")
+	}
+	if after, _ := fv.Marshal(newKey); !bytes.Equal(before, after) {
+		t.Errorf("Error in Unmarshal(Key): invalid data modified the key")
+	}
+
+	// ciphertext round trip, decrypted with the decoded key
+	data, err = fv.Marshal(ciphertext)
+	if err != nil {
+		t.Fatalf("Error in Marshal(Ciphertext): %v", err)
+	}
+	newCiphertext, _ := NewCiphertext(fv.N, fv.Q, fv.NttParams)
+	if err = fv.Unmarshal(data, newCiphertext); err != nil {
+		t.Fatalf("Error in Unmarshal(Ciphertext): %v", err)
+	}
+	evaluator := NewEvaluator(fv, &newKey.EvaKey, newKey.EvaSize)
+	square, _ := evaluator.Multiply(newCiphertext, newCiphertext)
+	decryptor := NewDecryptor(fv, &newKey.SecKey)
+	newPlaintext, _ := decryptor.Decrypt(newCiphertext)
+	squarePlaintext, _ := decryptor.Decrypt(square)
+	msg := newPlaintext.Value.GetCoefficients()
+	for i := range coeffs {
+		if !msg[i].EqualTo(&coeffs[i]) {
+			t.Errorf("Error in serialization, expected %v, got %v", coeffs[i].Int64(), msg[i].Int64())
+		}
+	}
+	// the decoded evaluation key relinearizes as the original one
+	want, _ := NewEvaluator(fv, &key.EvaKey, key.EvaSize).Multiply(ciphertext, ciphertext)
+	wantPlaintext, _ := NewDecryptor(fv, &key.SecKey).Decrypt(want)
+	msg = squarePlaintext.Value.GetCoefficients()
+	wantMsg := wantPlaintext.Value.GetCoefficients()
+	for i := range wantMsg {
+		if !msg[i].EqualTo(&wantMsg[i]) {
+			t.Errorf("Error in EvaluationKey serialization, expected %v, got %v", wantMsg[i].Int64(), msg[i].Int64())
+		}
+	}
+
+	// plaintext round trip
+	data, _ = fv.Marshal(plaintext)
+	newPlaintext, _ = NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	if err = fv.Unmarshal(data, newPlaintext); err != nil {
+		t.Fatalf("Error in Unmarshal(Plaintext): %v", err)
+	}
+	msg = newPlaintext.Value.GetCoefficients()
+	for i := range coeffs {
+		if !msg[i].EqualTo(&coeffs[i]) {
+			t.Errorf("Error in Plaintext serialization, expected %v, got %v", coeffs[i].Int64(), msg[i].Int64())
+		}
+	}
+
+	// corrupted data is rejected
+	data, _ = fv.Marshal(ciphertext)
+	if err = fv.Unmarshal(data[:len(data) - 1], newCiphertext); err == nil {
+		t.Errorf("Error in Unmarshal(Ciphertext): truncated data should be rejected")
+	}
+	data[0] = serializationVersion + 1
+	if err = fv.Unmarshal(data, newCiphertext); err == nil {
+		t.Errorf("Error in Unmarshal(Ciphertext): unknown version should be rejected")
+	}
+	data, _ = fv.Marshal(&key.SecKey)
+	if err = fv.Unmarshal(data, newCiphertext); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("Error in Unmarshal(Ciphertext): expected %v, got %v", ErrInvalidEncoding, err)
+	}
+
+	// data of another context is rejected
+	fv2, _ := NewFVContextFromParameters(NewParameters(64, *bigint.NewInt(10), *bigint.NewInt(8380417)))
+	ciphertext2, _ := NewCiphertext(fv2.N, fv2.Q, fv2.NttParams)
+	data, _ = fv.Marshal(ciphertext)
+	if err = fv2.Unmarshal(data, ciphertext2); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Unmarshal(Ciphertext): expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+	if _, err = fv.Marshal(ciphertext2); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Marshal(Ciphertext) of another context: expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+	pk2, _ := NewPublicKey(fv2.N, fv2.Q, fv2.NttParams)
+	data, _ = fv.Marshal(&key.PubKey)
+	if err = fv2.Unmarshal(data, pk2); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Unmarshal(PublicKey): expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+	evk2, _ := NewEvaluationKey(fv2.N, fv2.Q, fv2.NttParams, key.EvaSize)
+	data, _ = fv.Marshal(&key.EvaKey)
+	if err = fv2.Unmarshal(data, evk2); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Unmarshal(EvaluationKey): expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+
+	// data of a context with the same degree and ciphertext modulus but another plaintext modulus is rejected
+	fv3, _ := NewFVContextFromParameters(NewParameters(32, *bigint.NewInt(17), *bigint.NewInt(8380417)))
+	ciphertext3, _ := NewCiphertext(fv3.N, fv3.Q, fv3.NttParams)
+	data, _ = fv.Marshal(ciphertext)
+	if err = fv3.Unmarshal(data, ciphertext3); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Unmarshal(Ciphertext) with another T: expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+	key3, _ := GenerateKey(fv3)
+	data, _ = fv.Marshal(key)
+	if err = fv3.Unmarshal(data, key3); !errors.Is(err, polynomial.ErrParamMismatch) {
+		t.Errorf("Error in Unmarshal(Key) with another T: expected %v, got %v", polynomial.ErrParamMismatch, err)
+	}
+}
+
+// Test that parameters survive JSON and binary round trips with the same ID,
+// and that contexts rebuilt from them are interchangeable
+func TestParameters(t *testing.T) {
+	id := func(p *Parameters) string {
+		s, err := p.ID()
+		if err != nil {
+			t.Fatalf("Error in Parameters.ID: %v", err)
+		}
+		return s
+	}
+	params := NewParameters(32, *bigint.NewInt(10), *bigint.NewInt(8380417))
+	jsonData, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("Error in Parameters.MarshalJSON: %v", err)
+	}
+	fromJSON := new(Parameters)
+	if err = json.Unmarshal(jsonData, fromJSON); err != nil {
+		t.Fatalf("Error in Parameters.UnmarshalJSON: %v", err)
+	}
+	binData, err := params.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Error in Parameters.MarshalBinary: %v", err)
+	}
+	fromBinary := new(Parameters)
+	if err = fromBinary.UnmarshalBinary(binData); err != nil {
+		t.Fatalf("Error in Parameters.UnmarshalBinary: %v", err)
+	}
+	for _, p := range []*Parameters{fromJSON, fromBinary} {
+		if !p.Equal(params) || id(p) != id(params) {
+			t.Errorf("Error in Parameters round trip, expected %v, got %v", id(params), id(p))
+		}
+	}
+	if err = fromBinary.UnmarshalBinary(binData[:len(binData) - 1]); err == nil {
+		t.Errorf("Error in Parameters.UnmarshalBinary: truncated data should be rejected")
+	}
+	// parameters with a product of primes as ciphertext modulus
+	moduli, _ := polynomial.GenerateNTTPrimes(32, 30, 2)
+	rnsParams := NewRNSParameters(32, *bigint.NewInt(10), moduli)
+	rnsJSON, _ := json.Marshal(rnsParams)
+	rnsBinary, _ := rnsParams.MarshalBinary()
+	rnsFromJSON, rnsFromBinary := new(Parameters), new(Parameters)
+	if err = json.Unmarshal(rnsJSON, rnsFromJSON); err != nil || !rnsFromJSON.Equal(rnsParams) {
+		t.Errorf("Error in Parameters JSON round trip with moduli %v: %v", moduli, err)
+	}
+	if err = rnsFromBinary.UnmarshalBinary(rnsBinary); err != nil || !rnsFromBinary.Equal(rnsParams) {
+		t.Errorf("Error in Parameters binary round trip with moduli %v: %v", moduli, err)
+	}
+	if id(rnsParams) == id(params) {
+		t.Errorf("Error in Parameters.ID: different parameters have the same ID %v", id(params))
+	}
+	rnsFromJSON.Q.SetInt(8380417)
+	if _, err = NewFVContextFromParameters(rnsFromJSON); err == nil {
+		t.Errorf("Error in NewFVContextFromParameters: Q different from the product of the moduli should be rejected")
+	}
+
+	// a JSON object with a single modulus disagrees with its prime ciphertext modulus
+	single := []byte(`{"n":32,"t":"10","q":"8380417","moduli":["8380417"],"sigma":3.19}`)
+	if err = json.Unmarshal(single, new(Parameters)); err == nil {
+		t.Errorf("Error in Parameters.UnmarshalJSON: a single modulus should be rejected")
+	}
+	mismatch := fmt.Sprintf(`{"n":32,"t":"10","q":"8380417","moduli":["%v","%v"],"sigma":3.19}`,
+		moduli[0].Value.String(), moduli[1].Value.String())
+	if err = json.Unmarshal([]byte(mismatch), new(Parameters)); err == nil {
+		t.Errorf("Error in Parameters.UnmarshalJSON: Q different from the product of the moduli should be rejected")
+	}
+	// parameters that cannot be encoded have no hash
+	negative := NewParameters(32, *bigint.NewInt(-10), *bigint.NewInt(8380417))
+	if _, err = negative.Hash(); err == nil {
+		t.Errorf("Error in Parameters.Hash: negative plaintext modulus should be rejected")
+	}
+
+	other := NewParameters(32, *bigint.NewInt(11), *bigint.NewInt(8380417))
+	if other.Equal(params) || id(other) == id(params) {
+		t.Errorf("Error in Parameters.ID: different parameters have the same ID %v", id(params))
+	}
+
+	// a ciphertext of one context is decrypted in a context rebuilt from the same parameters
+	fv1, err := NewFVContextFromParameters(params)
+	if err != nil {
+		t.Fatalf("Error in NewFVContextFromParameters: %v", err)
+	}
+	fv2, err := NewFVContextFromParameters(fromJSON)
+	if err != nil {
+		t.Fatalf("Error in NewFVContextFromParameters: %v", err)
+	}
+	if id(fv2.Parameters()) != id(params) {
+		t.Errorf("Error in FVContext.Parameters, expected %v, got %v", id(params), id(fv2.Parameters()))
+	}
+	key, _ := GenerateKey(fv1)
+	plaintext, _ := NewPlaintext(fv1.N, fv1.Q, fv1.NttParams)
+	coeffs := make([]bigint.Int, fv1.N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i) % 10)
+	}
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+	ciphertext1, _ := NewEncryptor(fv1, &key.PubKey).Encrypt(plaintext)
+	ciphertext2, _ := NewEvaluator(fv2, &key.EvaKey, key.EvaSize).Multiply(ciphertext1, ciphertext1)
+	want, _ := NewEvaluator(fv1, &key.EvaKey, key.EvaSize).Multiply(ciphertext1, ciphertext1)
+	msg, _ := NewDecryptor(fv2, &key.SecKey).Decrypt(ciphertext2)
+	wantMsg, _ := NewDecryptor(fv1, &key.SecKey).Decrypt(want)
+	got, expected := msg.Value.GetCoefficients(), wantMsg.Value.GetCoefficients()
+	for i := range expected {
+		if !got[i].EqualTo(&expected[i]) {
+			t.Errorf("Error in rebuilt context, expected %v, got %v", expected[i].Int64(), got[i].Int64())
+		}
+	}
+
+	params.Sigma = 0
+	if _, err = NewFVContextFromParameters(params); err == nil {
+		t.Errorf("Error in NewFVContextFromParameters: sigma = 0 should be rejected")
+	}
+}
+
+// Test the presets and the security validation of custom parameters
+func TestSecurity(t *testing.T) {
+	for _, preset := range Presets() {
+		params, err := preset.Parameters()
+		if err != nil {
+			t.Fatalf("Error in Preset.Parameters(%v): %v", preset, err)
+		}
+		if err = ValidateSecurity(params, Security128); err != nil {
+			t.Errorf("Error in preset %v: %v", preset, err)
+		}
+		// Q is as large as the standard allows, up to the rounding of the bit lengths of its primes
+		logQ, _ := MaxLogQ(params.N, Security128)
+		if bitLen := params.Q.Value.BitLen(); bitLen < logQ - len(params.QModuli()) {
+			t.Errorf("Error in preset %v: log Q = %d, expected about %d", preset, bitLen, logQ)
+		}
+	}
+
+	// the smallest preset gives a working context
+	params, _ := PN2048.Parameters()
+	fv, err := NewFVContextWithSecurity(params, Security128)
+	if err != nil {
+		t.Fatalf("Error in NewFVContextWithSecurity: %v", err)
+	}
+	key, _ := GenerateKey(fv)
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	coeffs := make([]bigint.Int, fv.N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i) * 31 % presetT)
+	}
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+	ciphertext, _ := NewEncryptor(fv, &key.PubKey).Encrypt(plaintext)
+	newPlaintext, _ := NewDecryptor(fv, &key.SecKey).Decrypt(ciphertext)
+	msg := newPlaintext.Value.GetCoefficients()
+	for i := range coeffs {
+		if !msg[i].EqualTo(&coeffs[i]) {
+			t.Fatalf("Error in enc/dec with preset, expected %v, got %v", coeffs[i].Int64(), msg[i].Int64())
+		}
+	}
+
+	// a preset with a product of primes as Q has room for a multiplication
+	params, _ = PN4096.Parameters()
+	fv, err = NewFVContextWithSecurity(params, Security128)
+	if err != nil {
+		t.Fatalf("Error in NewFVContextWithSecurity(%v): %v", PN4096, err)
+	}
+	key, _ = GenerateKeyWithDecomposition(fv, RNSDecomposition, 0)
+	plaintext, _ = NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	coeffs = make([]bigint.Int, fv.N)
+	coeffs[0].SetInt(3)
+	coeffs[1].SetInt(5)
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+	ciphertext, _ = NewEncryptor(fv, &key.PubKey).Encrypt(plaintext)
+	evaluator := NewEvaluatorWithKey(fv, key.RelinearizationKey())
+	ciphertext, err = evaluator.Multiply(ciphertext, ciphertext)
+	if err != nil {
+		t.Fatalf("Error in Multiply with preset %v: %v", PN4096, err)
+	}
+	decryptor := NewDecryptor(fv, &key.SecKey)
+	if budget, _ := decryptor.InvariantNoiseBudget(ciphertext); budget <= 0 {
+		t.Errorf("Error in Multiply with preset %v: no noise budget left", PN4096)
+	}
+	newPlaintext, _ = decryptor.Decrypt(ciphertext)
+	msg = newPlaintext.Value.GetCoefficients()
+	// (3 + 5x)^2 = 9 + 30x + 25x^2
+	for i, want := range []int64{9, 30, 25, 0} {
+		if msg[i].Int64() != want {
+			t.Errorf("Error in Multiply with preset %v: index %v, expected %v, got %v", PN4096, i, want, msg[i].Int64())
+		}
+	}
+
+	// custom parameters
+	insecure := []*Parameters{
+		NewParameters(32, *bigint.NewInt(10), *bigint.NewInt(8380417)),
+		NewParameters(2048, *bigint.NewInt(10), *new(bigint.Int).Lsh(bigint.NewInt(1), 60)),
+		NewParameters(2048, *bigint.NewInt(10), *bigint.NewInt(8380417)),
+	}
+	insecure[2].Sigma = 1
+	for i, params := range insecure {
+		if err := ValidateSecurity(params, Security128); !errors.Is(err, ErrInsecureParameters) {
+			t.Errorf("Error in ValidateSecurity test %v: expected %v, got %v", i, ErrInsecureParameters, err)
+		}
+		if _, err := NewFVContextWithSecurity(params, Security128); !errors.Is(err, ErrInsecureParameters) {
+			t.Errorf("Error in NewFVContextWithSecurity test %v: expected %v, got %v", i, ErrInsecureParameters, err)
+		}
+	}
+	if level := EstimateSecurity(NewParameters(2048, *bigint.NewInt(10), *bigint.NewInt(8380417))); level != Security256 {
+		t.Errorf("Error in EstimateSecurity, expected %v, got %v", Security256, level)
+	}
+	if level := EstimateSecurity(insecure[1]); level != 0 {
+		t.Errorf("Error in EstimateSecurity, expected 0, got %v", level)
+	}
+}
+
+// Test the secret key rotation with both decompositions, in a context whose ciphertext modulus is a product of primes
+func TestKeySwitch(t *testing.T) {
+	N := uint32(16)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fv, err := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(10), moduli))
+	if err != nil {
+		t.Fatalf("Error in NewFVContextFromParameters: %v", err)
+	}
+	key1, _ := GenerateKey(fv)
+	key2, _ := GenerateKey(fv)
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	coeffs := make([]bigint.Int, fv.N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 7 % 10))
+	}
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+	ciphertext, _ := encryptMasked(fv, key1, plaintext)
+	evaluator := NewEvaluator(fv, &key1.EvaKey, key1.EvaSize)
+
+	// the product of two ciphertexts is relinearized with the evaluation key
+	square, err := evaluator.Multiply(ciphertext, ciphertext)
+	if err != nil {
+		t.Fatalf("Error in Multiply: %v", err)
+	}
+	squarePlaintext, _ := NewDecryptor(fv, &key1.SecKey).Decrypt(square)
+	want := negacyclicProduct(coeffs, coeffs, 10)
+	for i, c := range squarePlaintext.Value.GetCoefficients() {
+		if c.Int64() != want[i] {
+			t.Fatalf("Error in Multiply with RNS modulus, expected %v, got %v", want[i], c.Int64())
+		}
+	}
+
+	for _, decomposition := range []Decomposition{BitDecomposition, RNSDecomposition, HybridDecomposition} {
+		ksk, err := GenerateSwitchingKey(fv, &key1.SecKey, &key2.SecKey, decomposition, 8)
+		if err != nil {
+			t.Fatalf("Error in GenerateSwitchingKey(%v): %v", decomposition, err)
+		}
+		switched, err := evaluator.KeySwitch(ciphertext, ksk)
+		if err != nil {
+			t.Fatalf("Error in KeySwitch(%v): %v", decomposition, err)
+		}
+		result, _ := NewDecryptor(fv, &key2.SecKey).Decrypt(switched)
+		for i, c := range result.Value.GetCoefficients() {
+			if !c.EqualTo(&coeffs[i]) {
+				t.Fatalf("Error in KeySwitch(%v), expected %v, got %v", decomposition, coeffs[i].Int64(), c.Int64())
+			}
+		}
+	}
+
+	// the RNS decomposition needs several primes
+	fv, _ = NewFVContextFromParameters(NewParameters(N, *bigint.NewInt(10), *bigint.NewInt(8380417)))
+	key1, _ = GenerateKey(fv)
+	if _, err = GenerateSwitchingKey(fv, &key1.SecKey, &key1.SecKey, RNSDecomposition, 0); err == nil {
+		t.Errorf("Error in GenerateSwitchingKey: RNS decomposition of a prime modulus should be rejected")
+	}
+}
+
+// encryptMasked encrypts plaintext with the public key of key, and adds an encryption of zero (-a * s, a)
+// with the secret key, so that the second component of the ciphertext is uniform as well
+func encryptMasked(fv *FVContext, key *Key, plaintext *Plaintext) (*Ciphertext, error) {
+	ciphertext, err := NewEncryptor(fv, &key.PubKey).Encrypt(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	a, err := ring.NewUniformPoly(rand.Reader, fv.N, fv.Q, fv.NttParams, fv.Q)
+	if err != nil {
+		return nil, err
+	}
+	a.Poly.NTT()
+	as, _ := ring.NewRing(fv.N, fv.Q, fv.NttParams)
+	as.MulCoeffs(a, key.SecKey.Value)
+	ciphertext.value[0].Sub(ciphertext.value[0], as)
+	ciphertext.value[1].Add(ciphertext.value[1], a)
+	return ciphertext, nil
+}
+
+// negacyclicProduct returns the product of the polynomials of coefficients a and b mod X^N + 1 and t, in [0, t)
+func negacyclicProduct(a, b []bigint.Int, t int64) []int64 {
+	n := len(a)
+	product := make([]int64, n)
+	for i := range a {
+		for j := range b {
+			x := a[i].Int64() * b[j].Int64() % t
+			if k := i + j; k < n {
+				product[k] += x
+			} else {
+				product[k - n] -= x
+			}
+		}
+	}
+	for i := range product {
+		product[i] = (product[i] % t + t) % t
+	}
+	return product
+}
+
+// TestRelinearization checks that the keys of each decomposition relinearize products and survive a binary round trip
+func TestRelinearization(t *testing.T) {
+	N := uint32(16)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fvRNS, _ := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(10), moduli))
+	fvPrime, _ := NewFVContextFromParameters(NewParameters(N, *bigint.NewInt(10), *bigint.NewInt(8380417)))
+	coeffs := make([]bigint.Int, N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 3 % 10))
+	}
+	want := negacyclicProduct(coeffs, coeffs, 10)
+
+	testCases := []struct {
+		fv *FVContext
+		decomposition Decomposition
+		base uint32
+	}{
+		{fvPrime, BitDecomposition, 8},
+		{fvPrime, HybridDecomposition, 0},
+		{fvRNS, BitDecomposition, 30},
+		{fvRNS, RNSDecomposition, 0},
+		{fvRNS, HybridDecomposition, 0},
+	}
+	for _, tc := range testCases {
+		fv := tc.fv
+		key, err := GenerateKeyWithDecomposition(fv, tc.decomposition, tc.base)
+		if err != nil {
+			t.Fatalf("Error in GenerateKeyWithDecomposition(%v, %v): %v", tc.decomposition, tc.base, err)
+		}
+		if tc.decomposition == BitDecomposition && len(key.EvaKey) != decompositionLength(fv.Q, tc.base) {
+			t.Errorf("Error in GenerateKeyWithDecomposition(%v, %v): evaluation key of %v components",
+				tc.decomposition, tc.base, len(key.EvaKey))
+		}
+		if tc.decomposition == HybridDecomposition && len(key.EvaKey) != len(fv.RNSParams.Moduli) {
+			t.Errorf("Error in GenerateKeyWithDecomposition(%v): evaluation key of %v components, expected %v",
+				tc.decomposition, len(key.EvaKey), len(fv.RNSParams.Moduli))
+		}
+
+		// the key is decoded with its decomposition
+		data, err := fv.Marshal(key)
+		if err != nil {
+			t.Fatalf("Error in Marshal(Key, %v): %v", tc.decomposition, err)
+		}
+		decoded, _ := NewKey(fv.N, fv.Q, fv.NttParams, 1)
+		if err = fv.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("Error in Unmarshal(Key, %v): %v", tc.decomposition, err)
+		}
+		if decoded.EvaDecomposition != tc.decomposition || len(decoded.EvaKeyP) != len(key.EvaKeyP) {
+			t.Errorf("Error in Unmarshal(Key, %v): decoded decomposition %v", tc.decomposition, decoded.EvaDecomposition)
+		}
+		if tc.decomposition != BitDecomposition {
+			// the number of pairs follows the header and two uint32, and is the number of primes of Q
+			tampered := append([]byte(nil), data...)
+			binary.BigEndian.PutUint32(tampered[headerSize + 8:], uint32(len(key.EvaKey) + 1))
+			if err = fv.Unmarshal(tampered, decoded); !errors.Is(err, ErrInvalidEncoding) {
+				t.Errorf("Error in Unmarshal(Key, %v): wrong number of pairs, expected %v, got %v",
+					tc.decomposition, ErrInvalidEncoding, err)
+			}
+		}
+		if tc.decomposition == HybridDecomposition {
+			// the special prime follows the header and the three uint32 of the key, prefixed by its byte length
+			offset := headerSize + 12
+			size := int(binary.BigEndian.Uint32(data[offset:]))
+			tampered := append([]byte(nil), data...)
+			tampered[offset + 4 + size - 1] ^= 2
+			if err = fv.Unmarshal(tampered, decoded); !errors.Is(err, polynomial.ErrParamMismatch) {
+				t.Errorf("Error in Unmarshal(Key): another special prime, expected %v, got %v", polynomial.ErrParamMismatch, err)
+			}
+			tampered = append([]byte(nil), data...)
+			binary.BigEndian.PutUint32(tampered[offset:], 1 << 20)
+			if err = fv.Unmarshal(tampered, decoded); !errors.Is(err, ErrInvalidEncoding) {
+				t.Errorf("Error in Unmarshal(Key): oversized special prime, expected %v, got %v", ErrInvalidEncoding, err)
+			}
+		}
+
+		plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+		plaintext.Value.Poly.SetCoefficients(coeffs)
+		ciphertext, _ := encryptMasked(fv, decoded, plaintext)
+		square, err := NewEvaluatorWithKey(fv, decoded.RelinearizationKey()).Multiply(ciphertext, ciphertext)
+		if err != nil {
+			t.Fatalf("Error in Multiply(%v): %v", tc.decomposition, err)
+		}
+		result, _ := NewDecryptor(fv, &key.SecKey).Decrypt(square)
+		for i, c := range result.Value.GetCoefficients() {
+			if c.Int64() != want[i] {
+				t.Fatalf("Error in Multiply(%v, %v), expected %v, got %v", tc.decomposition, tc.base, want[i], c.Int64())
+			}
+		}
+	}
+
+	// a larger base gives a smaller evaluation key
+	key1, _ := GenerateKeyWithDecomposition(fvPrime, BitDecomposition, 1)
+	key8, _ := GenerateKeyWithDecomposition(fvPrime, BitDecomposition, 8)
+	if len(key8.EvaKey) >= len(key1.EvaKey) {
+		t.Errorf("Error in GenerateKeyWithDecomposition: %v components in base 2^8, %v in base 2",
+			len(key8.EvaKey), len(key1.EvaKey))
+	}
+	if _, err := GenerateKeyWithDecomposition(fvPrime, BitDecomposition, 0); err == nil {
+		t.Errorf("Error in GenerateKeyWithDecomposition: zero base should be rejected")
+	}
+}
+
+// TestPlainArithmetic checks the operations between ciphertexts and plaintexts or scalars
+func TestPlainArithmetic(t *testing.T) {
+	N := uint32(16)
+	T := int64(97)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fv, _ := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(T), moduli))
+	key, _ := GenerateKey(fv)
+	evaluator := NewEvaluator(fv, &key.EvaKey, key.EvaSize)
+	decryptor := NewDecryptor(fv, &key.SecKey)
+
+	coeffs1 := make([]bigint.Int, N)
+	coeffs2 := make([]bigint.Int, N)
+	for i := range coeffs1 {
+		coeffs1[i].SetInt(int64(i * 13 + 5) % T)
+		coeffs2[i].SetInt(int64(i * 29 + 70) % T)
+	}
+	plaintext1, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext1.Value.Poly.SetCoefficients(coeffs1)
+	plaintext2, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext2.Value.Poly.SetCoefficients(coeffs2)
+	ciphertext, _ := NewEncryptor(fv, &key.PubKey).Encrypt(plaintext1)
+
+	check := func(name string, ct *Ciphertext, err error, want func(i int) int64) {
+		if err != nil {
+			t.Fatalf("Error in %v: %v", name, err)
+		}
+		result, _ := decryptor.Decrypt(ct)
+		for i, c := range result.Value.GetCoefficients() {
+			if w := (want(i) % T + T) % T; c.Int64() != w {
+				t.Fatalf("Error in %v, expected %v, got %v", name, w, c.Int64())
+			}
+		}
+	}
+	ct, err := evaluator.AddPlain(ciphertext, plaintext2)
+	check("AddPlain", ct, err, func(i int) int64 { return coeffs1[i].Int64() + coeffs2[i].Int64() })
+	ct, err = evaluator.SubPlain(ciphertext, plaintext2)
+	check("SubPlain", ct, err, func(i int) int64 { return coeffs1[i].Int64() - coeffs2[i].Int64() })
+	product := negacyclicProduct(coeffs1, coeffs2, T)
+	ct, err = evaluator.MulPlain(ciphertext, plaintext2)
+	check("MulPlain", ct, err, func(i int) int64 { return product[i] })
+	ct, err = evaluator.MulScalar(ciphertext, *bigint.NewInt(-3))
+	check("MulScalar", ct, err, func(i int) int64 { return -3 * coeffs1[i].Int64() })
+	ct, err = evaluator.MulScalar(ciphertext, *bigint.NewInt(1000))
+	check("MulScalar", ct, err, func(i int) int64 { return 1000 * coeffs1[i].Int64() })
+	ct, err = evaluator.Negate(ciphertext)
+	check("Negate", ct, err, func(i int) int64 { return -coeffs1[i].Int64() })
+
+	// the plaintext can be in NTT form, and its coefficients are taken mod T
+	plaintext2.Value.Poly.NTT()
+	ct, err = evaluator.AddPlain(ciphertext, plaintext2)
+	check("AddPlain with a plaintext in NTT form", ct, err, func(i int) int64 { return coeffs1[i].Int64() + coeffs2[i].Int64() })
+	for i := range coeffs2 {
+		coeffs2[i].SetInt(coeffs2[i].Int64() + 5 * T)
+	}
+	plaintext2.Value.Poly.InverseNTT()
+	plaintext2.Value.Poly.SetCoefficients(coeffs2)
+	ct, err = evaluator.MulPlain(ciphertext, plaintext2)
+	check("MulPlain with coefficients larger than T", ct, err, func(i int) int64 { return product[i] })
+}
+
+// TestNoiseBudget checks that the noise budget decreases with the operations and bounds its estimate
+func TestNoiseBudget(t *testing.T) {
+	N := uint32(16)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fv, _ := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(97), moduli))
+	key, _ := GenerateKeyWithDecomposition(fv, HybridDecomposition, 0)
+	evaluator := NewEvaluatorWithKey(fv, key.RelinearizationKey())
+	decryptor := NewDecryptor(fv, &key.SecKey)
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	coeffs := make([]bigint.Int, N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 11 % 97))
+	}
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+	ciphertext, _ := NewEncryptor(fv, &key.PubKey).Encrypt(plaintext)
+
+	// the estimated budget never exceeds the measured one
+	checkBudget := func(name string, ct *Ciphertext) int {
+		budget, err := decryptor.InvariantNoiseBudget(ct)
+		if err != nil {
+			t.Fatalf("Error in InvariantNoiseBudget after %v: %v", name, err)
+		}
+		estimate, ok := ct.NoiseBudgetEstimate()
+		if !ok {
+			t.Fatalf("Error in NoiseBudgetEstimate after %v: unknown noise", name)
+		}
+		if estimate > budget {
+			t.Errorf("Error in NoiseBudgetEstimate after %v: estimated %v bits, measured %v", name, estimate, budget)
+		}
+		return budget
+	}
+	budget := checkBudget("Encrypt", ciphertext)
+	if budget == 0 {
+		t.Fatalf("Error in InvariantNoiseBudget: fresh ciphertext without budget")
+	}
+	sum, _ := evaluator.Add(ciphertext, ciphertext)
+	checkBudget("Add", sum)
+	ct, _ := evaluator.MulPlain(ciphertext, plaintext)
+	checkBudget("MulPlain", ct)
+	ct, _ = evaluator.MulScalar(ciphertext, *bigint.NewInt(-5))
+	checkBudget("MulScalar", ct)
+
+	// the budget decreases with each multiplication, until the ciphertext cannot be decrypted
+	ct = ciphertext
+	for budget > 0 {
+		ct, _ = evaluator.Multiply(ct, ct)
+		newBudget := checkBudget("Multiply", ct)
+		if newBudget >= budget {
+			t.Fatalf("Error in InvariantNoiseBudget: %v bits after Multiply, %v before", newBudget, budget)
+		}
+		budget = newBudget
+	}
+
+	// the noise of decoded ciphertexts is unknown
+	data, _ := fv.Marshal(ciphertext)
+	decoded, _ := NewCiphertext(fv.N, fv.Q, fv.NttParams)
+	fv.Unmarshal(data, decoded)
+	if _, ok := decoded.NoiseBudgetEstimate(); ok {
+		t.Errorf("Error in NoiseBudgetEstimate: noise of a decoded ciphertext should be unknown")
+	}
+	ct, _ = evaluator.Add(decoded, ciphertext)
+	if _, ok := ct.NoiseBudgetEstimate(); ok {
+		t.Errorf("Error in NoiseBudgetEstimate: noise of the sum with a decoded ciphertext should be unknown")
+	}
+}
+
+// TestModSwitch checks that ModSwitch keeps the message while dropping the levels of the modulus chain
+func TestModSwitch(t *testing.T) {
+	N := uint32(16)
+	T := int64(97)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fv, _ := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(T), moduli))
+	if fv.MaxLevel() != 2 || len(fv.Chain) != 3 || fv.Chain[2] != fv.NttParams {
+		t.Fatalf("Error in NewFVContextFromParameters: %v levels, expected 3", fv.MaxLevel() + 1)
+	}
+	coeffs := make([]bigint.Int, N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 17 + 3) % T)
+	}
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+	want := negacyclicProduct(coeffs, coeffs, T)
+
+	for _, decomposition := range []Decomposition{BitDecomposition, RNSDecomposition, HybridDecomposition} {
+		key, _ := GenerateKeyWithDecomposition(fv, decomposition, 16)
+		evaluator := NewEvaluatorWithKey(fv, key.RelinearizationKey())
+		decryptor := NewDecryptor(fv, &key.SecKey)
+		check := func(name string, ct *Ciphertext, err error, level int, want func(i int) int64) {
+			if err != nil {
+				t.Fatalf("Error in %v(%v): %v", name, decomposition, err)
+			}
+			if l, err := fv.Level(ct); err != nil || l != level {
+				t.Fatalf("Error in %v(%v): ciphertext at level %v, expected %v", name, decomposition, l, level)
+			}
+			result, err := decryptor.Decrypt(ct)
+			if err != nil {
+				t.Fatalf("Error in Decrypt after %v(%v): %v", name, decomposition, err)
+			}
+			for i, c := range result.Value.GetCoefficients() {
+				if c.Int64() != want(i) {
+					t.Fatalf("Error in %v(%v), expected %v, got %v", name, decomposition, want(i), c.Int64())
+				}
+			}
+			budget, _ := decryptor.InvariantNoiseBudget(ct)
+			if estimate, ok := ct.NoiseBudgetEstimate(); !ok || estimate > budget {
+				t.Errorf("Error in NoiseBudgetEstimate after %v(%v): estimated %v bits, measured %v", name, decomposition, estimate, budget)
+			}
+		}
+		message := func(i int) int64 { return coeffs[i].Int64() }
+		square := func(i int) int64 { return want[i] }
+
+		ciphertext, _ := encryptMasked(fv, key, plaintext)
+		ct1, err := evaluator.ModSwitch(ciphertext)
+		check("ModSwitch", ct1, err, 1, message)
+
+		// the evaluator computes at the lower levels, with the keys reduced to them
+		ct, err := evaluator.Multiply(ct1, ct1)
+		check("Multiply", ct, err, 1, square)
+		ct, err = evaluator.AddPlain(ct1, plaintext)
+		check("AddPlain", ct, err, 1, func(i int) int64 { return 2 * coeffs[i].Int64() % T })
+		key2, _ := GenerateKeyWithDecomposition(fv, decomposition, 16)
+		ksk, _ := GenerateSwitchingKey(fv, &key.SecKey, &key2.SecKey, decomposition, 16)
+		ct, err = evaluator.KeySwitch(ct1, ksk)
+		if err != nil {
+			t.Fatalf("Error in KeySwitch(%v): %v", decomposition, err)
+		}
+		result, _ := NewDecryptor(fv, &key2.SecKey).Decrypt(ct)
+		for i, c := range result.Value.GetCoefficients() {
+			if c.Int64() != coeffs[i].Int64() {
+				t.Fatalf("Error in KeySwitch(%v) at level 1, expected %v, got %v", decomposition, coeffs[i].Int64(), c.Int64())
+			}
+		}
+		// only the relinearization key of the evaluator is cached
+		if len(evaluator.levelkeys) != 1 {
+			t.Errorf("Error in KeySwitch(%v): %v switching keys cached, expected 1", decomposition, len(evaluator.levelkeys))
+		}
+
+		ct0, err := evaluator.ModSwitch(ct1)
+		check("ModSwitch", ct0, err, 0, message)
+		if _, err = evaluator.ModSwitch(ct0); err == nil {
+			t.Errorf("Error in ModSwitch: ciphertext at the lowest level should be rejected")
+		}
+		if _, err = evaluator.Add(ciphertext, ct1); err == nil {
+			t.Errorf("Error in Add: ciphertexts at different levels should be rejected")
+		}
+	}
+
+	// the levels stop before the moduli smaller than T
+	fv, _ = NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(1 << 40), moduli))
+	if fv.MaxLevel() != 1 {
+		t.Errorf("Error in NewFVContextFromParameters: %v levels, expected 2", fv.MaxLevel() + 1)
+	}
+}
+
+// TestSymmetricEncryption checks the secret key encryption, its noise and its seeded encoding
+func TestSymmetricEncryption(t *testing.T) {
+	N := uint32(16)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fv, _ := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(97), moduli))
+	key, _ := GenerateKey(fv)
+	coeffs := make([]bigint.Int, N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 5 + 1) % 97)
+	}
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+	decryptor := NewDecryptor(fv, &key.SecKey)
+
+	ciphertext, err := NewSymmetricEncryptor(fv, &key.SecKey).Encrypt(plaintext)
+	if err != nil {
+		t.Fatalf("Error in SymmetricEncryptor.Encrypt: %v", err)
+	}
+	result, _ := decryptor.Decrypt(ciphertext)
+	for i, c := range result.Value.GetCoefficients() {
+		if !c.EqualTo(&coeffs[i]) {
+			t.Fatalf("Error in SymmetricEncryptor.Encrypt, expected %v, got %v", coeffs[i].Int64(), c.Int64())
+		}
+	}
+
+	// the symmetric encryption has no more noise than the public key one, up to a bit as the rounding
+	// of Q/T to Delta dominates both
+	public, _ := NewEncryptor(fv, &key.PubKey).Encrypt(plaintext)
+	symmetricBudget, _ := decryptor.InvariantNoiseBudget(ciphertext)
+	publicBudget, _ := decryptor.InvariantNoiseBudget(public)
+	if symmetricBudget + 1 < publicBudget {
+		t.Errorf("Error in SymmetricEncryptor.Encrypt: budget of %v bits, %v for the public key encryption", symmetricBudget, publicBudget)
+	}
+	if estimate, _ := ciphertext.NoiseBudgetEstimate(); estimate > symmetricBudget {
+		t.Errorf("Error in NoiseBudgetEstimate: estimated %v bits, measured %v", estimate, symmetricBudget)
+	}
+
+	// the seeded ciphertext is encoded in about half the size
+	data, err := fv.Marshal(ciphertext)
+	if err != nil {
+		t.Fatalf("Error in Marshal(Ciphertext): %v", err)
+	}
+	publicData, _ := fv.Marshal(public)
+	if len(data) > len(publicData) / 2 + headerSize + ring.SeedSize {
+		t.Errorf("Error in Marshal(Ciphertext): seeded ciphertext of %v bytes, %v for a full one", len(data), len(publicData))
+	}
+	decoded, _ := NewCiphertext(fv.N, fv.Q, fv.NttParams)
+	if err = fv.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("Error in Unmarshal(Ciphertext): %v", err)
+	}
+	if encoded, _ := fv.Marshal(decoded); string(encoded) != string(data) {
+		t.Errorf("Error in Unmarshal(Ciphertext): decoded ciphertext differs from the seeded one")
+	}
+	if err = fv.Unmarshal(data[:len(data) - 1], decoded); err == nil {
+		t.Errorf("Error in Unmarshal(Ciphertext): truncated data should be rejected")
+	}
+
+	// the evaluator combines symmetric and public key ciphertexts
+	sum, _ := NewEvaluator(fv, &key.EvaKey, key.EvaSize).Add(decoded, public)
+	result, _ = decryptor.Decrypt(sum)
+	for i, c := range result.Value.GetCoefficients() {
+		if c.Int64() != 2 * coeffs[i].Int64() % 97 {
+			t.Fatalf("Error in Add with a symmetric ciphertext, expected %v, got %v", 2 * coeffs[i].Int64() % 97, c.Int64())
+		}
+	}
+
+	// both encryptors take the coefficients of the plaintext mod T
+	large := make([]bigint.Int, N)
+	for i := range large {
+		large[i].Add(&coeffs[i], bigint.NewInt(97 * int64(i + 1)))
+	}
+	largePlaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	largePlaintext.Value.Poly.SetCoefficients(large)
+	public, _ = NewEncryptor(fv, &key.PubKey).Encrypt(largePlaintext)
+	ciphertext, _ = NewSymmetricEncryptor(fv, &key.SecKey).Encrypt(largePlaintext)
+	for _, ct := range []*Ciphertext{public, ciphertext} {
+		result, _ = decryptor.Decrypt(ct)
+		for i, c := range result.Value.GetCoefficients() {
+			if !c.EqualTo(&coeffs[i]) {
+				t.Fatalf("Error in Encrypt of coefficients larger than T, expected %v, got %v", coeffs[i].Int64(), c.Int64())
+			}
+		}
+	}
+}
+
+// TestSeededKey checks that the uniform components of the keys are expanded from the key seed,
+// that the seeded encodings are smaller and that the decoded public keys encrypt and relinearize
+func TestSeededKey(t *testing.T) {
+	N := uint32(16)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fv, _ := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(10), moduli))
+	coeffs := make([]bigint.Int, N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 7 % 10))
+	}
+	want := negacyclicProduct(coeffs, coeffs, 10)
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+
+	for _, decomposition := range []Decomposition{BitDecomposition, HybridDecomposition} {
+		key, err := GenerateKeyWithDecomposition(fv, decomposition, 30)
+		if err != nil {
+			t.Fatalf("Error in GenerateKeyWithDecomposition(%v): %v", decomposition, err)
+		}
+		if len(key.Seed) != ring.SeedSize {
+			t.Fatalf("Error in GenerateKeyWithDecomposition(%v): seed of %v bytes", decomposition, len(key.Seed))
+		}
+		data, err := fv.Marshal(key)
+		if err != nil {
+			t.Fatalf("Error in Marshal(Key, %v): %v", decomposition, err)
+		}
+		unseeded := *key
+		unseeded.Seed = nil
+		fullData, _ := fv.Marshal(&unseeded)
+		omitted := (1 + len(key.EvaKey)) * key.PubKey[1].BinarySize()
+		for i := range key.EvaKeyP {
+			omitted += key.EvaKeyP[i][1].BinarySize()
+		}
+		if len(data) != len(fullData) - omitted + ring.SeedSize {
+			t.Errorf("Error in Marshal(Key, %v): seeded key of %v bytes, %v for a full one", decomposition, len(data), len(fullData))
+		}
+
+		// the uniform components are expanded again from the seed
+		decoded, _ := NewKey(fv.N, fv.Q, fv.NttParams, 1)
+		if err = fv.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("Error in Unmarshal(Key, %v): %v", decomposition, err)
+		}
+		if encoded, _ := fv.Marshal(decoded); string(encoded) != string(data) {
+			t.Errorf("Error in Unmarshal(Key, %v): decoded key differs from the seeded one", decomposition)
+		}
+		pkData, _ := fv.Marshal(&key.PubKey)
+		if encoded, _ := fv.Marshal(&decoded.PubKey); string(encoded) != string(pkData) {
+			t.Errorf("Error in Unmarshal(Key, %v): expanded public key differs", decomposition)
+		}
+		evkData, _ := fv.Marshal(&key.EvaKey)
+		if encoded, _ := fv.Marshal(&decoded.EvaKey); string(encoded) != string(evkData) {
+			t.Errorf("Error in Unmarshal(Key, %v): expanded evaluation key differs", decomposition)
+		}
+		if err = fv.Unmarshal(data[:len(data) - 1], decoded); err == nil {
+			t.Errorf("Error in Unmarshal(Key, %v): truncated data should be rejected", decomposition)
+		}
+
+		// the public encoding is enough to encrypt and relinearize
+		data, err = fv.MarshalPublic(key)
+		if err != nil {
+			t.Fatalf("Error in MarshalPublic(Key, %v): %v", decomposition, err)
+		}
+		public, _ := NewKey(fv.N, fv.Q, fv.NttParams, 1)
+		if err = fv.UnmarshalPublic(data, public); err != nil {
+			t.Fatalf("Error in UnmarshalPublic(Key, %v): %v", decomposition, err)
+		}
+		ciphertext, _ := NewEncryptor(fv, &public.PubKey).Encrypt(plaintext)
+		product, err := NewEvaluatorWithKey(fv, public.RelinearizationKey()).Multiply(ciphertext, ciphertext)
+		if err != nil {
+			t.Fatalf("Error in Multiply(%v): %v", decomposition, err)
+		}
+		result, _ := NewDecryptor(fv, &key.SecKey).Decrypt(product)
+		for i, c := range result.Value.GetCoefficients() {
+			if c.Int64() != want[i] {
+				t.Fatalf("Error in UnmarshalPublic(Key, %v), expected %v, got %v", decomposition, want[i], c.Int64())
+			}
+		}
+		if _, err = fv.MarshalPublic(&unseeded); err == nil {
+			t.Errorf("Error in MarshalPublic(Key, %v): key without seed should be rejected", decomposition)
+		}
+	}
+}
+
+// TestPRNG checks that keys and encryptions sampled with keyed XOFs are reproducible,
+// and that the XOF gives the known answers of SHAKE-128
+func TestPRNG(t *testing.T) {
+	out := make([]byte, 16)
+	ring.NewXOF([]byte("lago")).Read(out)
+	if hex.EncodeToString(out) != "a96f1e3a162f1f04ffdc5c83eb3e32a9" {
+		t.Errorf("Error in NewXOF: expected the output of SHAKE-128, got %x", out)
+	}
+
+	N := uint32(16)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fv, _ := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(10), moduli))
+	coeffs := make([]bigint.Int, N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 3 % 10))
+	}
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+
+	// the same key gives the same key pair and ciphertexts
+	var keys [2][]byte
+	var ciphertexts, symmetric [2][]byte
+	for i := range keys {
+		key, err := GenerateKeyWithPRNG(fv, HybridDecomposition, 0, ring.NewXOF([]byte("key")))
+		if err != nil {
+			t.Fatalf("Error in GenerateKeyWithPRNG: %v", err)
+		}
+		keys[i], _ = fv.Marshal(key)
+		ciphertext, err := NewEncryptorWithPRNG(fv, &key.PubKey, ring.NewXOF([]byte("encryption"))).Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error in Encrypt: %v", err)
+		}
+		ciphertexts[i], _ = fv.Marshal(ciphertext)
+		ciphertext, err = NewSymmetricEncryptorWithPRNG(fv, &key.SecKey, ring.NewXOF([]byte("encryption"))).Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Error in SymmetricEncryptor.Encrypt: %v", err)
+		}
+		symmetric[i], _ = fv.Marshal(ciphertext)
+
+		result, _ := NewDecryptor(fv, &key.SecKey).Decrypt(ciphertext)
+		for j, c := range result.Value.GetCoefficients() {
+			if !c.EqualTo(&coeffs[j]) {
+				t.Fatalf("Error in SymmetricEncryptor.Encrypt, expected %v, got %v", coeffs[j].Int64(), c.Int64())
+			}
+		}
+	}
+	if string(keys[0]) != string(keys[1]) {
+		t.Errorf("Error in GenerateKeyWithPRNG: keys of the same PRNG key differ")
+	}
+	if string(ciphertexts[0]) != string(ciphertexts[1]) || string(symmetric[0]) != string(symmetric[1]) {
+		t.Errorf("Error in Encrypt: ciphertexts of the same PRNG key differ")
+	}
+
+	// another key gives other keys
+	key, _ := GenerateKeyWithPRNG(fv, HybridDecomposition, 0, ring.NewXOF([]byte("other key")))
+	if data, _ := fv.Marshal(key); string(data) == string(keys[0]) {
+		t.Errorf("Error in GenerateKeyWithPRNG: keys of different PRNG keys are equal")
+	}
+}
+
+// TestSecretDistribution checks that keys with secrets of each distribution encrypt, relinearize and decrypt,
+// and that the coefficients of the secrets are in the range of their distribution
+func TestSecretDistribution(t *testing.T) {
+	N := uint32(16)
+	moduli, _ := polynomial.GenerateNTTPrimes(N, 30, 3)
+	fv, _ := NewFVContextFromParameters(NewRNSParameters(N, *bigint.NewInt(10), moduli))
+	coeffs := make([]bigint.Int, N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 3 % 10))
+	}
+	want := negacyclicProduct(coeffs, coeffs, 10)
+	plaintext, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext.Value.Poly.SetCoefficients(coeffs)
+
+	testCases := []struct {
+		options KeyOptions
+		min, max int64
+	}{
+		{KeyOptions{Secret: BinarySecret}, 0, 1},
+		{KeyOptions{Secret: TernarySecret}, -1, 1},
+		{KeyOptions{Secret: FixedWeightSecret, HammingWeight: 4}, -1, 1},
+		{KeyOptions{Secret: CBDSecret, Eta: 1}, -1, 1},
+	}
+	for _, tc := range testCases {
+		tc.options.Decomposition = HybridDecomposition
+		key, err := GenerateKeyWithOptions(fv, tc.options)
+		if err != nil {
+			t.Fatalf("Error in GenerateKeyWithOptions(%v): %v", tc.options.Secret, err)
+		}
+		secret, _ := cloneRing(key.SecKey.Value)
+		secret.Poly.InverseNTT()
+		center(secret)
+		weight := 0
+		for _, c := range secret.GetCoefficients() {
+			if c.Int64() < tc.min || c.Int64() > tc.max {
+				t.Fatalf("Error in GenerateKeyWithOptions(%v): secret coefficient %v", tc.options.Secret, c.Int64())
+			}
+			if c.Int64() != 0 {
+				weight++
+			}
+		}
+		if tc.options.Secret == FixedWeightSecret && weight != int(tc.options.HammingWeight) {
+			t.Errorf("Error in GenerateKeyWithOptions(%v): hamming weight %v", tc.options.Secret, weight)
+		}
+
+		ciphertext, _ := NewEncryptor(fv, &key.PubKey).Encrypt(plaintext)
+		product, err := NewEvaluatorWithKey(fv, key.RelinearizationKey()).Multiply(ciphertext, ciphertext)
+		if err != nil {
+			t.Fatalf("Error in Multiply(%v): %v", tc.options.Secret, err)
+		}
+		result, _ := NewDecryptor(fv, &key.SecKey).Decrypt(product)
+		for i, c := range result.Value.GetCoefficients() {
+			if c.Int64() != want[i] {
+				t.Fatalf("Error in Multiply(%v), expected %v, got %v", tc.options.Secret, want[i], c.Int64())
+			}
+		}
+	}
+
+	if _, err := GenerateKeyWithOptions(fv, KeyOptions{Decomposition: HybridDecomposition, Secret: FixedWeightSecret}); err == nil {
+		t.Errorf("Error in GenerateKeyWithOptions: fixed weight secret of weight 0 should be rejected")
+	}
+}
+
 func BenchmarkFVContext(b *testing.B) {
 	for i := 0; i <=0; i++ {
 		testfile, _ := ioutil.ReadFile(fmt.Sprintf("test_data/testvector_fv_%d", i))
 		filecontent := strings.TrimSpace(string(testfile))
 		vs := strings.Split(filecontent, "\n")
 
-		// load BigQ
-		BigQ := vs[0]
-
 		// load Q
 		Q := vs[1]
 
@@ -176,9 +1263,9 @@ func BenchmarkFVContext(b *testing.B) {
 		N, _ := strconv.Atoi(vs[3])
 
 		// create FV context
-		fv := NewFVContext(uint32(N), *bigint.NewInt(int64(T)), *bigint.NewIntFromString(Q), *bigint.NewIntFromString(BigQ))
+		fv, _ := NewFVContextFromParameters(NewParameters(uint32(N), *bigint.NewInt(int64(T)), *bigint.NewIntFromString(Q)))
 		// generate new keys
-		key := GenerateKey(fv)
+		key, _ := GenerateKey(fv)
 
 		// load first plaintext
 		plaintext1String := strings.Split(strings.TrimSpace(vs[4]), ", ")
@@ -187,7 +1274,7 @@ func BenchmarkFVContext(b *testing.B) {
 			tmp, _ := strconv.Atoi(plaintext1String[i])
 			plaintext1Coeffs[i].SetInt(int64(tmp))
 		}
-		plaintext1 := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+		plaintext1, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
 		plaintext1.Value.Poly.SetCoefficients(plaintext1Coeffs)
 		plaintext1.Value.Poly.NTT()
 
@@ -198,14 +1285,14 @@ func BenchmarkFVContext(b *testing.B) {
 			tmp, _ := strconv.Atoi(plaintext2String[i])
 			plaintext2Coeffs[i].SetInt(int64(tmp))
 		}
-		plaintext2 := NewPlaintext(fv.N, fv.Q, fv.NttParams)
+		plaintext2, _ := NewPlaintext(fv.N, fv.Q, fv.NttParams)
 		plaintext2.Value.Poly.SetCoefficients(plaintext2Coeffs)
 		plaintext2.Value.Poly.NTT()
 
 		// encrypt
 		encryptor := NewEncryptor(fv, &key.PubKey)
-		ciphertext1 := encryptor.Encrypt(plaintext1)
-		ciphertext2 := encryptor.Encrypt(plaintext2)
+		ciphertext1, _ := encryptor.Encrypt(plaintext1)
+		ciphertext2, _ := encryptor.Encrypt(plaintext2)
 
 		evaluator := NewEvaluator(fv, &key.EvaKey, key.EvaSize)
 		b.ResetTimer()
@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"fmt"
+)
+
+// GaloisKeys holds the switching keys from s(X^k) to s, indexed by the galois element k
+type GaloisKeys map[uint32]*SwitchingKey
+
+// galoisGenerator generates, with -1, the multiplicative group of odd integers mod 2N
+const galoisGenerator = 3
+
+// GaloisElementRowRotation returns the galois element rotating the rows of batched slots
+// to the left by steps, or to the right for negative steps
+func GaloisElementRowRotation(N uint32, steps int) uint32 {
+	rowSize := int(N / 2)
+	steps %= rowSize
+	if steps < 0 {
+		steps += rowSize
+	}
+	m := uint64(2 * N)
+	k := uint64(1)
+	for i := 0; i < steps; i++ {
+		k = k * galoisGenerator % m
+	}
+	return uint32(k)
+}
+
+// GaloisElementColumnRotation returns the galois element swapping the two rows of batched slots
+func GaloisElementColumnRotation(N uint32) uint32 {
+	return 2 * N - 1
+}
+
+// GenerateGaloisKeys generates the galois keys of the galois elements for the secret key of key,
+// with the decomposition of its evaluation key
+func GenerateGaloisKeys(fv *FVContext, key *Key, galoisElements []uint32) (GaloisKeys, error) {
+	keys := make(GaloisKeys, len(galoisElements))
+	sk := key.SecKey.Value
+	sk_k, err := NewSecretKey(fv.N, fv.Q, fv.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range galoisElements {
+		if _, ok := keys[k]; ok {
+			continue
+		}
+		if _, err = sk_k.Value.Automorphism(sk, k); err != nil {
+			return nil, err
+		}
+		keys[k], err = GenerateSwitchingKey(fv, sk_k, &key.SecKey, key.EvaDecomposition, key.EvaSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// SetGaloisKeys sets the galois keys used by ApplyGalois and the rotations
+func (evaluator *Evaluator) SetGaloisKeys(keys GaloisKeys) {
+	evaluator.galoiskeys = keys
+	for id := range evaluator.levelkeys {
+		if id.galois != 0 {
+			delete(evaluator.levelkeys, id)
+		}
+	}
+}
+
+// ApplyGalois applies the automorphism X -> X^k to the plaintext of ciphertext ct,
+// the galois key of k has to be set with SetGaloisKeys.
+func (evaluator *Evaluator) ApplyGalois(ct *Ciphertext, k uint32) (*Ciphertext, error) {
+	ksk, ok := evaluator.galoiskeys[k]
+	if !ok {
+		return nil, fmt.Errorf("missing galois key of galois element %d", k)
+	}
+	ctx, err := evaluator.context(ct)
+	if err != nil {
+		return nil, err
+	}
+	if ksk, err = evaluator.ownKeyAt(ctx, k, ksk); err != nil {
+		return nil, err
+	}
+	// (c0(X^k), c1(X^k)) decrypts with s(X^k), and is switched to s
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.value {
+		if _, err = c.value[i].Automorphism(ct.value[i], k); err != nil {
+			return nil, err
+		}
+	}
+	c.noise = ct.noise  // the automorphism permutes the coefficients of the noise
+	return evaluator.switchCiphertext(ctx, c, ksk)
+}
+
+// RotateRows rotates the rows of the batched slots of ct to the left by steps,
+// or to the right for negative steps
+func (evaluator *Evaluator) RotateRows(ct *Ciphertext, steps int) (*Ciphertext, error) {
+	return evaluator.ApplyGalois(ct, GaloisElementRowRotation(evaluator.ctx.N, steps))
+}
+
+// RotateColumns swaps the two rows of the batched slots of ct
+func (evaluator *Evaluator) RotateColumns(ct *Ciphertext) (*Ciphertext, error) {
+	return evaluator.ApplyGalois(ct, GaloisElementColumnRotation(evaluator.ctx.N))
+}
@@ -1,101 +1,298 @@
 package crypto
 
 import (
+	"crypto/sha3"
+	"encoding/binary"
+	"errors"
+	"io"
 	"github.com/dedis/lago/ring"
 	"github.com/dedis/lago/bigint"
-	"math"
+	"github.com/dedis/lago/polynomial"
 )
 
 type Key struct {
 	PubKey PublicKey
 	SecKey SecretKey
 	EvaKey EvaluationKey
-	EvaSize uint32
+	EvaSize uint32  // bit length of the decomposition base of BitDecomposition
+	EvaDecomposition Decomposition
+	EvaKeyP EvaluationKey  // components of the evaluation key modulo the special prime of HybridDecomposition
+	Seed []byte  // seed of the uniform components of PubKey, EvaKey and EvaKeyP, nil if they are not seeded
 }
 
-type PublicKey = [2]*ring.Ring
+type PublicKey [2]*ring.Ring
 
-type SecretKey = *ring.Ring
+type SecretKey struct {
+	Value *ring.Ring
+}
+
+type EvaluationKey [][2]*ring.Ring
+
+// decompositionLength returns the number of digits of base 2^evaSize needed to decompose elements of Z_q
+func decompositionLength(q bigint.Int, evaSize uint32) int {
+	return (q.Value.BitLen() - 1) / int(evaSize) + 1
+}
+
+// randomSource returns prng, or a new ring.NewPRNG if prng is nil
+func randomSource(prng ring.PRNG) (ring.PRNG, error) {
+	if prng != nil {
+		return prng, nil
+	}
+	return ring.NewPRNG()
+}
+
+// newSeed returns a random seed of ring.SeedSize bytes read from prng
+func newSeed(prng ring.PRNG) ([]byte, error) {
+	seed := make([]byte, ring.SeedSize)
+	if _, err := io.ReadFull(prng, seed); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// deriveSeed returns the index-th seed derived from seed, SHAKE-128(seed || index), so that the uniform
+// components of a key are expanded from independent seeds
+func deriveSeed(seed []byte, index uint32) []byte {
+	var tmp [4]byte
+	binary.BigEndian.PutUint32(tmp[:], index)
+	xof := sha3.NewSHAKE128()
+	xof.Write(seed)
+	xof.Write(tmp[:])
+	derived := make([]byte, ring.SeedSize)
+	xof.Read(derived)
+	return derived
+}
+
+// uniformFromSeed returns the uniform ring, in NTT form, with the parameters of template r expanded from
+// the index-th seed derived from seed
+func uniformFromSeed(r *ring.Ring, seed []byte, index uint32) (*ring.Ring, error) {
+	a, err := ring.NewUniformPolyFromSeed(r.N, r.Q, r.Poly.GetNTTParams(), deriveSeed(seed, index))
+	if err != nil {
+		return nil, err
+	}
+	a.Poly.NTT()
+	return a, nil
+}
+
+// NewPublicKey creates a zero public key with given parameters, e.g. to be filled by FVContext.Unmarshal
+func NewPublicKey(n uint32, q bigint.Int, nttParams *polynomial.NttParams) (*PublicKey, error) {
+	pk := new(PublicKey)
+	for i := range pk {
+		r, err := ring.NewRing(n, q, nttParams)
+		if err != nil {
+			return nil, err
+		}
+		pk[i] = r
+	}
+	return pk, nil
+}
 
-type EvaluationKey = [][2]*ring.Ring
+// NewSecretKey creates a zero secret key with given parameters, e.g. to be filled by FVContext.Unmarshal
+func NewSecretKey(n uint32, q bigint.Int, nttParams *polynomial.NttParams) (*SecretKey, error) {
+	r, err := ring.NewRing(n, q, nttParams)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretKey{Value: r}, nil
+}
 
-// KeyGenerator generates the public key and secret key of given FV context
-func GenerateKey(fv *FVContext) *Key {
+// NewEvaluationKey creates a zero evaluation key with given parameters and decomposition base 2^evaSize,
+// e.g. to be filled by FVContext.Unmarshal
+func NewEvaluationKey(n uint32, q bigint.Int, nttParams *polynomial.NttParams, evaSize uint32) (*EvaluationKey, error) {
+	evk := make(EvaluationKey, decompositionLength(q, evaSize))
+	for i := range evk {
+		for j := range evk[i] {
+			r, err := ring.NewRing(n, q, nttParams)
+			if err != nil {
+				return nil, err
+			}
+			evk[i][j] = r
+		}
+	}
+	return &evk, nil
+}
+
+// NewKey creates a zero key with given parameters and decomposition base 2^evaSize,
+// e.g. to be filled by FVContext.Unmarshal
+func NewKey(n uint32, q bigint.Int, nttParams *polynomial.NttParams, evaSize uint32) (*Key, error) {
+	pk, err := NewPublicKey(n, q, nttParams)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := NewSecretKey(n, q, nttParams)
+	if err != nil {
+		return nil, err
+	}
+	evk, err := NewEvaluationKey(n, q, nttParams, evaSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{PubKey: *pk, SecKey: *sk, EvaKey: *evk, EvaSize: evaSize}, nil
+}
+
+// RelinearizationKey returns the evaluation key as the switching key from s^2 to s used by the evaluator
+func (key *Key) RelinearizationKey() *SwitchingKey {
+	return &SwitchingKey{Decomposition: key.EvaDecomposition, Base: key.EvaSize, Value: key.EvaKey, ValueP: key.EvaKeyP}
+}
+
+// KeyGenerator generates the public key and secret key of given FV context,
+// with an evaluation key of BitDecomposition in base 2
+func GenerateKey(fv *FVContext) (*Key, error) {
+	return GenerateKeyWithDecomposition(fv, BitDecomposition, 1)
+}
+
+// GenerateKeyWithDecomposition generates the public key and secret key of given FV context,
+// with an evaluation key of the decomposition. base is the bit length of the base of BitDecomposition,
+// and is ignored otherwise: larger bases give smaller keys and faster relinearizations, but more noise.
+// The uniform components of the public and evaluation keys are expanded from the random Seed of the key,
+// which FVContext.Marshal encodes instead of them.
+func GenerateKeyWithDecomposition(fv *FVContext, decomposition Decomposition, base uint32) (*Key, error) {
+	prng, err := ring.NewPRNG()
+	if err != nil {
+		return nil, err
+	}
+	return GenerateKeyWithPRNG(fv, decomposition, base, prng)
+}
+
+// GenerateKeyWithPRNG generates the keys like GenerateKeyWithDecomposition, sampling all their randomness with prng,
+// e.g. a ring.NewXOF for reproducible keys
+func GenerateKeyWithPRNG(fv *FVContext, decomposition Decomposition, base uint32, prng ring.PRNG) (*Key, error) {
+	return GenerateKeyWithOptions(fv, KeyOptions{Decomposition: decomposition, Base: base, PRNG: prng})
+}
+
+// SecretDistribution selects the distribution of the coefficients of the secret key
+type SecretDistribution int
+
+const (
+	// TernarySecret samples the coefficients uniformly in {-1, 0, 1}, the distribution assumed by the
+	// security tables of the HE standard, see ValidateSecurity. It is the default distribution.
+	TernarySecret SecretDistribution = iota
+	// BinarySecret samples the coefficients uniformly in {0, 1}
+	BinarySecret
+	// FixedWeightSecret samples HammingWeight coefficients uniformly in {-1, 1}, the others being 0
+	FixedWeightSecret
+	// CBDSecret samples the coefficients from the centered binomial distribution of parameter Eta,
+	// the noise estimates of the evaluator assume Eta = 1
+	CBDSecret
+)
+
+// KeyOptions are the options of GenerateKeyWithOptions
+type KeyOptions struct {
+	Decomposition Decomposition  // decomposition of the evaluation key
+	Base uint32  // bit length of the base of BitDecomposition
+	Secret SecretDistribution  // distribution of the secret key, TernarySecret by default
+	HammingWeight uint32  // number of nonzero coefficients of FixedWeightSecret
+	Eta uint32  // parameter of CBDSecret
+	PRNG ring.PRNG  // source of the randomness of the keys, a new ring.NewPRNG if nil
+}
+
+// sampleSecret samples the secret key of the distribution of options with prng, in coefficient form
+func (options *KeyOptions) sampleSecret(fv *FVContext, prng ring.PRNG) (*ring.Ring, error) {
+	switch options.Secret {
+	case BinarySecret:
+		return ring.NewUniformPoly(prng, fv.N, fv.Q, fv.NttParams, *bigint.NewInt(int64(2)))
+	case TernarySecret:
+		return ring.NewTernaryPoly(prng, fv.N, fv.Q, fv.NttParams, 0)
+	case FixedWeightSecret:
+		if options.HammingWeight == 0 {
+			return nil, errors.New("hamming weight of the secret key should be positive")
+		}
+		return ring.NewTernaryPoly(prng, fv.N, fv.Q, fv.NttParams, options.HammingWeight)
+	case CBDSecret:
+		return ring.NewCBDPoly(prng, fv.N, fv.Q, fv.NttParams, options.Eta)
+	}
+	return nil, errors.New("unknown secret distribution")
+}
+
+// GenerateKeyWithOptions generates the keys like GenerateKeyWithDecomposition, with the secret key distribution
+// and source of randomness of options
+func GenerateKeyWithOptions(fv *FVContext, options KeyOptions) (*Key, error) {
+	prng, err := randomSource(options.PRNG)
+	if err != nil {
+		return nil, err
+	}
+	decomposition, base := options.Decomposition, options.Base
 	key := new(Key)
-	err := *new(error)
 	// generate secret key
-	key.SecKey, err = ring.NewUniformPoly(fv.N, fv.Q, fv.NttParams, *bigint.NewInt(int64(2)))
+	key.SecKey.Value, err = options.sampleSecret(fv, prng)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	key.SecKey.Poly.NTT()  // store secret key in NTT form
+	key.SecKey.Value.Poly.NTT()  // store secret key in NTT form
 
-	// generate public key: PubKey[0] = e - a * sk, PubKey[1] = a
-	key.PubKey[1], err = ring.NewUniformPoly(fv.N, fv.Q, fv.NttParams,  *bigint.NewInt(int64(2)))
+	// the uniform components are expanded from the seed: PubKey[1] from its seed 0, and the evaluation key
+	// from its seed 1, see expandSeed
+	key.Seed, err = newSeed(prng)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	key.PubKey[1].Poly.NTT()
 
+	// generate public key: PubKey[0] = e - a * sk, PubKey[1] = a
 	a_sk, err := ring.NewRing(fv.N, fv.Q, fv.NttParams)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	_, err = a_sk.MulCoeffs(key.PubKey[1], key.SecKey)
+	key.PubKey[1], err = uniformFromSeed(a_sk, key.Seed, 0)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	key.PubKey[0], err = ring.NewGaussPoly(fv.N, fv.Q, fv.NttParams, fv.Sigma)
+	_, err = a_sk.MulCoeffs(key.PubKey[1], key.SecKey.Value)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	key.PubKey[0], err = ring.NewGaussPoly(prng, fv.N, fv.Q, fv.NttParams, fv.Gauss)
+	if err != nil {
+		return nil, err
 	}
 	key.PubKey[0].Poly.NTT()
 
 	_, err = key.PubKey[0].Sub(key.PubKey[0], a_sk)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	// generate evaluation key
-	key.EvaSize = 1
-	l := int(math.Floor(float64(fv.Q.Value.BitLen() - 1) / float64(key.EvaSize))) + 1
-	key.EvaKey = make([][2]*ring.Ring, l)
-
-	w := bigint.NewInt(1)  // decomposition base, corresponding to T^i in the paper, here T=2^key.EvaSize
-	for i := 0; i < l ; i++ {
-		// evaluationKey[i][1] = a_i, where a_i sampled from R_q
-		key.EvaKey[i][1], err = ring.NewUniformPoly(fv.N, fv.Q, fv.NttParams, fv.Q)
-		if err != nil {
-			panic(err)
-		}
-		key.EvaKey[i][1].Poly.NTT()
+	// generate evaluation key, switching s^2 to s
+	s2, err := ring.NewRing(fv.N, fv.Q, fv.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s2.MulCoeffs(key.SecKey.Value, key.SecKey.Value); err != nil {
+		return nil, err
+	}
+	relinKey, err := generateSwitchingKey(fv, s2, key.SecKey.Value, decomposition, base, deriveSeed(key.Seed, 1), prng)
+	if err != nil {
+		return nil, err
+	}
+	key.EvaSize = base
+	key.EvaDecomposition = decomposition
+	key.EvaKey = relinKey.Value
+	key.EvaKeyP = relinKey.ValueP
 
-		// evaluationKey[i][0] = -(a_i * s + e_i) + T^i * s * s mod q
-		key.EvaKey[i][0], err = ring.NewGaussPoly(fv.N, fv.Q, fv.NttParams, fv.Sigma)
-		if err != nil {
-			panic(err)
-		}
-		key.EvaKey[i][0].Poly.NTT()
+	return key, nil
+}
 
-		tmp1, err := ring.NewRing(fv.N, fv.Q, fv.NttParams)
-		if err != nil {
-			panic(err)
+// expandSeed sets the uniform components of the key, PubKey[1] and the second rings of EvaKey and EvaKeyP,
+// to their expansion from Seed, the other rings being the templates of their parameters
+func (key *Key) expandSeed() error {
+	if len(key.Seed) != ring.SeedSize {
+		return errors.New("key seed should have ring.SeedSize bytes")
+	}
+	var err error
+	if key.PubKey[1], err = uniformFromSeed(key.PubKey[0], key.Seed, 0); err != nil {
+		return err
+	}
+	evkSeed := deriveSeed(key.Seed, 1)
+	for i := range key.EvaKey {
+		if key.EvaKey[i][1], err = uniformFromSeed(key.EvaKey[i][0], evkSeed, uint32(i)); err != nil {
+			return err
 		}
-		tmp1.MulCoeffs(key.EvaKey[i][1], key.SecKey)
-
-		tmp2, err := ring.NewRing(fv.N, fv.Q, fv.NttParams)
-		if err != nil {
-			panic(err)
+	}
+	for i := range key.EvaKeyP {
+		if key.EvaKeyP[i][1], err = uniformFromSeed(key.EvaKeyP[i][0], evkSeed, uint32(len(key.EvaKey) + i)); err != nil {
+			return err
 		}
-		tmp2.MulCoeffs(key.SecKey, key.SecKey)
-		tmp2.MulScalar(tmp2, *w)
-
-		key.EvaKey[i][0].Sub(key.EvaKey[i][0], tmp1)
-		key.EvaKey[i][0].Add(key.EvaKey[i][0], tmp2)
-
-		w.Lsh(w, key.EvaSize)
 	}
-
-	return key
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,427 @@
+package crypto
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/ring"
+)
+
+// Decomposition selects how a ring element is split into digits with small coefficients during key switching,
+// the noise added by key switching grows with the size of the digits and the key size with their number.
+type Decomposition int
+
+const (
+	// BitDecomposition splits the coefficients into digits of base 2^Base
+	BitDecomposition Decomposition = iota
+	// RNSDecomposition splits the coefficients into their residues modulo the primes of Q,
+	// which needs Q to be the product of several primes, see NewRNSParameters
+	RNSDecomposition
+	// HybridDecomposition splits the coefficients like RNSDecomposition, or keeps them whole if Q is a prime,
+	// and switches keys modulo Q * P for the special prime P of the context, the result being divided by P.
+	// Its keys have the fewest components, and the noise of the large digits is divided by P,
+	// see the hybrid key switching of https://eprint.iacr.org/2011/566.pdf
+	HybridDecomposition
+)
+
+// SwitchingKey switches ciphertexts decrypted with a secret key sFrom to ciphertexts decrypted with sTo.
+// Value[i] = (-(a_i * sTo + e_i) + g_i * sFrom, a_i), in NTT form, where g_i is the i-th element of the gadget
+// vector of the decomposition, i.e. sum g_i * digit_i(c) = c mod Q for any c.
+// With HybridDecomposition, g_i is multiplied by the special prime P, and ValueP holds the same
+// encryptions modulo P, i.e. (-(a'_i * sTo + e_i), a'_i) mod P.
+type SwitchingKey struct {
+	Decomposition Decomposition
+	Base uint32 // bit length of the base of BitDecomposition
+	Value EvaluationKey
+	ValueP EvaluationKey // components modulo the special prime P of HybridDecomposition
+}
+
+// bitGadget returns the gadget vector (1, 2^base, 2^(2 * base), ...) of BitDecomposition
+func bitGadget(q bigint.Int, base uint32) []bigint.Int {
+	gadget := make([]bigint.Int, decompositionLength(q, base))
+	w := bigint.NewInt(1)  // decomposition base, corresponding to T^i in the paper, here T=2^base
+	for i := range gadget {
+		gadget[i].SetBigInt(w)
+		w.Lsh(w, base)
+	}
+	return gadget
+}
+
+// gadget returns the gadget vector of the decomposition in the context fv
+func (fv *FVContext) gadget(decomposition Decomposition, base uint32) ([]bigint.Int, error) {
+	switch decomposition {
+	case BitDecomposition:
+		if base == 0 {
+			return nil, errors.New("decomposition base should be positive")
+		}
+		return bitGadget(fv.Q, base), nil
+	case RNSDecomposition:
+		if len(fv.RNSParams.Moduli) < 2 {
+			return nil, errors.New("RNS decomposition needs a ciphertext modulus with several primes")
+		}
+		return fv.rnsGadget(), nil
+	case HybridDecomposition:
+		// g_i * P mod Q, with a single digit g_0 = 1 if Q is a prime
+		gadget := []bigint.Int{*bigint.NewInt(1)}
+		if len(fv.RNSParams.Moduli) > 1 {
+			gadget = fv.rnsGadget()
+		}
+		for i := range gadget {
+			gadget[i].Mul(&gadget[i], &fv.SpecialP)
+			gadget[i].Mod(&gadget[i], &fv.Q)
+		}
+		return gadget, nil
+	}
+	return nil, errors.New("unknown decomposition")
+}
+
+// rnsGadget returns the gadget vector of RNSDecomposition, g_i = (Q / q_i) * ((Q / q_i)^-1 mod q_i)
+func (fv *FVContext) rnsGadget() []bigint.Int {
+	moduli := fv.RNSParams.Moduli
+	gadget := make([]bigint.Int, len(moduli))
+	var qHatInv bigint.Int
+	for i := range moduli {
+		gadget[i].Div(&fv.Q, &moduli[i])
+		qHatInv.Inv(&gadget[i], &moduli[i])
+		gadget[i].Mul(&gadget[i], &qHatInv)
+		gadget[i].Mod(&gadget[i], &fv.Q)
+	}
+	return gadget
+}
+
+// cloneRing returns a copy of r1, ring.CopyRing only copying its parameters
+func cloneRing(r1 *ring.Ring) (*ring.Ring, error) {
+	r, err := ring.CopyRing(r1)
+	if err != nil {
+		return nil, err
+	}
+	return r.Copy(r1)
+}
+
+// liftCentered sets r to r1, in coefficient form, with its coefficients centered in (-q1/2, q1/2]
+// and reduced modulo the modulus of r, i.e. the small coefficients of r1 keep their value
+func liftCentered(r, r1 *ring.Ring) error {
+	if r1.IsNTT() {
+		return errors.New("lifted ring should be in coefficient form")
+	}
+	qDiv2 := bigint.NewInt(1)
+	qDiv2.Div(&r1.Q, bigint.NewInt(2))
+	coeffs := make([]bigint.Int, r1.N)
+	for i, c := range r1.GetCoefficients() {
+		coeffs[i].SetBigInt(&c)
+		if coeffs[i].Compare(qDiv2) == 1 {
+			coeffs[i].Sub(&coeffs[i], &r1.Q)
+		}
+		coeffs[i].Mod(&coeffs[i], &r.Q)
+	}
+	if r.IsNTT() {
+		r.Poly.InverseNTT()
+	}
+	return r.Poly.SetCoefficients(coeffs)
+}
+
+// newSpecialRing creates a zero ring modulo the special prime P of HybridDecomposition
+func (fv *FVContext) newSpecialRing() (*ring.Ring, error) {
+	return ring.NewRing(fv.N, fv.SpecialP, fv.specialNttParams)
+}
+
+// generateSwitchingKey generates the encryptions with sTo of g_i * sFrom for the elements g_i of the gadget vector
+// of the decomposition, sFrom and sTo being in NTT form. The uniform components a_i of the l encryptions are
+// expanded from the seeds i derived from seed, and the components a'_i modulo P from the seeds l + i.
+// The errors are sampled with prng.
+func generateSwitchingKey(fv *FVContext, sFrom, sTo *ring.Ring, decomposition Decomposition, base uint32, seed []byte, prng ring.PRNG) (*SwitchingKey, error) {
+	gadget, err := fv.gadget(decomposition, base)
+	if err != nil {
+		return nil, err
+	}
+	ksk := &SwitchingKey{Decomposition: decomposition, Base: base, Value: make(EvaluationKey, len(gadget))}
+	tmp1, err := ring.NewRing(fv.N, fv.Q, fv.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	tmp2, err := ring.NewRing(fv.N, fv.Q, fv.NttParams)
+	if err != nil {
+		return nil, err
+	}
+
+	// with HybridDecomposition, sTo and the errors are lifted to P, where they keep their small coefficients
+	hybrid := decomposition == HybridDecomposition
+	var sToP, tmpP *ring.Ring
+	if hybrid {
+		ksk.ValueP = make(EvaluationKey, len(gadget))
+		if _, err = tmp1.Copy(sTo); err != nil {
+			return nil, err
+		}
+		tmp1.Poly.InverseNTT()
+		if sToP, err = fv.newSpecialRing(); err != nil {
+			return nil, err
+		}
+		if err = liftCentered(sToP, tmp1); err != nil {
+			return nil, err
+		}
+		sToP.Poly.NTT()
+		if tmpP, err = fv.newSpecialRing(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range ksk.Value {
+		// ksk[i][1] = a_i, where a_i expanded from the seed in R_q
+		ksk.Value[i][1], err = uniformFromSeed(tmp1, seed, uint32(i))
+		if err != nil {
+			return nil, err
+		}
+
+		// ksk[i][0] = -(a_i * sTo + e_i) + g_i * sFrom mod q
+		ksk.Value[i][0], err = ring.NewGaussPoly(prng, fv.N, fv.Q, fv.NttParams, fv.Gauss)
+		if err != nil {
+			return nil, err
+		}
+
+		if hybrid {
+			// kskP[i] = (-(a'_i * sTo + e_i), a'_i) mod P, with the same error e_i
+			ksk.ValueP[i][1], err = uniformFromSeed(tmpP, seed, uint32(len(gadget) + i))
+			if err != nil {
+				return nil, err
+			}
+			if ksk.ValueP[i][0], err = fv.newSpecialRing(); err != nil {
+				return nil, err
+			}
+			if err = liftCentered(ksk.ValueP[i][0], ksk.Value[i][0]); err != nil {
+				return nil, err
+			}
+			ksk.ValueP[i][0].Poly.NTT()
+			if _, err = tmpP.MulCoeffs(ksk.ValueP[i][1], sToP); err != nil {
+				return nil, err
+			}
+			ksk.ValueP[i][0].Sub(ksk.ValueP[i][0], tmpP)
+		}
+
+		ksk.Value[i][0].Poly.NTT()
+		if _, err = tmp1.MulCoeffs(ksk.Value[i][1], sTo); err != nil {
+			return nil, err
+		}
+		if _, err = tmp2.MulScalar(sFrom, gadget[i]); err != nil {
+			return nil, err
+		}
+		ksk.Value[i][0].Sub(ksk.Value[i][0], tmp1)
+		ksk.Value[i][0].Add(ksk.Value[i][0], tmp2)
+	}
+	return ksk, nil
+}
+
+// GenerateSwitchingKey generates the key switching ciphertexts decrypted with sFrom to ciphertexts decrypted with sTo,
+// e.g. to rotate the secret key. base is the bit length of the base of BitDecomposition, and is ignored otherwise.
+func GenerateSwitchingKey(fv *FVContext, sFrom, sTo *SecretKey, decomposition Decomposition, base uint32) (*SwitchingKey, error) {
+	prng, err := ring.NewPRNG()
+	if err != nil {
+		return nil, err
+	}
+	seed, err := newSeed(prng)
+	if err != nil {
+		return nil, err
+	}
+	return generateSwitchingKey(fv, sFrom.Value, sTo.Value, decomposition, base, seed, prng)
+}
+
+// decompose splits c, in coefficient form, into digits in coefficient form, such that sum g_i * digit_i = c
+func (evaluator *Evaluator) decompose(c *ring.Ring, decomposition Decomposition, base uint32) ([]*ring.Ring, error) {
+	ctx, err := evaluator.ctx.atLevel(c.Q)
+	if err != nil {
+		return nil, err
+	}
+	if c.IsNTT() {
+		return nil, errors.New("decomposed ring should be in coefficient form")
+	}
+	if decomposition == HybridDecomposition {
+		// the gadget vector of HybridDecomposition is the one of RNSDecomposition multiplied by P,
+		// which is divided out by keySwitch
+		if len(ctx.RNSParams.Moduli) < 2 {
+			digit, err := cloneRing(c)
+			if err != nil {
+				return nil, err
+			}
+			return []*ring.Ring{digit}, nil
+		}
+		decomposition = RNSDecomposition
+	}
+	gadget, err := ctx.gadget(decomposition, base)
+	if err != nil {
+		return nil, err
+	}
+	digits := make([]*ring.Ring, len(gadget))
+	for i := range digits {
+		if digits[i], err = ring.NewRing(ctx.N, ctx.Q, ctx.NttParams); err != nil {
+			return nil, err
+		}
+	}
+	switch decomposition {
+	case BitDecomposition:
+		rest, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = rest.Copy(c); err != nil {
+			return nil, err
+		}
+		mask := bigint.NewInt(1)
+		mask.Lsh(mask, base)
+		mask.Sub(mask, bigint.NewInt(1))
+		for i := range digits {
+			if _, err = digits[i].And(rest, *mask); err != nil {
+				return nil, err
+			}
+			rest.Rsh(rest, base)
+		}
+	case RNSDecomposition:
+		coeffs := c.GetCoefficients()
+		digitCoeffs := make([]bigint.Int, ctx.N)
+		for i := range digits {
+			for j := range coeffs {
+				digitCoeffs[j].Mod(&coeffs[j], &ctx.RNSParams.Moduli[i])
+			}
+			digits[i].Poly.SetCoefficients(digitCoeffs)
+		}
+	}
+	return digits, nil
+}
+
+// innerProduct sets (r0, r1), in NTT form, to the sum of digits[i] * (ksk[i][0], ksk[i][1]),
+// the digits being in NTT form
+func innerProduct(r0, r1 *ring.Ring, digits []*ring.Ring, ksk EvaluationKey) error {
+	if len(ksk) != len(digits) {
+		return errors.New("switching key does not match the decomposition")
+	}
+	tmp, err := ring.CopyRing(r0)
+	if err != nil {
+		return err
+	}
+	r0.Poly.NTT()
+	r1.Poly.NTT()
+	for i := range digits {
+		if _, err = tmp.MulCoeffs(digits[i], ksk[i][0]); err != nil {
+			return err
+		}
+		r0.Add(r0, tmp)
+
+		if _, err = tmp.MulCoeffs(digits[i], ksk[i][1]); err != nil {
+			return err
+		}
+		r1.Add(r1, tmp)
+	}
+	return nil
+}
+
+// keySwitch decomposes c, in coefficient form, and multiplies the digits with the switching key ksk,
+// so that (r0, r1), in NTT form, decrypts with sTo to c * sFrom. ksk has to be at the level of c.
+func (evaluator *Evaluator) keySwitch(c *ring.Ring, ksk *SwitchingKey) (*ring.Ring, *ring.Ring, error) {
+	ctx, err := evaluator.ctx.atLevel(c.Q)
+	if err != nil {
+		return nil, nil, err
+	}
+	digits, err := evaluator.decompose(c, ksk.Decomposition, ksk.Base)
+	if err != nil {
+		return nil, nil, err
+	}
+	r0, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	r1, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// with HybridDecomposition, the digits are also multiplied with the components modulo P
+	var digitsP []*ring.Ring
+	if ksk.Decomposition == HybridDecomposition {
+		digitsP = make([]*ring.Ring, len(digits))
+		for i := range digits {
+			if digitsP[i], err = ctx.newSpecialRing(); err != nil {
+				return nil, nil, err
+			}
+			if err = liftCentered(digitsP[i], digits[i]); err != nil {
+				return nil, nil, err
+			}
+			digitsP[i].Poly.NTT()
+		}
+	}
+	for i := range digits {
+		digits[i].Poly.NTT()
+	}
+	if err = innerProduct(r0, r1, digits, ksk.Value); err != nil {
+		return nil, nil, err
+	}
+	if digitsP == nil {
+		return r0, r1, nil
+	}
+
+	// (r0, r1) and (r0P, r1P) decrypt to P * c * sFrom modulo Q * P, which is divided by P:
+	// r = (r - r mod P) / P mod Q, r mod P being centered
+	r0P, err := ctx.newSpecialRing()
+	if err != nil {
+		return nil, nil, err
+	}
+	r1P, err := ctx.newSpecialRing()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = innerProduct(r0P, r1P, digitsP, ksk.ValueP); err != nil {
+		return nil, nil, err
+	}
+	tmp, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range [][2]*ring.Ring{{r0, r0P}, {r1, r1P}} {
+		r[1].Poly.InverseNTT()
+		if err = liftCentered(tmp, r[1]); err != nil {
+			return nil, nil, err
+		}
+		tmp.Poly.NTT()
+		r[0].Sub(r[0], tmp)
+		r[0].MulScalar(r[0], ctx.specialPInv)
+		r[0].Mod(r[0], ctx.Q)
+	}
+	return r0, r1, nil
+}
+
+// KeySwitch switches the ciphertext ct decrypted with sFrom to a ciphertext decrypted with sTo,
+// with the switching key ksk generated by GenerateSwitchingKey(fv, sFrom, sTo, ...)
+func (evaluator *Evaluator) KeySwitch(ct *Ciphertext, ksk *SwitchingKey) (*Ciphertext, error) {
+	ctx, err := evaluator.context(ct)
+	if err != nil {
+		return nil, err
+	}
+	if ksk, err = switchingKeyAt(ctx, ksk); err != nil {
+		return nil, err
+	}
+	return evaluator.switchCiphertext(ctx, ct, ksk)
+}
+
+// switchCiphertext switches the ciphertext ct of the level of ctx with ksk reduced to this level, see KeySwitch
+func (evaluator *Evaluator) switchCiphertext(ctx *FVContext, ct *Ciphertext, ksk *SwitchingKey) (*Ciphertext, error) {
+	c1, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c1.Copy(ct.value[1]); err != nil {
+		return nil, err
+	}
+	if _, err = c1.Poly.InverseNTT(); err != nil {
+		return nil, err
+	}
+	r0, r1, err := evaluator.keySwitch(c1, ksk)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewCiphertext(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.value[0].Add(ct.value[0], r0); err != nil {
+		return nil, err
+	}
+	c.value[1] = r1
+	c.noise = addLog(ct.noise, ctx.keySwitchNoise(ksk))
+	return c, nil
+}
@@ -0,0 +1,152 @@
+package crypto
+
+import (
+	"errors"
+	"math"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/ring"
+)
+
+// levelKey identifies a switching key of the evaluator reduced to a level
+type levelKey struct {
+	galois uint32  // galois element of the galois key, 0 for the relinearization key
+	level int
+}
+
+// reduceRing returns r, in either form, reduced modulo the ciphertext modulus of ctx, which has to divide the modulus of r.
+// The result takes the form of r.
+func reduceRing(ctx *FVContext, r *ring.Ring) (*ring.Ring, error) {
+	var rem bigint.Int
+	if rem.Mod(&r.Q, &ctx.Q); rem.Value.Sign() != 0 {
+		return nil, errors.New("modulus of the level should divide the modulus of the reduced ring")
+	}
+	tmp, err := cloneRing(r)
+	if err != nil {
+		return nil, err
+	}
+	if tmp.IsNTT() {
+		tmp.Poly.InverseNTT()
+	}
+	coeffs := make([]bigint.Int, ctx.N)
+	for i, c := range tmp.GetCoefficients() {
+		coeffs[i].Mod(&c, &ctx.Q)
+	}
+	reduced, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	if err = reduced.Poly.SetCoefficients(coeffs); err != nil {
+		return nil, err
+	}
+	if r.IsNTT() {
+		reduced.Poly.NTT()
+	}
+	return reduced, nil
+}
+
+// switchingKeyAt returns the switching key ksk reduced to the level of ctx.
+// The components of a switching key modulo Q are also switching keys modulo Q_l for the gadget vector reduced mod Q_l,
+// which is the one of Q_l for the first digits of BitDecomposition, and the first primes of RNSDecomposition
+// and HybridDecomposition.
+func switchingKeyAt(ctx *FVContext, ksk *SwitchingKey) (*SwitchingKey, error) {
+	if len(ksk.Value) == 0 {
+		return nil, errors.New("switching key does not match the decomposition")
+	}
+	if ksk.Value[0][0].Q.EqualTo(&ctx.Q) {
+		return ksk, nil
+	}
+	var l int
+	switch ksk.Decomposition {
+	case BitDecomposition:
+		l = decompositionLength(ctx.Q, ksk.Base)
+	default:
+		l = len(ctx.RNSParams.Moduli)
+	}
+	if l > len(ksk.Value) {
+		return nil, errors.New("switching key does not match the decomposition")
+	}
+	reduced := &SwitchingKey{Decomposition: ksk.Decomposition, Base: ksk.Base, Value: make(EvaluationKey, l)}
+	if ksk.ValueP != nil {
+		reduced.ValueP = ksk.ValueP[:l]
+	}
+	var err error
+	for i := range reduced.Value {
+		for j := range reduced.Value[i] {
+			if reduced.Value[i][j], err = reduceRing(ctx, ksk.Value[i][j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return reduced, nil
+}
+
+// ownKeyAt returns the switching key ksk of the evaluator, the relinearization key or the galois key
+// of galois element galois, reduced to the level of ctx. Only these keys are cached by the evaluator,
+// the caches of the galois keys being cleared by SetGaloisKeys.
+func (evaluator *Evaluator) ownKeyAt(ctx *FVContext, galois uint32, ksk *SwitchingKey) (*SwitchingKey, error) {
+	id := levelKey{galois, ctx.MaxLevel()}
+	if reduced, ok := evaluator.levelkeys[id]; ok {
+		return reduced, nil
+	}
+	reduced, err := switchingKeyAt(ctx, ksk)
+	if err != nil {
+		return nil, err
+	}
+	if reduced != ksk {
+		evaluator.levelkeys[id] = reduced
+	}
+	return reduced, nil
+}
+
+// ModSwitch switches the ciphertext ct from the modulus Q_l = q_0 * ... * q_l of its level to Q_(l-1),
+// i.e. drops the last prime q_l and divides the ciphertext by q_l with rounding.
+// The noise is divided by q_l as well, up to the rounding error, so that the noise budget is mostly kept
+// while the ciphertext gets smaller and cheaper to compute on.
+func (evaluator *Evaluator) ModSwitch(ct *Ciphertext) (*Ciphertext, error) {
+	ctx, err := evaluator.context(ct)
+	if err != nil {
+		return nil, err
+	}
+	level := ctx.MaxLevel()
+	if level == 0 {
+		return nil, errors.New("ciphertext is at the lowest level")
+	}
+	next := ctx.levels[level - 1]
+	q := ctx.RNSParams.Moduli[len(ctx.RNSParams.Moduli) - 1]
+	qDiv2 := bigint.NewInt(1)
+	qDiv2.Div(&q, bigint.NewInt(2))
+
+	c, err := NewCiphertext(next.N, next.Q, next.NttParams)
+	if err != nil {
+		return nil, err
+	}
+	coeffs := make([]bigint.Int, ctx.N)
+	var r bigint.Int
+	for i := range c.value {
+		tmp, err := cloneRing(ct.value[i])
+		if err != nil {
+			return nil, err
+		}
+		tmp.Poly.InverseNTT()
+		// round(x / q) = (x - [x]_q) / q, with [x]_q centered
+		for j, x := range tmp.GetCoefficients() {
+			r.Mod(&x, &q)
+			if r.Compare(qDiv2) == 1 {
+				r.Sub(&r, &q)
+			}
+			coeffs[j].Sub(&x, &r)
+			coeffs[j].Div(&coeffs[j], &q)
+			coeffs[j].Mod(&coeffs[j], &next.Q)
+		}
+		if err = c.value[i].Poly.SetCoefficients(coeffs); err != nil {
+			return nil, err
+		}
+		c.value[i].Poly.NTT()
+	}
+	// the noise is divided by q, the rounding adds T * (N + 1) / 2 and the rounding of Q_(l-1)/T to Delta T^2
+	if ct.noise != 0 {
+		t := float64(ctx.T.Int64())
+		c.noise = math.Log2(math.Exp2(ct.noise - log2(&q)) + t * float64(ctx.N + 1) / 2 + t * t)
+	}
+	return c, nil
+}
@@ -0,0 +1,168 @@
+package crypto
+
+import (
+	"math"
+	"math/big"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/ring"
+)
+
+// The noise of a ciphertext ct of plaintext m is measured by the invariant noise w = [T * (c0 + c1 * s)]_Q - Q * m,
+// i.e. Q times the distance between T/Q * (c0 + c1 * s) and m, and ct decrypts to m as long as ||w|| < Q/2.
+// The noise budget is the number of bits between ||w|| and Q/2, and decreases with homomorphic operations.
+// Ciphertexts also carry a heuristic bound on log2(||w||), updated by the evaluator, that estimates the
+// budget without the secret key. It is unknown for ciphertexts created by NewCiphertext or FVContext.Unmarshal,
+// and for the results of operations on them. The bounds assume secret keys of coefficients in {-1, 0, 1}.
+
+// gaussBound is the bound on the gaussian noise, in standard deviations
+const gaussBound = ring.GaussTail
+
+// log2 returns the base 2 logarithm of the positive integer x
+func log2(x *bigint.Int) float64 {
+	mant := new(big.Float)
+	exp := new(big.Float).SetInt(&x.Value).MantExp(mant)
+	m, _ := mant.Float64()
+	return float64(exp) + math.Log2(m)
+}
+
+// addLog returns log2(2^a + 2^b), or 0 if any of the noise bounds is unknown
+func addLog(a, b float64) float64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log2(1 + math.Exp2(b - a))
+}
+
+// mulLog returns log2(k * 2^a), or 0 if the noise bound a is unknown
+func mulLog(a float64, k float64) float64 {
+	if a == 0 {
+		return 0
+	}
+	return a + math.Log2(k)
+}
+
+// freshNoise returns the noise bound of a fresh encryption: the errors e, e1 and e2 of the public key and encryption
+// give T * (e * u + e1 + e2 * s), and the rounding of Q/T to Delta adds at most T^2
+func (fv *FVContext) freshNoise() float64 {
+	n := float64(fv.N)
+	t := float64(fv.T.Int64())
+	return math.Log2(t * (gaussBound * fv.Sigma * (2 * n + 1) + t))
+}
+
+// symmetricNoise returns the noise bound of a fresh encryption with the secret key: T * e,
+// and the rounding of Q/T to Delta adds at most T^2
+func (fv *FVContext) symmetricNoise() float64 {
+	t := float64(fv.T.Int64())
+	return math.Log2(t * (gaussBound * fv.Sigma + t))
+}
+
+// plainNoise returns the noise added by the wrapping of plaintexts mod T, i.e. the rounding of Q/T to Delta
+func (fv *FVContext) plainNoise() float64 {
+	return 2 * math.Log2(float64(fv.T.Int64()))
+}
+
+// scalarAbs returns the absolute value of the scalar k mod q, centered in (-q/2, q/2]
+func scalarAbs(k, q *bigint.Int) float64 {
+	var abs bigint.Int
+	abs.Neg(k, q)
+	if abs.Compare(k) == 1 {
+		abs.SetBigInt(k)
+	}
+	if abs.Value.Sign() == 0 {
+		return 0
+	}
+	return math.Exp2(log2(&abs))
+}
+
+// multiplyNoise returns the noise bound of the product of ciphertexts of noise bounds a and b, before relinearization.
+// With c_i(s) = Q/T * (m_i + v_i) + Q * k_i, the noise of the product is bounded by N * T * (N + 2) * (w_1 + w_2),
+// as ||k_i|| <= N + 1 for coefficients in [0, Q), and the scaling by T/Q adds a rounding error of T * N^2.
+func (fv *FVContext) multiplyNoise(a, b float64) float64 {
+	n := float64(fv.N)
+	t := float64(fv.T.Int64())
+	return addLog(mulLog(addLog(a, b), n * t * (n + 2)), math.Log2(t * n * n))
+}
+
+// keySwitchNoise returns the noise bound added by key switching with ksk, T * sum digit_i * e_i,
+// where the digits of the l components are bounded by the base of the decomposition.
+// With HybridDecomposition the sum is divided by P, and the division adds a rounding error of N + 1.
+func (fv *FVContext) keySwitchNoise(ksk *SwitchingKey) float64 {
+	n := float64(fv.N)
+	t := float64(fv.T.Int64())
+	l := float64(len(ksk.Value))
+	e := gaussBound * fv.Sigma
+	var digitBits float64
+	switch ksk.Decomposition {
+	case BitDecomposition:
+		digitBits = float64(ksk.Base)
+	case RNSDecomposition:
+		digitBits = fv.maxModulusLog()
+	case HybridDecomposition:
+		digitBits = fv.maxModulusLog() - log2(&fv.SpecialP)
+		return math.Log2(t * (l * n * e * math.Exp2(digitBits) + n + 1))
+	}
+	return math.Log2(t * l * n * e) + digitBits
+}
+
+// maxModulusLog returns the bit length of the largest prime of Q
+func (fv *FVContext) maxModulusLog() float64 {
+	max := 0.0
+	for i := range fv.RNSParams.Moduli {
+		max = math.Max(max, log2(&fv.RNSParams.Moduli[i]))
+	}
+	return max
+}
+
+// NoiseBudgetEstimate returns the noise budget of the ciphertext estimated from the heuristic bounds of
+// the evaluator, which is at most the one measured by Decryptor.InvariantNoiseBudget.
+// false is returned if the noise bound of the ciphertext is unknown.
+func (ciphertext *Ciphertext) NoiseBudgetEstimate() (int, bool) {
+	if ciphertext.noise == 0 {
+		return 0, false
+	}
+	b := int(math.Floor(log2(&ciphertext.value[0].Q) - ciphertext.noise - 1))
+	if b < 0 {
+		return 0, true
+	}
+	return b, true
+}
+
+// InvariantNoiseBudget measures the noise budget of the ciphertext in bits with the secret key,
+// it is 0 when the ciphertext does not decrypt correctly anymore.
+func (decryptor *Decryptor) InvariantNoiseBudget(ciphertext *Ciphertext) (int, error) {
+	ctx, sk, err := decryptor.secretKeyAt(ciphertext)
+	if err != nil {
+		return 0, err
+	}
+	w, err := ring.NewRing(ctx.N, ctx.Q, ctx.NttParams)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = w.MulCoeffs(ciphertext.value[1], sk); err != nil {
+		return 0, err
+	}
+	if _, err = w.Add(w, ciphertext.value[0]); err != nil {
+		return 0, err
+	}
+	w.Poly.InverseNTT()
+
+	// w = [T * (c0 + c1 * s)]_Q
+	w.MulScalar(w, ctx.T)
+	w.Mod(w, ctx.Q)
+	center(w)
+	var norm, abs bigint.Int
+	for _, c := range w.GetCoefficients() {
+		abs.Value.Abs(&c.Value)
+		if abs.Compare(&norm) == 1 {
+			norm.SetBigInt(&abs)
+		}
+	}
+	b := ctx.Q.Value.BitLen() - norm.Value.BitLen() - 1
+	if b < 0 {
+		return 0, nil
+	}
+	return b, nil
+}
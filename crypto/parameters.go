@@ -0,0 +1,237 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"github.com/dedis/lago/bigint"
+)
+
+// DefaultSigma is the standard deviation of the gaussian noise, suggested by SEAL library.
+const DefaultSigma = 3.19
+
+// parametersVersion is the version of the binary encoding of Parameters
+const parametersVersion = 1
+
+// IDSize is the byte length of the parameter ID, i.e. of the truncated parameter hash
+const IDSize = 8
+
+// Parameters is the set of values an FV context is derived from.
+// Two contexts built from equal parameters are identical, so parties only need to agree on the ID.
+type Parameters struct {
+	N uint32  // polynomial degree
+	T bigint.Int  // plaintext modulus
+	Q bigint.Int  // ciphertext modulus
+	Moduli []bigint.Int  // distinct primes whose product is Q, nil if Q is a prime
+	Sigma float64  // standard deviation of the gaussian noise
+}
+
+// parametersJSON is the JSON representation of Parameters, with the moduli as decimal strings
+type parametersJSON struct {
+	N uint32 `json:"n"`
+	T string `json:"t"`
+	Q string `json:"q"`
+	Moduli []string `json:"moduli,omitempty"`
+	Sigma float64 `json:"sigma"`
+}
+
+// NewParameters creates parameters with given degree and moduli, and the default noise DefaultSigma
+func NewParameters(N uint32, T, Q bigint.Int) *Parameters {
+	params := new(Parameters)
+	params.N = N
+	params.T.SetBigInt(&T)
+	params.Q.SetBigInt(&Q)
+	params.Sigma = DefaultSigma
+	return params
+}
+
+// NewRNSParameters creates parameters with given degree, plaintext modulus and ciphertext modulus Q,
+// the product of the moduli, and the default noise DefaultSigma
+func NewRNSParameters(N uint32, T bigint.Int, moduli []bigint.Int) *Parameters {
+	Q := bigint.NewInt(1)
+	for i := range moduli {
+		Q.Mul(Q, &moduli[i])
+	}
+	params := NewParameters(N, T, *Q)
+	if len(moduli) > 1 {
+		params.Moduli = make([]bigint.Int, len(moduli))
+		for i := range moduli {
+			params.Moduli[i].SetBigInt(&moduli[i])
+		}
+	}
+	return params
+}
+
+// QModuli returns the primes of the RNS basis of Q, i.e. Moduli, or Q itself if Moduli is nil
+func (params *Parameters) QModuli() []bigint.Int {
+	if len(params.Moduli) == 0 {
+		return []bigint.Int{params.Q}
+	}
+	return params.Moduli
+}
+
+// Equal checks if params and other describe the same context
+func (params *Parameters) Equal(other *Parameters) bool {
+	moduli, otherModuli := params.QModuli(), other.QModuli()
+	if len(moduli) != len(otherModuli) {
+		return false
+	}
+	for i := range moduli {
+		if !moduli[i].EqualTo(&otherModuli[i]) {
+			return false
+		}
+	}
+	return params.N == other.N && params.T.EqualTo(&other.T) && params.Q.EqualTo(&other.Q) && params.Sigma == other.Sigma
+}
+
+// MarshalBinary encodes params as a version byte, N, the bits of Sigma, T, the number of primes of Q and the primes,
+// the moduli being big-endian bytes prefixed by their length, all integers being big-endian.
+func (params *Parameters) MarshalBinary() ([]byte, error) {
+	moduli := params.QModuli()
+	values := []*bigint.Int{&params.T}
+	for i := range moduli {
+		values = append(values, &moduli[i])
+	}
+	for _, v := range values {
+		if v.Value.Sign() < 0 {
+			return nil, errors.New("moduli should be positive")
+		}
+	}
+	data := []byte{parametersVersion}
+	data = appendUint32(data, params.N)
+	var sigma [8]byte
+	binary.BigEndian.PutUint64(sigma[:], math.Float64bits(params.Sigma))
+	data = append(data, sigma[:]...)
+	for i, v := range values {
+		if i == 1 {
+			data = appendUint32(data, uint32(len(moduli)))
+		}
+		b := v.Value.Bytes()
+		data = appendUint32(data, uint32(len(b)))
+		data = append(data, b...)
+	}
+	return data, nil
+}
+
+// readInt reads a big-endian integer prefixed by its length from body and returns it with the rest of body
+func readInt(body []byte) (*bigint.Int, []byte, error) {
+	l, rest, err := readUint32(body)
+	if err != nil || uint64(len(rest)) < uint64(l) {
+		return nil, nil, ErrInvalidEncoding
+	}
+	v := new(bigint.Int)
+	v.Value.SetBytes(rest[:l])
+	return v, rest[l:], nil
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary into params
+func (params *Parameters) UnmarshalBinary(data []byte) error {
+	if len(data) < 13 {
+		return ErrInvalidEncoding
+	}
+	if data[0] != parametersVersion {
+		return fmt.Errorf("unsupported parameters version %d", data[0])
+	}
+	body := data[1:]
+	N, body, _ := readUint32(body)
+	sigma := math.Float64frombits(binary.BigEndian.Uint64(body))
+	body = body[8:]
+	T, body, err := readInt(body)
+	if err != nil {
+		return err
+	}
+	count, body, err := readUint32(body)
+	if err != nil || count == 0 || uint64(count) > uint64(len(body)) {
+		return ErrInvalidEncoding
+	}
+	moduli := make([]bigint.Int, count)
+	for i := range moduli {
+		var v *bigint.Int
+		if v, body, err = readInt(body); err != nil {
+			return err
+		}
+		moduli[i].SetBigInt(v)
+	}
+	if len(body) != 0 {
+		return ErrInvalidEncoding
+	}
+	*params = *NewRNSParameters(N, *T, moduli)
+	params.Sigma = sigma
+	return nil
+}
+
+// MarshalJSON encodes params as a JSON object with the moduli as decimal strings
+func (params *Parameters) MarshalJSON() ([]byte, error) {
+	var moduli []string
+	for i := range params.Moduli {
+		moduli = append(moduli, params.Moduli[i].Value.String())
+	}
+	return json.Marshal(parametersJSON{
+		N: params.N,
+		T: params.T.Value.String(),
+		Q: params.Q.Value.String(),
+		Moduli: moduli,
+		Sigma: params.Sigma,
+	})
+}
+
+// UnmarshalJSON decodes a JSON object produced by MarshalJSON into params
+func (params *Parameters) UnmarshalJSON(data []byte) error {
+	var p parametersJSON
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	var t, q bigint.Int
+	if _, ok := t.Value.SetString(p.T, 10); !ok {
+		return fmt.Errorf("invalid plaintext modulus %q", p.T)
+	}
+	if _, ok := q.Value.SetString(p.Q, 10); !ok {
+		return fmt.Errorf("invalid ciphertext modulus %q", p.Q)
+	}
+	if len(p.Moduli) == 1 {
+		return errors.New("a prime ciphertext modulus should have no moduli")
+	}
+	var moduli []bigint.Int
+	if len(p.Moduli) > 1 {
+		moduli = make([]bigint.Int, len(p.Moduli))
+		product := bigint.NewInt(1)
+		for i := range p.Moduli {
+			if _, ok := moduli[i].Value.SetString(p.Moduli[i], 10); !ok {
+				return fmt.Errorf("invalid ciphertext modulus prime %q", p.Moduli[i])
+			}
+			product.Mul(product, &moduli[i])
+		}
+		if !product.EqualTo(&q) {
+			return errors.New("ciphertext modulus should be the product of its primes")
+		}
+	}
+	params.N = p.N
+	params.T = t
+	params.Q = q
+	params.Moduli = moduli
+	params.Sigma = p.Sigma
+	return nil
+}
+
+// Hash returns the SHA-256 hash of the binary encoding of params, which is stable across processes,
+// or an error if params cannot be encoded
+func (params *Parameters) Hash() ([sha256.Size]byte, error) {
+	data, err := params.MarshalBinary()
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// ID returns the first IDSize bytes of Hash in hexadecimal, a short identifier of params
+func (params *Parameters) ID() (string, error) {
+	h, err := params.Hash()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h[:IDSize]), nil
+}
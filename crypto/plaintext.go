@@ -11,12 +11,12 @@ type Plaintext struct {
 }
 
 // NewPlaintext creates a Plaintext with given parameters.
-func NewPlaintext(n uint32, q bigint.Int, nttParams *polynomial.NttParams) *Plaintext {
+func NewPlaintext(n uint32, q bigint.Int, nttParams *polynomial.NttParams) (*Plaintext, error) {
 	plaintext := new(Plaintext)
 	err := *new(error)
 	plaintext.Value, err = ring.NewRing(n, q, nttParams)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return plaintext
+	return plaintext, nil
 }
@@ -0,0 +1,138 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/polynomial"
+)
+
+// SecurityLevel is a number of bits of classical security
+type SecurityLevel int
+
+const (
+	Security128 SecurityLevel = 128
+	Security192 SecurityLevel = 192
+	Security256 SecurityLevel = 256
+)
+
+// ErrInsecureParameters is returned when parameters do not reach the requested security level
+var ErrInsecureParameters = errors.New("parameters below the requested security level")
+
+// maxLogQ is the largest bit length of Q for each security level and degree N,
+// from the classical security tables of the HomomorphicEncryption.org standard
+// (http://homomorphicencryption.org/standard/) for a noise standard deviation of about 3.2.
+var maxLogQ = map[SecurityLevel]map[uint32]int{
+	Security128: {1024: 27, 2048: 54, 4096: 109, 8192: 218, 16384: 438, 32768: 881},
+	Security192: {1024: 19, 2048: 37, 4096: 75, 8192: 152, 16384: 305, 32768: 611},
+	Security256: {1024: 14, 2048: 29, 4096: 58, 8192: 118, 16384: 237, 32768: 476},
+}
+
+// MaxLogQ returns the largest bit length of Q giving the security level with degree N
+func MaxLogQ(N uint32, level SecurityLevel) (int, error) {
+	table, ok := maxLogQ[level]
+	if !ok {
+		return 0, fmt.Errorf("unknown security level %d", level)
+	}
+	logQ, ok := table[N]
+	if !ok {
+		return 0, fmt.Errorf("no security estimate for degree %d", N)
+	}
+	return logQ, nil
+}
+
+// EstimateSecurity returns the highest security level reached by params, or 0 if none is reached,
+// e.g. to warn about custom parameters.
+func EstimateSecurity(params *Parameters) SecurityLevel {
+	for _, level := range []SecurityLevel{Security256, Security192, Security128} {
+		if ValidateSecurity(params, level) == nil {
+			return level
+		}
+	}
+	return 0
+}
+
+// ValidateSecurity checks that params reach the security level, and returns an error wrapping
+// ErrInsecureParameters otherwise. The noise has to be at least DefaultSigma and the bit length of Q
+// at most MaxLogQ. The tables of the standard assume a ternary secret, the default of GenerateKey:
+// keys with another SecretDistribution may not reach the level.
+func ValidateSecurity(params *Parameters, level SecurityLevel) error {
+	logQ, err := MaxLogQ(params.N, level)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInsecureParameters, err)
+	}
+	if params.Sigma < DefaultSigma {
+		return fmt.Errorf("%w: sigma %v is smaller than %v", ErrInsecureParameters, params.Sigma, DefaultSigma)
+	}
+	if params.Q.Value.BitLen() > logQ {
+		return fmt.Errorf("%w: log Q = %d exceeds %d for N = %d and %d-bit security",
+			ErrInsecureParameters, params.Q.Value.BitLen(), logQ, params.N, level)
+	}
+	return nil
+}
+
+// NewFVContextWithSecurity creates an FV context from params, and refuses params below the security level
+func NewFVContextWithSecurity(params *Parameters, level SecurityLevel) (*FVContext, error) {
+	if err := ValidateSecurity(params, level); err != nil {
+		return nil, err
+	}
+	return NewFVContextFromParameters(params)
+}
+
+// Preset is the name of a standard parameter set
+type Preset string
+
+// Presets of 128-bit classical security, with plaintext modulus 65537.
+// Q is the product of the fewest NTT-friendly primes of at most bigint.ModulusMaxBitLen bits
+// whose bit lengths sum to the largest log Q allowed by the standard.
+const (
+	PN2048 Preset = "FV-N2048-128"
+	PN4096 Preset = "FV-N4096-128"
+	PN8192 Preset = "FV-N8192-128"
+	PN16384 Preset = "FV-N16384-128"
+)
+
+// presetDegrees is the degree N of each preset
+var presetDegrees = map[Preset]uint32{
+	PN2048: 2048,
+	PN4096: 4096,
+	PN8192: 8192,
+	PN16384: 16384,
+}
+
+// presetT is the plaintext modulus of the presets, a prime equal to 1 mod 2N for all of them
+const presetT = 65537
+
+// Presets returns the names of all presets, in increasing degree
+func Presets() []Preset {
+	return []Preset{PN2048, PN4096, PN8192, PN16384}
+}
+
+// Parameters returns the parameters of the preset
+func (preset Preset) Parameters() (*Parameters, error) {
+	N, ok := presetDegrees[preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q", preset)
+	}
+	logQ, err := MaxLogQ(N, Security128)
+	if err != nil {
+		return nil, err
+	}
+	// the primes have bit length logQ / count, the first logQ % count ones one more bit,
+	// so that the bit length of their product is at most logQ
+	count := (logQ - 1) / bigint.ModulusMaxBitLen + 1
+	moduli := make([]bigint.Int, 0, count)
+	if extra := logQ % count; extra > 0 {
+		primes, err := polynomial.GenerateNTTPrimes(N, uint32(logQ / count + 1), extra)
+		if err != nil {
+			return nil, err
+		}
+		moduli = append(moduli, primes...)
+	}
+	primes, err := polynomial.GenerateNTTPrimes(N, uint32(logQ / count), count - len(moduli))
+	if err != nil {
+		return nil, err
+	}
+	moduli = append(moduli, primes...)
+	return NewRNSParameters(N, *bigint.NewInt(presetT), moduli), nil
+}
@@ -0,0 +1,560 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/polynomial"
+	"github.com/dedis/lago/ring"
+)
+
+// The binary encoding of ciphertexts, plaintexts and keys starts with a header of
+// one byte for the format version, one byte for the object type and fingerprintSize bytes for the
+// parameter fingerprint, followed by the rings encoded by ring.MarshalBinary, i.e. with fixed-width coefficients.
+const serializationVersion = 1
+
+const fingerprintSize = IDSize
+
+const headerSize = 2 + fingerprintSize
+
+// object types of the encoding
+const (
+	tagCiphertext byte = iota + 1
+	tagPlaintext
+	tagPublicKey
+	tagSecretKey
+	tagEvaluationKey
+	tagKey
+	tagSeededCiphertext
+	tagSeededKey
+	tagSeededPublicKey
+)
+
+// ErrInvalidEncoding is returned when decoding data that was not produced by FVContext.Marshal
+var ErrInvalidEncoding = errors.New("invalid binary encoding")
+
+// Serializable is implemented by the ciphertexts, plaintexts and keys encoded by FVContext.Marshal
+type Serializable interface {
+	marshal(fv *FVContext) ([]byte, error)
+	unmarshal(fv *FVContext, data []byte) error
+}
+
+// Marshal encodes v, whose rings have the parameters of a level of the context,
+// with the parameter fingerprint of this level.
+func (fv *FVContext) Marshal(v Serializable) ([]byte, error) {
+	return v.marshal(fv)
+}
+
+// Unmarshal decodes data into v, which has to be created with the parameters of the encoded object,
+// a level of the context, otherwise polynomial.ErrParamMismatch is returned.
+func (fv *FVContext) Unmarshal(data []byte, v Serializable) error {
+	return v.unmarshal(fv, data)
+}
+
+// levelOf returns the context of the level of ring r, whose parameter fingerprint is the first fingerprintSize
+// bytes of the Hash of the parameters of the level, which covers every parameter of the level.
+func (fv *FVContext) levelOf(r *ring.Ring) (*FVContext, error) {
+	if r.N != fv.N {
+		return nil, polynomial.ErrParamMismatch
+	}
+	return fv.atLevel(r.Q)
+}
+
+// marshalRings encodes the header of type tag, the body prefix and the rings, which have the same parameters
+func marshalRings(fv *FVContext, tag byte, prefix []byte, rings []*ring.Ring) ([]byte, error) {
+	if len(rings) == 0 {
+		return nil, errors.New("cannot marshal an empty object")
+	}
+	for _, r := range rings {
+		if r == nil || r.Poly == nil {
+			return nil, errors.New("cannot marshal an uninitialized object")
+		}
+		if r.N != rings[0].N || r.Q.Compare(&rings[0].Q) != 0 {
+			return nil, polynomial.ErrParamMismatch
+		}
+	}
+	level, err := fv.levelOf(rings[0])
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(serializationVersion)
+	buf.WriteByte(tag)
+	buf.Write(level.id[:fingerprintSize])
+	buf.Write(prefix)
+	for _, r := range rings {
+		data, err := r.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// checkHeader checks the header of data against type tag and the parameters of template r, a ring of a level of fv,
+// and returns the body of data
+func checkHeader(fv *FVContext, data []byte, tag byte, r *ring.Ring) ([]byte, error) {
+	if len(data) < headerSize {
+		return nil, ErrInvalidEncoding
+	}
+	if data[0] != serializationVersion {
+		return nil, fmt.Errorf("unsupported serialization version %d", data[0])
+	}
+	if data[1] != tag {
+		return nil, ErrInvalidEncoding
+	}
+	if r == nil || r.Poly == nil {
+		return nil, errors.New("cannot unmarshal into an uninitialized object")
+	}
+	level, err := fv.levelOf(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(data[2:headerSize], level.id[:fingerprintSize]) {
+		return nil, polynomial.ErrParamMismatch
+	}
+	return data[headerSize:], nil
+}
+
+// unmarshalRings decodes the body of data into the rings, the whole body has to be consumed.
+// The rings are only updated if the whole body is valid.
+func unmarshalRings(body []byte, rings []*ring.Ring) error {
+	decoded := make([]*ring.Ring, len(rings))
+	for i, r := range rings {
+		if r == nil || r.Poly == nil {
+			return errors.New("cannot unmarshal into an uninitialized object")
+		}
+		size := r.BinarySize()
+		if len(body) < size {
+			return ErrInvalidEncoding
+		}
+		tmp, err := ring.CopyRing(r)
+		if err != nil {
+			return err
+		}
+		if err = tmp.UnmarshalBinary(body[:size]); err != nil {
+			return err
+		}
+		decoded[i] = tmp
+		body = body[size:]
+	}
+	if len(body) != 0 {
+		return ErrInvalidEncoding
+	}
+	for i, r := range rings {
+		if _, err := r.Poly.Copy(decoded[i].Poly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readUint32 reads a big-endian uint32 prefix from body and returns it with the rest of body
+func readUint32(body []byte) (uint32, []byte, error) {
+	if len(body) < 4 {
+		return 0, nil, ErrInvalidEncoding
+	}
+	return binary.BigEndian.Uint32(body), body[4:], nil
+}
+
+// appendUint32 appends v in big-endian to b
+func appendUint32(b []byte, v uint32) []byte {
+	var tmp [4]byte
+	binary.BigEndian.PutUint32(tmp[:], v)
+	return append(b, tmp[:]...)
+}
+
+// marshal encodes the ciphertext with the parameter fingerprint of its rings.
+// The ciphertexts of SymmetricEncryptor are encoded with the seed of their second ring instead of the ring.
+func (ciphertext *Ciphertext) marshal(fv *FVContext) ([]byte, error) {
+	if ciphertext.seed != nil {
+		data, err := marshalRings(fv, tagSeededCiphertext, nil, ciphertext.value[:1])
+		if err != nil {
+			return nil, err
+		}
+		return append(data, ciphertext.seed...), nil
+	}
+	return marshalRings(fv, tagCiphertext, nil, ciphertext.value[:])
+}
+
+// unmarshal decodes data into the ciphertext, which has to be created by NewCiphertext
+// with the parameters of the encoded one, otherwise polynomial.ErrParamMismatch is returned.
+// The noise estimate of the decoded ciphertext is unknown.
+func (ciphertext *Ciphertext) unmarshal(fv *FVContext, data []byte) error {
+	ciphertext.noise = 0
+	if len(data) > 1 && data[1] == tagSeededCiphertext {
+		body, err := checkHeader(fv, data, tagSeededCiphertext, ciphertext.value[0])
+		if err != nil {
+			return err
+		}
+		if len(body) < ring.SeedSize {
+			return ErrInvalidEncoding
+		}
+		seed := body[len(body) - ring.SeedSize:]
+		if err = unmarshalRings(body[:len(body) - ring.SeedSize], ciphertext.value[:1]); err != nil {
+			return err
+		}
+		r := ciphertext.value[0]
+		a, err := ring.NewUniformPolyFromSeed(r.N, r.Q, r.Poly.GetNTTParams(), seed)
+		if err != nil {
+			return err
+		}
+		a.Poly.NTT()
+		ciphertext.value[1] = a
+		ciphertext.seed = append([]byte(nil), seed...)
+		return nil
+	}
+	body, err := checkHeader(fv, data, tagCiphertext, ciphertext.value[0])
+	if err != nil {
+		return err
+	}
+	ciphertext.seed = nil
+	return unmarshalRings(body, ciphertext.value[:])
+}
+
+// marshal encodes the plaintext with the parameter fingerprint of its ring
+func (plaintext *Plaintext) marshal(fv *FVContext) ([]byte, error) {
+	return marshalRings(fv, tagPlaintext, nil, []*ring.Ring{plaintext.Value})
+}
+
+// unmarshal decodes data into the plaintext, which has to be created by NewPlaintext
+// with the parameters of the encoded one, otherwise polynomial.ErrParamMismatch is returned.
+func (plaintext *Plaintext) unmarshal(fv *FVContext, data []byte) error {
+	body, err := checkHeader(fv, data, tagPlaintext, plaintext.Value)
+	if err != nil {
+		return err
+	}
+	return unmarshalRings(body, []*ring.Ring{plaintext.Value})
+}
+
+// marshal encodes the public key with the parameter fingerprint of its rings
+func (pk *PublicKey) marshal(fv *FVContext) ([]byte, error) {
+	return marshalRings(fv, tagPublicKey, nil, pk[:])
+}
+
+// unmarshal decodes data into the public key, which has to be created by NewPublicKey
+// with the parameters of the encoded one, otherwise polynomial.ErrParamMismatch is returned.
+func (pk *PublicKey) unmarshal(fv *FVContext, data []byte) error {
+	body, err := checkHeader(fv, data, tagPublicKey, pk[0])
+	if err != nil {
+		return err
+	}
+	return unmarshalRings(body, pk[:])
+}
+
+// marshal encodes the secret key with the parameter fingerprint of its ring
+func (sk *SecretKey) marshal(fv *FVContext) ([]byte, error) {
+	return marshalRings(fv, tagSecretKey, nil, []*ring.Ring{sk.Value})
+}
+
+// unmarshal decodes data into the secret key, which has to be created by NewSecretKey
+// with the parameters of the encoded one, otherwise polynomial.ErrParamMismatch is returned.
+func (sk *SecretKey) unmarshal(fv *FVContext, data []byte) error {
+	body, err := checkHeader(fv, data, tagSecretKey, sk.Value)
+	if err != nil {
+		return err
+	}
+	return unmarshalRings(body, []*ring.Ring{sk.Value})
+}
+
+// rings returns the rings of the evaluation key in order
+func (evk EvaluationKey) rings() []*ring.Ring {
+	rings := make([]*ring.Ring, 0, 2 * len(evk))
+	for i := range evk {
+		rings = append(rings, evk[i][0], evk[i][1])
+	}
+	return rings
+}
+
+// resize sets the evaluation key to l pairs of rings with the parameters of template r
+func (evk *EvaluationKey) resize(l uint32, r *ring.Ring) error {
+	if int(l) == len(*evk) {
+		return nil
+	}
+	if l == 0 || l > uint32(r.Q.Value.BitLen()) {
+		return ErrInvalidEncoding
+	}
+	keys := make(EvaluationKey, l)
+	for i := range keys {
+		for j := range keys[i] {
+			tmp, err := ring.CopyRing(r)
+			if err != nil {
+				return err
+			}
+			keys[i][j] = tmp
+		}
+	}
+	*evk = keys
+	return nil
+}
+
+// template returns the first ring of the evaluation key, or nil for an empty key
+func (evk EvaluationKey) template() *ring.Ring {
+	if len(evk) == 0 {
+		return nil
+	}
+	return evk[0][0]
+}
+
+// marshal encodes the evaluation key as the number of its pairs of rings followed by the rings
+func (evk *EvaluationKey) marshal(fv *FVContext) ([]byte, error) {
+	return marshalRings(fv, tagEvaluationKey, appendUint32(nil, uint32(len(*evk))), evk.rings())
+}
+
+// unmarshal decodes data into the evaluation key, which has to be created by NewEvaluationKey
+// with the parameters of the encoded one, otherwise polynomial.ErrParamMismatch is returned.
+// The evaluation key is resized if it was created with a different decomposition base.
+func (evk *EvaluationKey) unmarshal(fv *FVContext, data []byte) error {
+	template := evk.template()
+	body, err := checkHeader(fv, data, tagEvaluationKey, template)
+	if err != nil {
+		return err
+	}
+	l, body, err := readUint32(body)
+	if err != nil {
+		return err
+	}
+	// a resized key only replaces evk if the whole data is valid
+	keys := *evk
+	if err = keys.resize(l, template); err != nil {
+		return err
+	}
+	if err = unmarshalRings(body, keys.rings()); err != nil {
+		return err
+	}
+	*evk = keys
+	return nil
+}
+
+// firstRings returns the first rings of the pairs of the evaluation key in order
+func (evk EvaluationKey) firstRings() []*ring.Ring {
+	rings := make([]*ring.Ring, len(evk))
+	for i := range evk {
+		rings[i] = evk[i][0]
+	}
+	return rings
+}
+
+// marshal encodes the key as the decomposition base exponent EvaSize, the decomposition and the number of
+// pairs of the evaluation key, followed by the rings of the public key, secret key and evaluation key.
+// With HybridDecomposition, the special prime P, prefixed by its byte length, follows the number of pairs,
+// and the rings of EvaKeyP modulo P follow the other rings.
+// Keys with a Seed are encoded with the seed after the prefix instead of their uniform components,
+// i.e. without PubKey[1] and the second rings of the pairs of EvaKey and EvaKeyP.
+func (key *Key) marshal(fv *FVContext) ([]byte, error) {
+	if key.Seed != nil {
+		return key.encode(fv, tagSeededKey)
+	}
+	return key.encode(fv, tagKey)
+}
+
+// MarshalPublic encodes the key like Marshal without its secret key, e.g. to send the public and
+// evaluation keys to the party evaluating on the ciphertexts. The key needs a Seed.
+func (fv *FVContext) MarshalPublic(key *Key) ([]byte, error) {
+	if key.Seed == nil {
+		return nil, errors.New("public encoding needs a key with a seed")
+	}
+	return key.encode(fv, tagSeededPublicKey)
+}
+
+// encode encodes the key with the object type tag, see marshal
+func (key *Key) encode(fv *FVContext, tag byte) ([]byte, error) {
+	seeded := tag != tagKey
+	prefix := appendUint32(nil, key.EvaSize)
+	prefix = appendUint32(prefix, uint32(key.EvaDecomposition))
+	prefix = appendUint32(prefix, uint32(len(key.EvaKey)))
+	hybrid := key.EvaDecomposition == HybridDecomposition
+	if hybrid {
+		template := key.EvaKeyP.template()
+		if template == nil || len(key.EvaKeyP) != len(key.EvaKey) {
+			return nil, errors.New("cannot marshal an uninitialized object")
+		}
+		p := template.Q.Value.Bytes()
+		prefix = appendUint32(prefix, uint32(len(p)))
+		prefix = append(prefix, p...)
+	}
+	rings := key.PubKey[:]
+	evkRings := key.EvaKey.rings
+	evkPRings := key.EvaKeyP.rings
+	if seeded {
+		if len(key.Seed) != ring.SeedSize {
+			return nil, errors.New("key seed should have ring.SeedSize bytes")
+		}
+		prefix = append(prefix, key.Seed...)
+		rings = []*ring.Ring{key.PubKey[0]}
+		evkRings = key.EvaKey.firstRings
+		evkPRings = key.EvaKeyP.firstRings
+	}
+	if tag != tagSeededPublicKey {
+		rings = append(rings, key.SecKey.Value)
+	}
+	data, err := marshalRings(fv, tag, prefix, append(rings, evkRings()...))
+	if err != nil || !hybrid {
+		return data, err
+	}
+	for _, r := range evkPRings() {
+		if r == nil || r.Poly == nil {
+			return nil, errors.New("cannot marshal an uninitialized object")
+		}
+		if r.N != key.EvaKeyP.template().N || !r.Q.EqualTo(&key.EvaKeyP.template().Q) {
+			return nil, polynomial.ErrParamMismatch
+		}
+		ringData, err := r.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, ringData...)
+	}
+	return data, nil
+}
+
+// unmarshal decodes data into the key, which has to be created by NewKey
+// with the parameters of the encoded one, otherwise polynomial.ErrParamMismatch is returned.
+// The uniform components of a seeded encoding are expanded from its seed.
+func (key *Key) unmarshal(fv *FVContext, data []byte) error {
+	if len(data) > 1 && data[1] == tagSeededKey {
+		return key.decode(fv, data, tagSeededKey)
+	}
+	return key.decode(fv, data, tagKey)
+}
+
+// UnmarshalPublic decodes data encoded by MarshalPublic into the key, which has to be created by NewKey
+// with the parameters of the encoded one, otherwise polynomial.ErrParamMismatch is returned.
+// The secret key is left unchanged.
+func (fv *FVContext) UnmarshalPublic(data []byte, key *Key) error {
+	return key.decode(fv, data, tagSeededPublicKey)
+}
+
+// decode decodes data of object type tag into the key, see unmarshal.
+// The key is decoded into new rings, and only updated if the whole data is valid.
+func (key *Key) decode(fv *FVContext, data []byte, tag byte) error {
+	seeded := tag != tagKey
+	template := key.PubKey[0]
+	body, err := checkHeader(fv, data, tag, template)
+	if err != nil {
+		return err
+	}
+	level, err := fv.levelOf(template)
+	if err != nil {
+		return err
+	}
+	evaSize, body, err := readUint32(body)
+	if err != nil {
+		return err
+	}
+	decomposition, body, err := readUint32(body)
+	if err != nil {
+		return err
+	}
+	l, body, err := readUint32(body)
+	if err != nil {
+		return err
+	}
+	switch Decomposition(decomposition) {
+	case BitDecomposition:
+		if evaSize == 0 || int(l) != decompositionLength(template.Q, evaSize) {
+			return ErrInvalidEncoding
+		}
+	case RNSDecomposition, HybridDecomposition:
+		// one pair of rings for each prime of Q
+		if int(l) != len(level.RNSParams.Moduli) {
+			return ErrInvalidEncoding
+		}
+	default:
+		return ErrInvalidEncoding
+	}
+	decoded := &Key{EvaSize: evaSize, EvaDecomposition: Decomposition(decomposition), SecKey: key.SecKey}
+	for i := range decoded.PubKey {
+		if decoded.PubKey[i], err = ring.CopyRing(template); err != nil {
+			return err
+		}
+	}
+	if tag != tagSeededPublicKey {
+		if decoded.SecKey.Value, err = ring.CopyRing(template); err != nil {
+			return err
+		}
+	}
+	if err = decoded.EvaKey.resize(l, template); err != nil {
+		return err
+	}
+	hybrid := decoded.EvaDecomposition == HybridDecomposition
+	if hybrid {
+		if decoded.EvaKeyP, body, err = readSpecialKey(body, level, l, nil); err != nil {
+			return err
+		}
+	}
+	rings := decoded.PubKey[:]
+	evkRings := decoded.EvaKey.rings
+	evkPRings := decoded.EvaKeyP.rings
+	if seeded {
+		if len(body) < ring.SeedSize {
+			return ErrInvalidEncoding
+		}
+		decoded.Seed = append([]byte(nil), body[:ring.SeedSize]...)
+		body = body[ring.SeedSize:]
+		rings = []*ring.Ring{decoded.PubKey[0]}
+		evkRings = decoded.EvaKey.firstRings
+		evkPRings = decoded.EvaKeyP.firstRings
+	}
+	if tag != tagSeededPublicKey {
+		rings = append(rings, decoded.SecKey.Value)
+	}
+	rings = append(rings, evkRings()...)
+	if hybrid {
+		// the rings modulo P follow the rings modulo Q
+		size := 0
+		for _, r := range rings {
+			size += r.BinarySize()
+		}
+		if len(body) < size {
+			return ErrInvalidEncoding
+		}
+		if err = unmarshalRings(body[size:], evkPRings()); err != nil {
+			return err
+		}
+		body = body[:size]
+	}
+	if err = unmarshalRings(body, rings); err != nil {
+		return err
+	}
+	if seeded {
+		if err = decoded.expandSeed(); err != nil {
+			return err
+		}
+	}
+	*key = *decoded
+	return nil
+}
+
+// readSpecialKey reads the special prime P of HybridDecomposition, prefixed by its byte length, from body,
+// and returns evk, or a new evaluation key if evk has another modulus, resized to l pairs of rings modulo P.
+// P has to be the special prime of fv, the context of the level of the key.
+func readSpecialKey(body []byte, fv *FVContext, l uint32, evk EvaluationKey) (EvaluationKey, []byte, error) {
+	size, body, err := readUint32(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if size == 0 || size > bigint.ModulusMaxBitLen / 8 + 1 || uint32(len(body)) < size {
+		return nil, nil, ErrInvalidEncoding
+	}
+	var p bigint.Int
+	p.Value.SetBytes(body[:size])
+	body = body[size:]
+	if !p.EqualTo(&fv.SpecialP) {
+		return nil, nil, polynomial.ErrParamMismatch
+	}
+	template := evk.template()
+	if template == nil || template.N != fv.N || !template.Q.EqualTo(&p) {
+		if template, err = ring.NewRing(fv.N, p, fv.specialNttParams); err != nil {
+			return nil, nil, err
+		}
+		evk = nil
+	}
+	if err = evk.resize(l, template); err != nil {
+		return nil, nil, err
+	}
+	return evk, body, nil
+}
@@ -0,0 +1,98 @@
+package encoding
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/crypto"
+	"github.com/dedis/lago/polynomial"
+)
+
+// BatchEncoder packs N integers mod T into the slots of one plaintext, i.e. the evaluations of
+// the plaintext polynomial at the 2N-th primitive roots of unity mod T, so that the addition
+// and multiplication of ciphertexts act slot-wise. T has to be a prime equal to 1 mod 2N.
+// The slots form a 2 x N/2 matrix: slot i of row 0 is the evaluation at psi^(3^i),
+// and slot i of row 1 at psi^(-3^i), so that the automorphisms X -> X^3 and X -> X^-1
+// rotate the rows and swap them.
+type BatchEncoder struct {
+	N uint32
+	T bigint.Int
+	nttParams *polynomial.NttParams // NTT params over T
+	indexMap []uint32 // index of the NTT form of each slot
+}
+
+// NewBatchEncoder creates a BatchEncoder, polynomial.ErrModulusNotNTTFriendly is returned
+// if the plaintext modulus of ctx is not a prime equal to 1 mod 2N.
+func NewBatchEncoder(ctx *crypto.FVContext) (*BatchEncoder, error) {
+	nttParams, err := polynomial.GenerateNTTParams(ctx.N, ctx.T)
+	if err != nil {
+		return nil, err
+	}
+	encoder := new(BatchEncoder)
+	encoder.N = ctx.N
+	encoder.T.SetBigInt(&ctx.T)
+	encoder.nttParams = nttParams
+	encoder.indexMap = make([]uint32, ctx.N)
+	rowSize := ctx.N / 2
+	m := 2 * ctx.N
+	pos := uint32(1)
+	for i := uint32(0); i < rowSize; i++ {
+		encoder.indexMap[i] = polynomial.EvaluationIndex(ctx.N, pos)
+		encoder.indexMap[rowSize + i] = polynomial.EvaluationIndex(ctx.N, m - pos)
+		pos = pos * 3 % m
+	}
+	return encoder, nil
+}
+
+// SlotCount returns the number of integers packed in a plaintext
+func (encoder *BatchEncoder) SlotCount() uint32 {
+	return encoder.N
+}
+
+// Encode packs at most N values into plaintext, the values are reduced mod T
+// and the remaining slots are set to zero.
+func (encoder *BatchEncoder) Encode(values []bigint.Int, plaintext *crypto.Plaintext) error {
+	if uint32(len(values)) > encoder.N {
+		return errors.New("too many values for the slots of the plaintext")
+	}
+	p, err := polynomial.NewPolynomial(encoder.N, encoder.T, encoder.nttParams)
+	if err != nil {
+		return err
+	}
+	p.NTT()
+	slots := make([]bigint.Int, encoder.N)
+	for i := range values {
+		slots[encoder.indexMap[i]].Mod(&values[i], &encoder.T)
+	}
+	p.SetCoefficients(slots)
+	p.InverseNTT()
+	if plaintext.Value.Poly.IsNTT() {
+		plaintext.Value.Poly.InverseNTT()
+	}
+	return plaintext.Value.Poly.SetCoefficients(p.GetCoefficients())
+}
+
+// Decode unpacks the N values of the slots of plaintext, in [0, T)
+func (encoder *BatchEncoder) Decode(plaintext *crypto.Plaintext) ([]bigint.Int, error) {
+	if plaintext.Value.N != encoder.N {
+		return nil, polynomial.ErrParamMismatch
+	}
+	if plaintext.Value.Poly.IsNTT() {
+		return nil, errors.New("plaintext should be in coefficient form")
+	}
+	p, err := polynomial.NewPolynomial(encoder.N, encoder.T, encoder.nttParams)
+	if err != nil {
+		return nil, err
+	}
+	coeffs := make([]bigint.Int, encoder.N)
+	for i, c := range plaintext.Value.GetCoefficients() {
+		coeffs[i].Mod(&c, &encoder.T)
+	}
+	p.SetCoefficients(coeffs)
+	p.NTT()
+	slots := p.GetCoefficients()
+	values := make([]bigint.Int, encoder.N)
+	for i := range values {
+		values[i].SetBigInt(&slots[encoder.indexMap[i]])
+	}
+	return values, nil
+}
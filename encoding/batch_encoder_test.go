@@ -0,0 +1,170 @@
+package encoding
+
+import (
+	"testing"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/crypto"
+	"github.com/dedis/lago/polynomial"
+	"github.com/dedis/lago/ring"
+)
+
+// newTestContext creates a context of degree 16 and plaintext modulus T = 97, a prime equal to 1 mod 2N,
+// with a 60-bit Q leaving room for a multiplication, and keys generated from seed for reproducible tests
+func newTestContext(t *testing.T, seed string) (*crypto.FVContext, *crypto.Key) {
+	primes, err := polynomial.GenerateNTTPrimes(16, 60, 1)
+	if err != nil {
+		t.Fatalf("Error in GenerateNTTPrimes: %v", err)
+	}
+	fv, err := crypto.NewFVContextFromParameters(crypto.NewParameters(16, *bigint.NewInt(97), primes[0]))
+	if err != nil {
+		t.Fatalf("Error in NewFVContextFromParameters: %v", err)
+	}
+	key, err := crypto.GenerateKeyWithPRNG(fv, crypto.BitDecomposition, 1, ring.NewXOF([]byte(seed)))
+	if err != nil {
+		t.Fatalf("Error in GenerateKeyWithPRNG: %v", err)
+	}
+	return fv, key
+}
+
+// checkBudget fails the test if the ciphertext has no noise budget left, i.e. if it may decrypt wrongly
+func checkBudget(t *testing.T, decryptor *crypto.Decryptor, ciphertext *crypto.Ciphertext, op string) {
+	budget, err := decryptor.InvariantNoiseBudget(ciphertext)
+	if err != nil {
+		t.Fatalf("Error in InvariantNoiseBudget after %v: %v", op, err)
+	}
+	if budget <= 0 {
+		t.Fatalf("Error in %v: no noise budget left", op)
+	}
+}
+
+// Test that the evaluator acts slot-wise on batched plaintexts
+func TestBatchEncoder(t *testing.T) {
+	fv, key := newTestContext(t, "batch encoder")
+	encoder, err := NewBatchEncoder(fv)
+	if err != nil {
+		t.Fatalf("Error in NewBatchEncoder: %v", err)
+	}
+	n := encoder.SlotCount()
+	values1 := make([]bigint.Int, n)
+	values2 := make([]bigint.Int, n)
+	for i := range values1 {
+		values1[i].SetInt(int64(i))
+		values2[i].SetInt(int64(3 * i + 50))
+	}
+	plaintext1, _ := crypto.NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext2, _ := crypto.NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	if err = encoder.Encode(values1, plaintext1); err != nil {
+		t.Fatalf("Error in Encode: %v", err)
+	}
+	encoder.Encode(values2, plaintext2)
+
+	// encode / decode
+	decoded, err := encoder.Decode(plaintext1)
+	if err != nil {
+		t.Fatalf("Error in Decode: %v", err)
+	}
+	for i := range values1 {
+		if !decoded[i].EqualTo(&values1[i]) {
+			t.Fatalf("Error in Decode slot %v, expected %v, got %v", i, values1[i].Int64(), decoded[i].Int64())
+		}
+	}
+
+	// slot-wise addition and multiplication
+	encryptor := crypto.NewEncryptorWithPRNG(fv, &key.PubKey, ring.NewXOF([]byte("batch encryption")))
+	ciphertext1, _ := encryptor.Encrypt(plaintext1)
+	ciphertext2, _ := encryptor.Encrypt(plaintext2)
+	evaluator := crypto.NewEvaluator(fv, &key.EvaKey, key.EvaSize)
+	decryptor := crypto.NewDecryptor(fv, &key.SecKey)
+	addCipher, _ := evaluator.Add(ciphertext1, ciphertext2)
+	mulCipher, err := evaluator.Multiply(ciphertext1, ciphertext2)
+	if err != nil {
+		t.Fatalf("Error in Multiply: %v", err)
+	}
+	checkBudget(t, decryptor, addCipher, "Add")
+	checkBudget(t, decryptor, mulCipher, "Multiply")
+	addPlain, _ := decryptor.Decrypt(addCipher)
+	mulPlain, _ := decryptor.Decrypt(mulCipher)
+	addValues, _ := encoder.Decode(addPlain)
+	mulValues, _ := encoder.Decode(mulPlain)
+	var want bigint.Int
+	for i := range values1 {
+		want.Add(&values1[i], &values2[i])
+		want.Mod(&want, &fv.T)
+		if !addValues[i].EqualTo(&want) {
+			t.Fatalf("Error in slot-wise add, slot %v, expected %v, got %v", i, want.Int64(), addValues[i].Int64())
+		}
+		want.Mul(&values1[i], &values2[i])
+		want.Mod(&want, &fv.T)
+		if !mulValues[i].EqualTo(&want) {
+			t.Fatalf("Error in slot-wise multiply, slot %v, expected %v, got %v", i, want.Int64(), mulValues[i].Int64())
+		}
+	}
+
+	// the plaintext modulus has to be a prime equal to 1 mod 2N
+	fv, _ = crypto.NewFVContextFromParameters(crypto.NewParameters(32, *bigint.NewInt(10), *bigint.NewInt(8380417)))
+	if _, err = NewBatchEncoder(fv); err == nil {
+		t.Errorf("Error in NewBatchEncoder: T = 10 should be rejected")
+	}
+}
+
+// Test that the galois automorphisms rotate the rows of the slots and swap them
+func TestRotation(t *testing.T) {
+	fv, key := newTestContext(t, "rotation")
+	encoder, _ := NewBatchEncoder(fv)
+	steps := []int{1, 3, -1}
+	var elements []uint32
+	for _, step := range steps {
+		elements = append(elements, crypto.GaloisElementRowRotation(fv.N, step))
+	}
+	elements = append(elements, crypto.GaloisElementColumnRotation(fv.N))
+	galoisKeys, err := crypto.GenerateGaloisKeys(fv, key, elements)
+	if err != nil {
+		t.Fatalf("Error in GenerateGaloisKeys: %v", err)
+	}
+
+	n := encoder.SlotCount()
+	rowSize := int(n / 2)
+	values := make([]bigint.Int, n)
+	for i := range values {
+		values[i].SetInt(int64(i + 1))
+	}
+	plaintext, _ := crypto.NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	encoder.Encode(values, plaintext)
+	ciphertext, _ := crypto.NewEncryptorWithPRNG(fv, &key.PubKey, ring.NewXOF([]byte("rotation encryption"))).Encrypt(plaintext)
+	evaluator := crypto.NewEvaluator(fv, &key.EvaKey, key.EvaSize)
+	decryptor := crypto.NewDecryptor(fv, &key.SecKey)
+
+	if _, err = evaluator.RotateRows(ciphertext, 2); err == nil {
+		t.Errorf("Error in RotateRows: missing galois key should be rejected")
+	}
+	evaluator.SetGaloisKeys(galoisKeys)
+	for _, step := range steps {
+		rotated, err := evaluator.RotateRows(ciphertext, step)
+		if err != nil {
+			t.Fatalf("Error in RotateRows: %v", err)
+		}
+		checkBudget(t, decryptor, rotated, "RotateRows")
+		result, _ := decryptor.Decrypt(rotated)
+		got, _ := encoder.Decode(result)
+		for row := 0; row < 2; row++ {
+			for i := 0; i < rowSize; i++ {
+				want := &values[row * rowSize + ((i + step) % rowSize + rowSize) % rowSize]
+				if !got[row * rowSize + i].EqualTo(want) {
+					t.Fatalf("Error in RotateRows(%v), slot %v, expected %v, got %v", step, row * rowSize + i, want.Int64(), got[row * rowSize + i].Int64())
+				}
+			}
+		}
+	}
+	rotated, err := evaluator.RotateColumns(ciphertext)
+	if err != nil {
+		t.Fatalf("Error in RotateColumns: %v", err)
+	}
+	checkBudget(t, decryptor, rotated, "RotateColumns")
+	result, _ := decryptor.Decrypt(rotated)
+	got, _ := encoder.Decode(result)
+	for i := range got {
+		if want := &values[(i + rowSize) % int(n)]; !got[i].EqualTo(want) {
+			t.Fatalf("Error in RotateColumns, slot %v, expected %v, got %v", i, want.Int64(), got[i].Int64())
+		}
+	}
+}
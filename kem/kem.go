@@ -0,0 +1,500 @@
+package kem
+
+import (
+	"crypto/sha3"
+	"crypto/subtle"
+	"errors"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/polynomial"
+	"github.com/dedis/lago/ring"
+	"io"
+)
+
+// This code implements the Module-LWE key encapsulation of Kyber, https://eprint.iacr.org/2017/634.pdf,
+// with the parameters of its first version, q = 7681 and N = 256: a CPA-secure public-key encryption
+// made CCA-secure by the Fujisaki-Okamoto transform with implicit rejection.
+// The NTT form of the rings is the one of the polynomial package, so that the encodings
+// are not interoperable with other implementations.
+// Only the comparison of the re-encrypted ciphertext and the selection of the shared key of Decapsulate are
+// constant time: the products with the secret s in decrypt run on the generic arithmetic of the ring package,
+// whose timing may depend on the secret coefficients.
+
+// Parameters are the parameters of a security level of the KEM
+type Parameters struct {
+	Name string
+	K int  // rank of the module, the matrix A having K x K rings
+	Eta uint32  // parameter of the centered binomial distribution of the secrets and errors
+	Du uint  // bit length of the compressed coefficients of u
+	Dv uint  // bit length of the compressed coefficients of v
+}
+
+// The security levels of the first version of Kyber, about 102, 161 and 218 bits of post-quantum security
+var (
+	Kyber512 = &Parameters{Name: "Kyber512", K: 2, Eta: 5, Du: 11, Dv: 3}
+	Kyber768 = &Parameters{Name: "Kyber768", K: 3, Eta: 4, Du: 11, Dv: 3}
+	Kyber1024 = &Parameters{Name: "Kyber1024", K: 4, Eta: 3, Du: 11, Dv: 3}
+)
+
+const (
+	// N is the degree of the rings
+	N = 256
+	// Q is the modulus of the rings
+	Q = 7681
+	// qBits is the bit length of the encoded coefficients of the keys
+	qBits = 13
+	// SymSize is the byte length of the seeds, messages, hashes and shared keys
+	SymSize = 32
+	// SharedKeySize is the byte length of the shared keys
+	SharedKeySize = SymSize
+)
+
+// ErrInvalidEncoding is returned when decoding keys or ciphertexts of the wrong size or with coefficients out of [0, Q)
+var ErrInvalidEncoding = errors.New("invalid KEM encoding")
+
+// KEM encapsulates shared keys at a security level
+type KEM struct {
+	params *Parameters
+	nttParams *polynomial.NttParams
+}
+
+// PublicKey is the public key (t = A * s + e, rho) of the KEM, with t in NTT form and A expanded from rho
+type PublicKey struct {
+	t ring.Vector
+	rho []byte
+	data []byte  // encoding of the public key, hashed by the Fujisaki-Okamoto transform
+}
+
+// PrivateKey is the private key of the KEM, the secret s in NTT form with the public key, its hash
+// and the secret z returning pseudorandom keys for invalid ciphertexts
+type PrivateKey struct {
+	s ring.Vector
+	pk *PublicKey
+	hpk []byte
+	z []byte
+}
+
+// NewKEM creates the KEM of the security level of params
+func NewKEM(params *Parameters) (*KEM, error) {
+	if params == nil || params.K < 1 || params.K > 4 || params.Eta == 0 || params.Du == 0 || params.Du > qBits || params.Dv == 0 || params.Dv > qBits {
+		return nil, errors.New("invalid KEM parameters")
+	}
+	nttParams, err := polynomial.GenerateNTTParams(N, *bigint.NewInt(Q))
+	if err != nil {
+		return nil, err
+	}
+	return &KEM{params: params, nttParams: nttParams}, nil
+}
+
+// PublicKeySize returns the byte length of the encoded public keys
+func (kem *KEM) PublicKeySize() int {
+	return kem.params.K * N * qBits / 8 + SymSize
+}
+
+// PrivateKeySize returns the byte length of the encoded private keys
+func (kem *KEM) PrivateKeySize() int {
+	return kem.params.K * N * qBits / 8 + kem.PublicKeySize() + 2 * SymSize
+}
+
+// CiphertextSize returns the byte length of the ciphertexts
+func (kem *KEM) CiphertextSize() int {
+	return (kem.params.K * N * int(kem.params.Du) + N * int(kem.params.Dv)) / 8
+}
+
+// hashH returns SHA3-256(data)
+func hashH(data ...[]byte) []byte {
+	h := sha3.New256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// hashG returns the two halves of SHA3-512(data)
+func hashG(data ...[]byte) ([]byte, []byte) {
+	h := sha3.New512()
+	for _, d := range data {
+		h.Write(d)
+	}
+	sum := h.Sum(nil)
+	return sum[:SymSize], sum[SymSize:]
+}
+
+// kdf returns the shared key SHAKE-256(data) of SharedKeySize bytes
+func kdf(data ...[]byte) []byte {
+	xof := sha3.NewSHAKE256()
+	for _, d := range data {
+		xof.Write(d)
+	}
+	key := make([]byte, SharedKeySize)
+	xof.Read(key)
+	return key
+}
+
+// prf returns the PRNG SHAKE-256(seed || nonce) of the noise of index nonce
+func prf(seed []byte, nonce byte) ring.PRNG {
+	xof := sha3.NewSHAKE256()
+	xof.Write(seed)
+	xof.Write([]byte{nonce})
+	return xof
+}
+
+// noiseVector samples the vector of k centered binomial rings of the nonces from nonce, in coefficient form
+func (kem *KEM) noiseVector(seed []byte, nonce byte, k int) (ring.Vector, error) {
+	v := make(ring.Vector, k)
+	var err error
+	for i := range v {
+		v[i], err = ring.NewCBDPoly(prf(seed, nonce + byte(i)), N, *bigint.NewInt(Q), kem.nttParams, kem.params.Eta)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// ringFromValues returns the ring of coefficients values in [0, Q), in NTT form if ntt is true
+func (kem *KEM) ringFromValues(values []uint32, ntt bool) (*ring.Ring, error) {
+	r, err := ring.NewRing(N, *bigint.NewInt(Q), kem.nttParams)
+	if err != nil {
+		return nil, err
+	}
+	if ntt {
+		// the coefficients are set in the form of the ring
+		r.Poly.NTT()
+	}
+	coeffs := make([]bigint.Int, N)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(values[i]))
+	}
+	return r, r.Poly.SetCoefficients(coeffs)
+}
+
+// ringValues returns the coefficients of r in [0, Q), in the form of r
+func ringValues(r *ring.Ring) []uint32 {
+	values := make([]uint32, N)
+	for i, c := range r.GetCoefficientsInt64() {
+		values[i] = uint32(c)
+	}
+	return values
+}
+
+// pack encodes values of d bits, from the least significant bit of each value and byte
+func pack(values []uint32, d uint) []byte {
+	out := make([]byte, (len(values) * int(d) + 7) / 8)
+	for i, v := range values {
+		for b := uint(0); b < d; b++ {
+			pos := uint(i) * d + b
+			out[pos / 8] |= byte((v >> b) & 1) << (pos % 8)
+		}
+	}
+	return out
+}
+
+// unpack decodes count values of d bits encoded by pack
+func unpack(data []byte, count int, d uint) []uint32 {
+	values := make([]uint32, count)
+	for i := range values {
+		for b := uint(0); b < d; b++ {
+			pos := uint(i) * d + b
+			values[i] |= uint32(data[pos / 8] >> (pos % 8) & 1) << b
+		}
+	}
+	return values
+}
+
+// compress maps the values x in [0, Q) to round(2^d / Q * x) mod 2^d
+func compress(values []uint32, d uint) []uint32 {
+	out := make([]uint32, len(values))
+	for i, x := range values {
+		out[i] = uint32(((uint64(x) << d) + Q / 2) / Q) & (1 << d - 1)
+	}
+	return out
+}
+
+// decompress maps the values y in [0, 2^d) to round(Q / 2^d * y)
+func decompress(values []uint32, d uint) []uint32 {
+	out := make([]uint32, len(values))
+	for i, y := range values {
+		out[i] = uint32((uint64(y) * Q + 1 << (d - 1)) >> d)
+	}
+	return out
+}
+
+// encodeVector encodes the coefficients of the rings of v with qBits bits each
+func encodeVector(v ring.Vector) []byte {
+	var out []byte
+	for _, r := range v {
+		out = append(out, pack(ringValues(r), qBits)...)
+	}
+	return out
+}
+
+// decodeVector decodes k rings in NTT form encoded by encodeVector,
+// ErrInvalidEncoding is returned for coefficients out of [0, Q)
+func (kem *KEM) decodeVector(data []byte, k int) (ring.Vector, error) {
+	v := make(ring.Vector, k)
+	size := N * qBits / 8
+	for i := range v {
+		values := unpack(data[i * size:(i + 1) * size], N, qBits)
+		for _, x := range values {
+			if x >= Q {
+				return nil, ErrInvalidEncoding
+			}
+		}
+		r, err := kem.ringFromValues(values, true)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = r
+	}
+	return v, nil
+}
+
+// readSeed reads a seed of SymSize bytes from prng, a fresh ring.NewPRNG() if prng is nil
+func readSeed(prng ring.PRNG) ([]byte, error) {
+	if prng == nil {
+		var err error
+		if prng, err = ring.NewPRNG(); err != nil {
+			return nil, err
+		}
+	}
+	seed := make([]byte, SymSize)
+	if _, err := io.ReadFull(prng, seed); err != nil {
+		return nil, err
+	}
+	return seed, nil
+}
+
+// KeyGen generates a key pair with the seeds read from prng, so that the same PRNG state always gives
+// the same keys; a nil prng reads them from a fresh ring.NewPRNG()
+func (kem *KEM) KeyGen(prng ring.PRNG) (*PublicKey, *PrivateKey, error) {
+	d, err := readSeed(prng)
+	if err != nil {
+		return nil, nil, err
+	}
+	z, err := readSeed(prng)
+	if err != nil {
+		return nil, nil, err
+	}
+	rho, sigma := hashG(d)
+	k := kem.params.K
+
+	a, err := ring.NewUniformMatrixFromSeed(k, k, N, *bigint.NewInt(Q), kem.nttParams, rho)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := kem.noiseVector(sigma, 0, k)
+	if err != nil {
+		return nil, nil, err
+	}
+	e, err := kem.noiseVector(sigma, byte(k), k)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.NTT()
+	e.NTT()
+	t, err := ring.NewVector(k, N, *bigint.NewInt(Q), kem.nttParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = t.MulMatrix(a, s); err != nil {
+		return nil, nil, err
+	}
+	if _, err = t.Add(t, e); err != nil {
+		return nil, nil, err
+	}
+
+	pk := &PublicKey{t: t, rho: rho, data: append(encodeVector(t), rho...)}
+	sk := &PrivateKey{s: s, pk: pk, hpk: hashH(pk.data), z: z}
+	return pk, sk, nil
+}
+
+// encrypt returns the CPA-secure encryption of the message m of SymSize bytes under pk,
+// with the noise expanded from coins
+func (kem *KEM) encrypt(pk *PublicKey, m, coins []byte) ([]byte, error) {
+	k := kem.params.K
+	a, err := ring.NewUniformMatrixFromSeed(k, k, N, *bigint.NewInt(Q), kem.nttParams, pk.rho)
+	if err != nil {
+		return nil, err
+	}
+	r, err := kem.noiseVector(coins, 0, k)
+	if err != nil {
+		return nil, err
+	}
+	e1, err := kem.noiseVector(coins, byte(k), k)
+	if err != nil {
+		return nil, err
+	}
+	e2, err := kem.noiseVector(coins, byte(2 * k), 1)
+	if err != nil {
+		return nil, err
+	}
+	r.NTT()
+
+	// u = A^T * r + e1
+	u, err := ring.NewVector(k, N, *bigint.NewInt(Q), kem.nttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = u.MulMatrix(a.Transpose(), r); err != nil {
+		return nil, err
+	}
+	u.InverseNTT()
+	if _, err = u.Add(u, e1); err != nil {
+		return nil, err
+	}
+
+	// v = t^T * r + e2 + round(Q / 2) * m
+	v, err := ring.NewRing(N, *bigint.NewInt(Q), kem.nttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = v.InnerProduct(pk.t, r); err != nil {
+		return nil, err
+	}
+	v.Poly.InverseNTT()
+	message, err := kem.ringFromValues(decompress(unpack(m, N, 1), 1), false)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = v.Add(v, e2[0]); err != nil {
+		return nil, err
+	}
+	if _, err = v.Add(v, message); err != nil {
+		return nil, err
+	}
+
+	c := make([]byte, 0, kem.CiphertextSize())
+	for _, ui := range u {
+		c = append(c, pack(compress(ringValues(ui), kem.params.Du), kem.params.Du)...)
+	}
+	return append(c, pack(compress(ringValues(v), kem.params.Dv), kem.params.Dv)...), nil
+}
+
+// decrypt returns the message of SymSize bytes of the CPA-secure ciphertext c of CiphertextSize bytes
+func (kem *KEM) decrypt(sk *PrivateKey, c []byte) ([]byte, error) {
+	k := kem.params.K
+	du, dv := kem.params.Du, kem.params.Dv
+	size := N * int(du) / 8
+	u := make(ring.Vector, k)
+	var err error
+	for i := range u {
+		if u[i], err = kem.ringFromValues(decompress(unpack(c[i * size:(i + 1) * size], N, du), du), false); err != nil {
+			return nil, err
+		}
+	}
+	v, err := kem.ringFromValues(decompress(unpack(c[k * size:], N, dv), dv), false)
+	if err != nil {
+		return nil, err
+	}
+
+	// m = round(2 / Q * (v - s^T * u)) mod 2
+	u.NTT()
+	w, err := ring.NewRing(N, *bigint.NewInt(Q), kem.nttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.InnerProduct(sk.s, u); err != nil {
+		return nil, err
+	}
+	w.Poly.InverseNTT()
+	if _, err = w.Sub(v, w); err != nil {
+		return nil, err
+	}
+	return pack(compress(ringValues(w), 1), 1), nil
+}
+
+// Encapsulate returns a ciphertext under pk and the shared key it encapsulates, with the message read from prng;
+// a nil prng reads it from a fresh ring.NewPRNG()
+func (kem *KEM) Encapsulate(pk *PublicKey, prng ring.PRNG) ([]byte, []byte, error) {
+	seed, err := readSeed(prng)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the message is hashed not to output the randomness of the system
+	m := hashH(seed)
+	preKey, coins := hashG(m, hashH(pk.data))
+	c, err := kem.encrypt(pk, m, coins)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, kdf(preKey, hashH(c)), nil
+}
+
+// Decapsulate returns the shared key encapsulated in c under the public key of sk.
+// Invalid ciphertexts of the right size give pseudorandom keys (implicit rejection), and the same key for the same
+// ciphertext, so that they are only detected by the failure of the protocol using the key.
+// The decryption of c is not constant time, see the package comment.
+func (kem *KEM) Decapsulate(sk *PrivateKey, c []byte) ([]byte, error) {
+	if len(c) != kem.CiphertextSize() {
+		return nil, ErrInvalidEncoding
+	}
+	m, err := kem.decrypt(sk, c)
+	if err != nil {
+		return nil, err
+	}
+	preKey, coins := hashG(m, sk.hpk)
+	c2, err := kem.encrypt(sk.pk, m, coins)
+	if err != nil {
+		return nil, err
+	}
+	// preKey is replaced by z if c is not the encryption of m, the comparison and the copy being constant time
+	subtle.ConstantTimeCopy(1 - subtle.ConstantTimeCompare(c, c2), preKey, sk.z)
+	return kdf(preKey, hashH(c)), nil
+}
+
+// PublicKey returns the public key of sk
+func (sk *PrivateKey) PublicKey() *PublicKey {
+	return sk.pk
+}
+
+// MarshalBinary encodes pk as the coefficients of t in NTT form followed by rho, on PublicKeySize bytes
+func (pk *PublicKey) MarshalBinary() ([]byte, error) {
+	return append([]byte(nil), pk.data...), nil
+}
+
+// MarshalBinary encodes sk as the coefficients of s in NTT form, the public key, its hash and z,
+// on PrivateKeySize bytes
+func (sk *PrivateKey) MarshalBinary() ([]byte, error) {
+	data := encodeVector(sk.s)
+	data = append(data, sk.pk.data...)
+	data = append(data, sk.hpk...)
+	return append(data, sk.z...), nil
+}
+
+// UnmarshalPublicKey decodes a public key of the security level of kem encoded by PublicKey.MarshalBinary
+func (kem *KEM) UnmarshalPublicKey(data []byte) (*PublicKey, error) {
+	if len(data) != kem.PublicKeySize() {
+		return nil, ErrInvalidEncoding
+	}
+	size := kem.PublicKeySize() - SymSize
+	t, err := kem.decodeVector(data[:size], kem.params.K)
+	if err != nil {
+		return nil, err
+	}
+	pk := &PublicKey{t: t, data: append([]byte(nil), data...)}
+	pk.rho = pk.data[size:]
+	return pk, nil
+}
+
+// UnmarshalPrivateKey decodes a private key of the security level of kem encoded by PrivateKey.MarshalBinary,
+// ErrInvalidEncoding is returned if the hash of the public key does not match
+func (kem *KEM) UnmarshalPrivateKey(data []byte) (*PrivateKey, error) {
+	if len(data) != kem.PrivateKeySize() {
+		return nil, ErrInvalidEncoding
+	}
+	size := kem.params.K * N * qBits / 8
+	s, err := kem.decodeVector(data[:size], kem.params.K)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := kem.UnmarshalPublicKey(data[size:size + kem.PublicKeySize()])
+	if err != nil {
+		return nil, err
+	}
+	rest := data[size + kem.PublicKeySize():]
+	hpk := hashH(pk.data)
+	if subtle.ConstantTimeCompare(hpk, rest[:SymSize]) != 1 {
+		return nil, ErrInvalidEncoding
+	}
+	return &PrivateKey{s: s, pk: pk, hpk: hpk, z: append([]byte(nil), rest[SymSize:]...)}, nil
+}
@@ -0,0 +1,142 @@
+package kem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/dedis/lago/ring"
+	"testing"
+)
+
+var levels = []*Parameters{Kyber512, Kyber768, Kyber1024}
+
+// TestKEM checks that the shared keys of Encapsulate and Decapsulate agree at every security level,
+// with the sizes of the keys and ciphertexts and the encodings of the keys
+func TestKEM(t *testing.T) {
+	for _, params := range levels {
+		kem, err := NewKEM(params)
+		if err != nil {
+			t.Fatalf("Error in NewKEM(%v): %v", params.Name, err)
+		}
+		pk, sk, err := kem.KeyGen(nil)
+		if err != nil {
+			t.Fatalf("Error in KeyGen(%v): %v", params.Name, err)
+		}
+		for i := 0; i < 8; i++ {
+			c, key, err := kem.Encapsulate(pk, nil)
+			if err != nil {
+				t.Fatalf("Error in Encapsulate(%v): %v", params.Name, err)
+			}
+			if len(c) != kem.CiphertextSize() || len(key) != SharedKeySize {
+				t.Errorf("Error in Encapsulate(%v): ciphertext of %v bytes and key of %v bytes", params.Name, len(c), len(key))
+			}
+			key2, err := kem.Decapsulate(sk, c)
+			if err != nil {
+				t.Fatalf("Error in Decapsulate(%v): %v", params.Name, err)
+			}
+			if string(key) != string(key2) {
+				t.Errorf("Error in Decapsulate(%v): shared keys differ", params.Name)
+			}
+		}
+
+		pkData, _ := pk.MarshalBinary()
+		skData, _ := sk.MarshalBinary()
+		if len(pkData) != kem.PublicKeySize() || len(skData) != kem.PrivateKeySize() {
+			t.Errorf("Error in MarshalBinary(%v): public key of %v bytes and private key of %v bytes", params.Name, len(pkData), len(skData))
+		}
+		pk2, err := kem.UnmarshalPublicKey(pkData)
+		if err != nil {
+			t.Fatalf("Error in UnmarshalPublicKey(%v): %v", params.Name, err)
+		}
+		sk2, err := kem.UnmarshalPrivateKey(skData)
+		if err != nil {
+			t.Fatalf("Error in UnmarshalPrivateKey(%v): %v", params.Name, err)
+		}
+		c, key, _ := kem.Encapsulate(pk2, nil)
+		if key2, _ := kem.Decapsulate(sk2, c); string(key) != string(key2) {
+			t.Errorf("Error in UnmarshalPrivateKey(%v): shared keys of the decoded keys differ", params.Name)
+		}
+		if _, err = kem.UnmarshalPublicKey(pkData[1:]); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("Error in UnmarshalPublicKey(%v): expected %v, got %v", params.Name, ErrInvalidEncoding, err)
+		}
+		skData[kem.PrivateKeySize() - SymSize - 1] ^= 1
+		if _, err = kem.UnmarshalPrivateKey(skData); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("Error in UnmarshalPrivateKey(%v): wrong hash of the public key should be rejected", params.Name)
+		}
+		if _, err = kem.Decapsulate(sk, c[1:]); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("Error in Decapsulate(%v): expected %v, got %v", params.Name, ErrInvalidEncoding, err)
+		}
+	}
+
+	for _, params := range []*Parameters{nil, {Name: "K0", K: 0, Eta: 2, Du: 10, Dv: 4}} {
+		if _, err := NewKEM(params); err == nil {
+			t.Errorf("Error in NewKEM(%v): invalid parameters should be rejected", params)
+		}
+	}
+}
+
+// TestImplicitRejection checks that modified ciphertexts give pseudorandom keys, the same for the same ciphertext
+func TestImplicitRejection(t *testing.T) {
+	kem, _ := NewKEM(Kyber768)
+	pk, sk, _ := kem.KeyGen(nil)
+	c, key, _ := kem.Encapsulate(pk, nil)
+	for _, i := range []int{0, len(c) / 2, len(c) - 1} {
+		c[i] ^= 1
+		rejected, err := kem.Decapsulate(sk, c)
+		if err != nil {
+			t.Fatalf("Error in Decapsulate: %v", err)
+		}
+		if string(rejected) == string(key) {
+			t.Errorf("Error in Decapsulate: modified byte %v gives the shared key", i)
+		}
+		if rejected2, _ := kem.Decapsulate(sk, c); string(rejected) != string(rejected2) {
+			t.Errorf("Error in Decapsulate: modified byte %v gives different keys", i)
+		}
+		c[i] ^= 1
+	}
+}
+
+// TestKnownAnswers checks the keys, ciphertexts and shared keys expanded from fixed seeds by the XOF of the ring package.
+// The answers are the SHA-256 of the outputs of this implementation, which is not interoperable with other ones,
+// and catch any change of the sampling, products or encodings.
+func TestKnownAnswers(t *testing.T) {
+	answers := []struct {
+		pk, sk, c, key string
+	}{
+		{"4430c5035c62f896ddc4028ade56c2fcc8e38bda62abd2fd79b3d488e2f3b6ed", "904f817fdfc77e6d53a1ebbfdb7bdf4d3d530c7d11a598eccd52c3995ee92084",
+			"0f94453a723889487581c9af2624a1867df7297dd7f037129f2b5c9ece49cc88", "12b5c6a269b543facc15b6a9c1272c1fff09bc7fa470f974b9a3bb9290b1f398"},
+		{"1c5e1558b57c0bb6f5813cffb7f1ec1662b78bb49007ea8e2796966601c1c601", "a3fea0fb41adb7441220a08b407c56173dfbe15cc022c2ee42c6525b3e3cafa0",
+			"426f0f3dedd5c97b09aa4a19247fbf8da05a6bdcfe1d6bd34045fab530c6fbb6", "9877428a38bba540fef08cfb9179671bb8a154114775f873ecef0df48c06ebf0"},
+		{"3346e263dcedeeac47522e9d7c1e63ca05b99d15661c54a7d9b1aa8b63d9bddd", "30dd91713fc4ecd44c77d1fd34a002ebc8677dc5d6021a1be1071dcfaf4e756e",
+			"fa1351ee319ecabdf240ef7fe451dfda4cf9e332f4c8dda749db7f268fb71cfa", "84658c38fd0c192279648e4cd872104893600d1265e18798486a52fd861b73ec"},
+	}
+	hash := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	for i, params := range levels {
+		kem, _ := NewKEM(params)
+		pk, sk, err := kem.KeyGen(ring.NewXOF([]byte("keygen " + params.Name)))
+		if err != nil {
+			t.Fatalf("Error in KeyGen(%v): %v", params.Name, err)
+		}
+		c, key, err := kem.Encapsulate(pk, ring.NewXOF([]byte("encapsulate " + params.Name)))
+		if err != nil {
+			t.Fatalf("Error in Encapsulate(%v): %v", params.Name, err)
+		}
+		pkData, _ := pk.MarshalBinary()
+		skData, _ := sk.MarshalBinary()
+		if hash(pkData) != answers[i].pk || hash(skData) != answers[i].sk {
+			t.Errorf("Error in KeyGen(%v): keys differ from the known answers", params.Name)
+		}
+		if hash(c) != answers[i].c {
+			t.Errorf("Error in Encapsulate(%v): ciphertext differs from the known answer", params.Name)
+		}
+		if hex.EncodeToString(key) != answers[i].key {
+			t.Errorf("Error in Encapsulate(%v): shared key %x differs from the known answer", params.Name, key)
+		}
+		if key2, _ := kem.Decapsulate(sk, c); string(key2) != string(key) {
+			t.Errorf("Error in Decapsulate(%v): shared keys differ", params.Name)
+		}
+	}
+}
@@ -11,38 +11,43 @@ func main() {
 	msg1 := bigint.NewInt(10)
 	msg2 := bigint.NewInt(8)
 
-	N := uint32(32)  // polynomial degree
-	T := bigint.NewInt(10)  // plaintext moduli
-	Q := bigint.NewInt(8380417)  // ciphertext moduli
-	BigQ := bigint.NewIntFromString("4611686018326724609")  // big ciphertext moduli, used in homomorphic multiplication and should be greater than q^2
-
-	// create FV context and generate keys
-	fv := crypto.NewFVContext(N, *T, *Q, *BigQ)
-	key := crypto.GenerateKey(fv)
+	// create FV context from a 128-bit secure preset and generate keys
+	params, err := crypto.PN4096.Parameters()
+	if err != nil {
+		panic(err)
+	}
+	fv, err := crypto.NewFVContextWithSecurity(params, crypto.Security128)
+	if err != nil {
+		panic(err)
+	}
+	key, err := crypto.GenerateKey(fv)
+	if err != nil {
+		panic(err)
+	}
 
 	// encode messages
 	encoder := encoding.NewEncoder(fv)
-	plaintext1 := crypto.NewPlaintext(N, *Q, fv.NttParams)
-	plaintext2 := crypto.NewPlaintext(N, *Q, fv.NttParams)
+	plaintext1, _ := crypto.NewPlaintext(fv.N, fv.Q, fv.NttParams)
+	plaintext2, _ := crypto.NewPlaintext(fv.N, fv.Q, fv.NttParams)
 	encoder.Encode(msg1, plaintext1)
 	encoder.Encode(msg2, plaintext2)
 
 	// encrypt plainetexts
 	encryptor := crypto.NewEncryptor(fv, &key.PubKey)
-	ciphertext1 := encryptor.Encrypt(plaintext1)
-	ciphertext2 := encryptor.Encrypt(plaintext2)
+	ciphertext1, _ := encryptor.Encrypt(plaintext1)
+	ciphertext2, _ := encryptor.Encrypt(plaintext2)
 
 	// evaluate ciphertexts
 	evaluator := crypto.NewEvaluator(fv, &key.EvaKey, key.EvaSize)
-	add_cipher := evaluator.Add(ciphertext1, ciphertext2)
-	mul_cipher := evaluator.Multiply(add_cipher, ciphertext2)
+	add_cipher, _ := evaluator.Add(ciphertext1, ciphertext2)
+	mul_cipher, _ := evaluator.Multiply(add_cipher, ciphertext2)
 
 	// decrypt ciphertexts
 	decryptor := crypto.NewDecryptor(fv, &key.SecKey)
-	new_plaintext1 := decryptor.Decrypt(ciphertext1)
-	new_plaintext2 := decryptor.Decrypt(ciphertext2)
-	add_plaintext := decryptor.Decrypt(add_cipher)
-	mul_plaintext := decryptor.Decrypt(mul_cipher)
+	new_plaintext1, _ := decryptor.Decrypt(ciphertext1)
+	new_plaintext2, _ := decryptor.Decrypt(ciphertext2)
+	add_plaintext, _ := decryptor.Decrypt(add_cipher)
+	mul_plaintext, _ := decryptor.Decrypt(mul_cipher)
 
 	// decode messages
 	new_msg1 := new(bigint.Int)
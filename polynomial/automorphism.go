@@ -0,0 +1,43 @@
+package polynomial
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+)
+
+// Automorphism sets p to p1(X^k) mod X^N + 1 for odd k, i.e. applies the galois automorphism X -> X^k.
+// p1 can be in either form: in coefficient form the coefficients are permuted and negated,
+// in NTT form the evaluations at psi^e are permuted, since p1(X^k) evaluated at psi^e is p1 evaluated at psi^(e*k).
+// p takes the form of p1.
+func (p *Poly) Automorphism(p1 *Poly, k uint32) (*Poly, error) {
+	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
+		return nil, ErrParamMismatch
+	}
+	if k & 1 == 0 {
+		return nil, errors.New("galois element should be odd")
+	}
+	n := uint64(p.n)
+	m := 2 * n
+	kMod := uint64(k) % m
+	p.prepareBigint(p1)
+	coeffs := make([]bigint.Int, p.n)
+	if p1.isNTT {
+		for e := uint64(1); e < m; e += 2 {
+			coeffs[EvaluationIndex(p.n, uint32(e))].SetBigInt(&p1.coeffs[EvaluationIndex(p.n, uint32(e * kMod % m))])
+		}
+	} else {
+		for i := uint64(0); i < n; i++ {
+			j := i * kMod % m
+			if j < n {
+				coeffs[j].SetBigInt(&p1.coeffs[i])
+			} else {
+				coeffs[j - n].Neg(&p1.coeffs[i], &p.q)
+			}
+		}
+	}
+	for i := range p.coeffs {
+		p.coeffs[i].SetBigInt(&coeffs[i])
+	}
+	p.isNTT = p1.isNTT
+	return p, nil
+}
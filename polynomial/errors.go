@@ -0,0 +1,17 @@
+package polynomial
+
+import (
+	"errors"
+)
+
+// The errors returned by the constructors and operations of this package,
+// so that callers can tell parameter mistakes apart with errors.Is.
+var (
+	// ErrBadDegree is returned when the polynomial degree N is not a power of 2
+	ErrBadDegree = errors.New("polynomial degree N has to be power of 2")
+	// ErrModulusNotNTTFriendly is returned when a modulus is not a prime equal to 1 mod 2N,
+	// or is too large for the requested representation
+	ErrModulusNotNTTFriendly = errors.New("polynomial modulus Q should be a prime equal to 1 mod 2N")
+	// ErrParamMismatch is returned when the operands of an operation have different degrees or moduli
+	ErrParamMismatch = errors.New("unmatched degree or module")
+)
@@ -0,0 +1,295 @@
+package polynomial
+
+import (
+	"github.com/dedis/lago/bigint"
+)
+
+// This file implements the native uint64 backend of Poly.
+// When the modulus q is smaller than 2^62, the coefficients of a polynomial are mirrored
+// in a []uint64 slice, and when q is a product of such primes with RNS params, they are mirrored
+// in an RNSPoly holding their residues. The modular operations are computed with word-sized arithmetic,
+// avoiding the allocations of math/big. After a native operation the []bigint.Int coefficients are outdated,
+// and they are only synced when read, so that chains of native operations never go through math/big.
+// The coefficients are only exposed as copies, so that the backend is transparent to the callers of Poly.
+
+// nativeParams holds the precomputed word-sized constants of the native backend
+type nativeParams struct {
+	modulus *bigint.Modulus
+	psiReverse []uint64
+	psiReverseShoup []uint64 // Shoup constants of psiReverse, used by ShoupMul
+	psiInvReverse []uint64
+	psiInvReverseShoup []uint64
+	nInv, nInvShoup uint64 // n^-1 mod q and its Shoup constant
+}
+
+// newNativeParams precomputes the constants of the native backend,
+// it returns nil if q is too large to be handled by machine words.
+func newNativeParams(params *NttParams) *nativeParams {
+	if params.q.Value.Sign() <= 0 || params.q.Value.BitLen() > bigint.ModulusMaxBitLen {
+		return nil
+	}
+	modulus, err := bigint.NewModulus(params.q.Value.Uint64())
+	if err != nil {
+		return nil
+	}
+	np := new(nativeParams)
+	np.modulus = modulus
+
+	np.psiReverse = make([]uint64, params.n)
+	np.psiReverseShoup = make([]uint64, params.n)
+	np.psiInvReverse = make([]uint64, params.n)
+	np.psiInvReverseShoup = make([]uint64, params.n)
+	for i := uint32(0); i < params.n; i++ {
+		np.psiReverse[i] = params.PsiReverse[i].Value.Uint64()
+		np.psiReverseShoup[i] = modulus.ShoupConstant(np.psiReverse[i])
+		np.psiInvReverse[i] = params.PsiInvReverse[i].Value.Uint64()
+		np.psiInvReverseShoup[i] = modulus.ShoupConstant(np.psiInvReverse[i])
+	}
+	np.nInv = new(bigint.Int).Inv(bigint.NewInt(int64(params.n)), &params.q).Value.Uint64()
+	np.nInvShoup = modulus.ShoupConstant(np.nInv)
+	return np
+}
+
+// native returns the word-sized coefficients of p, converting them from the bigint coefficients when needed.
+// It returns nil if p cannot be handled by the native backend,
+// i.e. when q is too large or some coefficients are out of [0, q).
+func (p *Poly) native() []uint64 {
+	if p.nttParams == nil || p.nttParams.native == nil || !p.q.EqualTo(&p.nttParams.q) {
+		return nil
+	}
+	if p.nativeValid {
+		return p.nativeCoeffs
+	}
+	if uint32(len(p.nativeCoeffs)) != p.n {
+		p.nativeCoeffs = make([]uint64, p.n)
+	}
+	q := p.nttParams.native.modulus.Q
+	for i := range p.coeffs {
+		c := &p.coeffs[i].Value
+		if c.Sign() < 0 || !c.IsUint64() || c.Uint64() >= q {
+			return nil
+		}
+		p.nativeCoeffs[i] = c.Uint64()
+	}
+	p.nativeValid = true
+	return p.nativeCoeffs
+}
+
+// rns returns the residues of p modulo the primes of its RNS params, converting them from the bigint
+// coefficients when needed. It returns nil if p has no RNS params or some coefficients are out of [0, q).
+func (p *Poly) rns() *RNSPoly {
+	if p.nttParams == nil || p.nttParams.rns == nil || !p.q.EqualTo(&p.nttParams.q) {
+		return nil
+	}
+	if p.nativeValid {
+		// the residues are the ones of the coefficients of p whatever its form, which the mirror follows
+		p.rnsCoeffs.isNTT = p.isNTT
+		return p.rnsCoeffs
+	}
+	for i := range p.coeffs {
+		c := &p.coeffs[i].Value
+		if c.Sign() < 0 || c.Cmp(&p.q.Value) != -1 {
+			return nil
+		}
+	}
+	r := p.rnsTarget()
+	r.SetCoefficients(p.coeffs)
+	r.isNTT = p.isNTT
+	p.nativeValid = true
+	return r
+}
+
+// rnsTarget returns the residue polynomial of p to be written by an RNS operation,
+// it returns nil if p has no RNS params.
+func (p *Poly) rnsTarget() *RNSPoly {
+	if p.nttParams == nil || p.nttParams.rns == nil || !p.q.EqualTo(&p.nttParams.q) {
+		return nil
+	}
+	if p.rnsCoeffs == nil || p.rnsCoeffs.params != p.nttParams.rns {
+		p.rnsCoeffs, _ = NewRNSPolynomial(p.nttParams.rns)
+	}
+	return p.rnsCoeffs
+}
+
+// nativeTarget returns the word-sized coefficient buffer of p to be written by a native operation,
+// it returns nil if p cannot be handled by the native backend.
+func (p *Poly) nativeTarget() []uint64 {
+	if p.nttParams == nil || p.nttParams.native == nil || !p.q.EqualTo(&p.nttParams.q) {
+		return nil
+	}
+	if uint32(len(p.nativeCoeffs)) != p.n {
+		p.nativeCoeffs = make([]uint64, p.n)
+	}
+	return p.nativeCoeffs
+}
+
+// setNative marks the word-sized coefficients of p as written by a native operation,
+// its bigint coefficients being outdated until syncCoeffs
+func (p *Poly) setNative() {
+	p.nativeValid = true
+	p.coeffsStale = true
+}
+
+// syncCoeffs copies the word-sized coefficients of p back to its bigint coefficients if they are outdated
+func (p *Poly) syncCoeffs() {
+	if !p.coeffsStale {
+		return
+	}
+	if p.nttParams.rns != nil {
+		p.rnsCoeffs.reconstruct(p.coeffs)
+	} else {
+		for i := range p.coeffs {
+			p.coeffs[i].Value.SetUint64(p.nativeCoeffs[i])
+		}
+	}
+	p.coeffsStale = false
+}
+
+// invalidateNative syncs the bigint coefficients of p and marks its word-sized coefficients as outdated,
+// it has to be called before writing the bigint coefficients of p
+func (p *Poly) invalidateNative() {
+	p.syncCoeffs()
+	p.nativeValid = false
+}
+
+// prepareBigint syncs the bigint coefficients of the operands of a bigint operation,
+// and invalidates the word-sized coefficients of its target p
+func (p *Poly) prepareBigint(operands ...*Poly) {
+	for _, o := range operands {
+		o.syncCoeffs()
+	}
+	p.invalidateNative()
+}
+
+// nativeBinary prepares the native coefficients of p, p1 and p2 for a binary operation.
+// The returned boolean is false if any of the operands cannot be handled by the native backend.
+func nativeBinary(p, p1, p2 *Poly) ([]uint64, []uint64, []uint64, bool) {
+	a := p1.native()
+	if a == nil {
+		return nil, nil, nil, false
+	}
+	b := p2.native()
+	if b == nil {
+		return nil, nil, nil, false
+	}
+	r := p.nativeTarget()
+	if r == nil {
+		return nil, nil, nil, false
+	}
+	return r, a, b, true
+}
+
+// rnsBinary prepares the residues of p, p1 and p2 for a binary operation.
+// The returned boolean is false if any of the operands has no residues.
+func rnsBinary(p, p1, p2 *Poly) (*RNSPoly, *RNSPoly, *RNSPoly, bool) {
+	a := p1.rns()
+	if a == nil {
+		return nil, nil, nil, false
+	}
+	b := p2.rns()
+	if b == nil {
+		return nil, nil, nil, false
+	}
+	r := p.rnsTarget()
+	if r == nil {
+		return nil, nil, nil, false
+	}
+	return r, a, b, true
+}
+
+// GetRNS sets pRNS to the residues of p in the RNS basis of pRNS, which has to be a basis of the modulus of p,
+// in the form of p. The residues are read from the native backend of p when possible, without math/big.
+func (p *Poly) GetRNS(pRNS *RNSPoly) error {
+	if p.n != pRNS.params.n || !p.q.EqualTo(&pRNS.params.Q) {
+		return ErrParamMismatch
+	}
+	if r := p.rns(); r != nil && r.params == pRNS.params {
+		_, err := pRNS.Copy(r)
+		return err
+	}
+	if a := p.native(); a != nil && len(pRNS.coeffs) == 1 {
+		copy(pRNS.coeffs[0], a)
+		pRNS.isNTT = p.isNTT
+		return nil
+	}
+	p.syncCoeffs()
+	pRNS.isNTT = p.isNTT
+	return pRNS.SetCoefficients(p.coeffs)
+}
+
+// SetRNS sets p to the polynomial of residues pRNS, in the form of pRNS,
+// the RNS basis of pRNS having to be a basis of the modulus of p
+func (p *Poly) SetRNS(pRNS *RNSPoly) error {
+	if p.n != pRNS.params.n || !p.q.EqualTo(&pRNS.params.Q) {
+		return ErrParamMismatch
+	}
+	p.isNTT = pRNS.isNTT
+	if r := p.rnsTarget(); r != nil && r.params == pRNS.params {
+		if _, err := r.Copy(pRNS); err != nil {
+			return err
+		}
+		p.setNative()
+		return nil
+	}
+	if r := p.nativeTarget(); r != nil && len(pRNS.coeffs) == 1 {
+		copy(r, pRNS.coeffs[0])
+		p.setNative()
+		return nil
+	}
+	p.invalidateNative()
+	pRNS.reconstruct(p.coeffs)
+	return nil
+}
+
+// nttNative performs the number theoretic transform on the word-sized coefficients a
+func nttNative(a []uint64, np *nativeParams) {
+	var j1, j2 int
+	var U, V uint64
+	m := np.modulus
+	n := len(a)
+	t := n
+	for k := 1; k < n; k <<= 1 {
+		t >>= 1
+		for i := 0; i < k; i++ {
+			j1 = 2 * i * t
+			j2 = j1 + t - 1
+			S := np.psiReverse[k+i]
+			SShoup := np.psiReverseShoup[k+i]
+			for j := j1; j <= j2; j++ {
+				U = a[j]
+				V = m.ShoupMul(a[j+t], S, SShoup)
+				a[j] = m.Add(U, V)
+				a[j+t] = m.Sub(U, V)
+			}
+		}
+	}
+}
+
+// inverseNTTNative performs the inverse number theoretic transform on the word-sized coefficients a
+func inverseNTTNative(a []uint64, np *nativeParams) {
+	var j1, j2, h int
+	var U, V uint64
+	m := np.modulus
+	n := len(a)
+	t := 1
+	for k := n; k > 1; k >>= 1 {
+		j1 = 0
+		h = k >> 1
+		for i := 0; i < h; i++ {
+			j2 = j1 + t - 1
+			S := np.psiInvReverse[h+i]
+			SShoup := np.psiInvReverseShoup[h+i]
+			for j := j1; j <= j2; j++ {
+				U = a[j]
+				V = a[j+t]
+				a[j] = m.Add(U, V)
+				a[j+t] = m.ShoupMul(m.Sub(U, V), S, SShoup)
+			}
+			j1 = j1 + (t << 1)
+		}
+		t <<= 1
+	}
+	for j := range a {
+		a[j] = m.ShoupMul(a[j], np.nInv, np.nInvShoup)
+	}
+}
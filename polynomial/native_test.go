@@ -0,0 +1,102 @@
+package polynomial
+
+import (
+	"testing"
+	"github.com/dedis/lago/bigint"
+	"math/rand"
+)
+
+// test vectors for the native backend, the second modulus is the largest 62-bit prime used by the FV test vectors
+var nativeVec = []struct {
+	n uint32
+	q *bigint.Int
+}{
+	{256, bigint.NewInt(7681)},
+	{32, bigint.NewIntFromString("4611686018326724609")},
+}
+
+// Cross-verify the native backend with the bigint backend
+func TestNativeBackend(t *testing.T) {
+	for _, v := range nativeVec {
+		nttParams, _ := GenerateNTTParams(v.n, *v.q)
+		if nttParams.native == nil {
+			t.Fatalf("native backend not available for q = %v", v.q.Value.String())
+		}
+		bigNttParams := *nttParams
+		bigNttParams.native = nil
+
+		coeffs1 := make([]bigint.Int, v.n)
+		coeffs2 := make([]bigint.Int, v.n)
+		for i := range coeffs1 {
+			coeffs1[i].Value.Rand(rand.New(rand.NewSource(int64(i))), &v.q.Value)
+			coeffs2[i].Value.Rand(rand.New(rand.NewSource(int64(i+1))), &v.q.Value)
+		}
+
+		p1, _ := NewPolynomial(v.n, *v.q, nttParams)
+		p2, _ := NewPolynomial(v.n, *v.q, nttParams)
+		p, _ := NewPolynomial(v.n, *v.q, nttParams)
+		p1.SetCoefficients(coeffs1)
+		p2.SetCoefficients(coeffs2)
+		b1, _ := NewPolynomial(v.n, *v.q, &bigNttParams)
+		b2, _ := NewPolynomial(v.n, *v.q, &bigNttParams)
+		b, _ := NewPolynomial(v.n, *v.q, &bigNttParams)
+		b1.SetCoefficients(coeffs1)
+		b2.SetCoefficients(coeffs2)
+
+		check := func(name string) {
+			coeffs, want := p.GetCoefficients(), b.GetCoefficients()
+			for i := range coeffs {
+				if !coeffs[i].EqualTo(&want[i]) {
+					t.Errorf("Error in native %v: index %v, expected %v, got %v", name, i, want[i].Value.String(), coeffs[i].Value.String())
+					return
+				}
+			}
+		}
+
+		p.AddMod(p1, p2)
+		b.AddMod(b1, b2)
+		check("AddMod")
+		p.SubMod(p1, p2)
+		b.SubMod(b1, b2)
+		check("SubMod")
+		p.Neg(p1)
+		b.Neg(b1)
+		check("Neg")
+		p.MulCoeffs(p1, p2)
+		b.MulCoeffs(b1, b2)
+		check("MulCoeffs")
+		p.MulPoly(p1, p2)
+		b.MulPoly(b1, b2)
+		check("MulPoly")
+		p.SetCoefficients(coeffs1)
+		b.SetCoefficients(coeffs1)
+		p.NTT()
+		b.NTT()
+		check("NTT")
+		p.InverseNTT()
+		b.InverseNTT()
+		check("InverseNTT")
+
+		// chains of native operations only sync the bigint coefficients when they are read
+		p.AddMod(p1, p2)
+		p.MulCoeffs(p, p2)
+		p.NTT()
+		if !p.coeffsStale {
+			t.Errorf("Error in native backend: bigint coefficients synced between native operations")
+		}
+		b.AddMod(b1, b2)
+		b.MulCoeffs(b, b2)
+		b.NTT()
+		check("chain")
+		if p.coeffsStale {
+			t.Errorf("Error in native backend: bigint coefficients not synced by GetCoefficients")
+		}
+
+		// the coefficients are returned as a copy, modifying it does not change p
+		coeffs := p.GetCoefficients()
+		coeffs[0].Add(&coeffs[0], bigint.NewInt(1))
+		if p.GetCoefficients()[0].EqualTo(&coeffs[0]) {
+			t.Errorf("Error in GetCoefficients: modifying the returned coefficients changed the polynomial")
+		}
+	}
+}
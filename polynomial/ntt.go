@@ -1,6 +1,7 @@
 package polynomial
 
 import (
+	"errors"
 	"github.com/dedis/lago/bigint"
 )
 
@@ -8,7 +9,26 @@ import (
 // The implementation is based on the description from https://eprint.iacr.org/2016/504.pdf,
 // while the underlying algorithm originates from
 // https://www.usenix.org/system/files/conference/usenixsecurity16/sec16_paper_alkim.pdf
+// p has to be in coefficient form, and is in NTT form afterwards.
 func (p *Poly) NTT() (*Poly, error) {
+	if p.isNTT {
+		return nil, errors.New("polynomial is already in ntt form")
+	}
+	if r := p.rns(); r != nil {
+		if _, err := r.NTT(); err != nil {
+			return nil, err
+		}
+		p.isNTT = true
+		p.setNative()
+		return p, nil
+	}
+	p.isNTT = true
+	if a := p.native(); a != nil {
+		nttNative(a, p.nttParams.native)
+		p.setNative()
+		return p, nil
+	}
+	p.invalidateNative()
 	var j1, j2 uint32
 	var U, V, T bigint.Int
 	var S *bigint.Int
@@ -33,8 +53,27 @@ func (p *Poly) NTT() (*Poly, error) {
 	return p, nil
 }
 
-// InverseNTT performs the inverse number theoretic transform on polynomial p's coefficients
+// InverseNTT performs the inverse number theoretic transform on polynomial p's coefficients,
+// p has to be in NTT form, and is in coefficient form afterwards.
 func (p *Poly) InverseNTT() (*Poly, error) {
+	if !p.isNTT {
+		return nil, errors.New("polynomial is not in ntt form")
+	}
+	if r := p.rns(); r != nil {
+		if _, err := r.InverseNTT(); err != nil {
+			return nil, err
+		}
+		p.isNTT = false
+		p.setNative()
+		return p, nil
+	}
+	p.isNTT = false
+	if a := p.native(); a != nil {
+		inverseNTTNative(a, p.nttParams.native)
+		p.setNative()
+		return p, nil
+	}
+	p.invalidateNative()
 	var j1, j2, h uint32
 	var U, V, T bigint.Int
 	var S *bigint.Int
@@ -67,9 +106,15 @@ func (p *Poly) InverseNTT() (*Poly, error) {
 }
 
 
-// NTTFast performs the number theoretic transform with fast reduction algorithms.
+// NTTFast performs the number theoretic transform with fast reduction algorithms,
+// i.e. montgomery multiplication with PsiReverseMontgomery and barrett reduction.
 // This function is only used for testing / benchmarking.
 func (p *Poly) NTTFast() (*Poly, error) {
+	if p.isNTT {
+		return nil, errors.New("polynomial is already in ntt form")
+	}
+	p.isNTT = true
+	p.invalidateNative()
 	var j1, j2 uint32
 	var U, V, T bigint.Int
 	var S *bigint.Int
@@ -83,18 +128,18 @@ func (p *Poly) NTTFast() (*Poly, error) {
 			for j := j1; j <= j2; j++ {
 				U.SetBigInt(&p.coeffs[j])
 				V.Mul(&p.coeffs[j+t], S)
-				MontgomeryReduce(&V, &p.nttParams.q, &p.nttParams.qInv, p.nttParams.bitLen)
+				bigint.MontgomeryReduce(&V, &p.nttParams.q, &p.nttParams.qInv, &p.nttParams.montgomeryMod, p.nttParams.bitLen)
 				T.Add(&U, &V)
-				p.coeffs[j] = *BarrettReduce(&T, &p.q)
+				p.coeffs[j].SetBigInt(bigint.BarrettReduce(&T, &p.nttParams.q, &p.nttParams.barrettMu, p.nttParams.barrettShift))
 				T.Sub(&U, &V)
-				p.coeffs[j+t] = *BarrettReduce(&T, &p.q)
+				p.coeffs[j+t].SetBigInt(bigint.BarrettReduce(&T, &p.nttParams.q, &p.nttParams.barrettMu, p.nttParams.barrettShift))
 			}
 		}
 	}
 	return p, nil
 }
 
-// NTTFastInt64 performs the number theoretic transform on int64 data type.
+// NTTInt64 performs the number theoretic transform on int64 data type.
 // This function is only used for testing / benchmarking.
 func NTTInt64(coeffs, psiReverse []int64, q, n int64) []int64 {
 	var j1, j2 int64
@@ -119,74 +164,34 @@ func NTTInt64(coeffs, psiReverse []int64, q, n int64) []int64 {
 }
 
 // NTTFastInt64 performs the number theoretic transform with fast reduction algorithms on int64 data type.
+// The coefficients have to be in [0, q) and psiReverse has to be in montgomery form with R = 2^64,
+// e.g. PsiReverseMontgomery of NttParams, where modulus is the precomputed bigint.NewModulus(q)
+// for any odd q smaller than 2^62.
 // This function is only used for testing / benchmarking.
-func NTTFastInt64(coeffs, psiReverse []int64, q, n int64) []int64 {
-	var j1, j2, level int64
-	var U, V int64
-	var S int64
+func NTTFastInt64(coeffs, psiReverse []int64, modulus *bigint.Modulus, n int64) ([]int64, error) {
+	if modulus == nil {
+		return nil, errors.New("modulus is nil")
+	}
+	if n < 1 || n&(n-1) != 0 || int64(len(coeffs)) < n || int64(len(psiReverse)) < n {
+		return nil, ErrBadDegree
+	}
+	var j1, j2 int64
+	var U, V uint64
+	var S uint64
 	t := n
 	for m := int64(1); m < n; m <<= 1 {
-		level++
 		t >>= 1
 		for i := int64(0); i < m; i++ {
 			j1 = 2 * i * t
 			j2 = j1 + t - 1
-			S = psiReverse[m+i]
+			S = uint64(psiReverse[m+i])
 			for j := j1; j <= j2; j++ {
-				U = coeffs[j]
-				V = montgomeryReduce(coeffs[j+t] * S)
-				coeffs[j+t] = barrettReduce(U - V)
-				if level&1 == 1 {
-					coeffs[j] = barrettReduce(U + V)
-				} else {
-					coeffs[j] = U + V
-				}
+				U = uint64(coeffs[j])
+				V = modulus.MontgomeryMul(uint64(coeffs[j+t]), S)
+				coeffs[j+t] = int64(modulus.Sub(U, V))
+				coeffs[j] = int64(modulus.Add(U, V))
 			}
 		}
 	}
-	return coeffs
-}
-
-// MontgomeryReduce implements montgomery reduction algorithm on bigint.Int data type.
-func MontgomeryReduce(x, q, qInv *bigint.Int, bitLen uint32) *bigint.Int{
-	u := new(bigint.Int).Mul(x, qInv)
-	montgomeryMod := new(bigint.Int).Lsh(bigint.NewInt(1), bitLen)
-	montgomeryMod.Sub(montgomeryMod, bigint.NewInt(1))
-	u.And(u, montgomeryMod)
-	u.Mul(u, q)
-	x.Add(x, u)
-	x.Rsh(x, bitLen)
-	if x.Compare(q) != -1.0 {
-		return x.Sub(x, q)
-	}
-	return x
-}
-
-// BarrettReduce implements short barrett reduction algorithm on bigint.Int data type.
-func BarrettReduce(x, q *bigint.Int) *bigint.Int {
-	u := new(bigint.Int).Rsh(x, uint32(13)) // ((uint32_t) a * sinv) >> 16
-	u.Mul(u, q)
-	x.Sub(x, u)
-	return x
-}
-
-// montgomeryReduce implements montgomery reduction algorithm on int64 data type.
-func montgomeryReduce(a int64) int64 {
-	u := a * 7679
-	u &= (1 << 18) - 1
-	u *= 7681
-	a += u
-	a = int64(a >> 18)
-	if a >= 7681 {
-		return a - 7681
-	}
-	return a
-}
-
-// barrettReduce implements short barrett reduction algorithm on int64 data type.
-func barrettReduce(a int64) int64 {
-	u := int64(a >> 13) // ((uint32_t) a * sinv) >> 16
-	u *= 7681
-	a -= int64(u)
-	return a
+	return coeffs, nil
 }
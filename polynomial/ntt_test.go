@@ -49,7 +49,7 @@ func TestNTT(t *testing.T) {
 			}
 			nttCoeffs[i].SetInt(int64(tmp))
 		}
-		nttParams := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
+		nttParams, _ := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
 		p, err := NewPolynomial(uint32(n), *bigint.NewInt(int64(q)), nttParams)
 		if err != nil {
 			t.Error("Error in creating new polynomial")
@@ -77,6 +77,59 @@ func TestNTT(t *testing.T) {
 	}
 }
 
+// Cross-verify NTTFast and NTTFastInt64 with NTT for word-sized and large moduli
+func TestNTTFast(t *testing.T) {
+	large, _ := GenerateNTTPrimes(32, 100, 1)
+	for _, v := range append(nativeVec, struct {
+		n uint32
+		q *bigint.Int
+	}{32, &large[0]}) {
+		nttParams, _ := GenerateNTTParams(v.n, *v.q)
+		coeffs := make([]bigint.Int, v.n)
+		rnd := rand.New(rand.NewSource(1))
+		for i := range coeffs {
+			coeffs[i].Value.Rand(rnd, &v.q.Value)
+		}
+		p, _ := NewPolynomial(v.n, *v.q, nttParams)
+		pFast, _ := NewPolynomial(v.n, *v.q, nttParams)
+		p.SetCoefficients(coeffs)
+		pFast.SetCoefficients(coeffs)
+		p.NTT()
+		pFast.NTTFast()
+		for i := range p.GetCoefficients() {
+			if !p.coeffs[i].EqualTo(&pFast.coeffs[i]) {
+				t.Errorf("Error in NTTFast mod %v: index %v, expected %v, got %v", v.q.Value.String(), i, p.coeffs[i].Value.String(), pFast.coeffs[i].Value.String())
+				break
+			}
+		}
+		if v.q.Value.BitLen() > bigint.ModulusMaxBitLen {
+			continue
+		}
+
+		coeffsInt64 := make([]int64, v.n)
+		psiReverse := make([]int64, v.n)
+		for i := range coeffsInt64 {
+			coeffsInt64[i] = coeffs[i].Int64()
+			psiReverse[i] = nttParams.PsiReverseMontgomery[i].Int64()
+		}
+		modulus, err := bigint.NewModulus(uint64(v.q.Int64()))
+		if err != nil {
+			t.Errorf("Error in creating modulus %v: %v", v.q.Value.String(), err)
+			continue
+		}
+		if _, err := NTTFastInt64(coeffsInt64, psiReverse, modulus, int64(v.n)); err != nil {
+			t.Errorf("Error in NTTFastInt64 mod %v: %v", v.q.Value.String(), err)
+			continue
+		}
+		for i := range p.GetCoefficients() {
+			if p.coeffs[i].Int64() != coeffsInt64[i] {
+				t.Errorf("Error in NTTFastInt64 mod %v: index %v, expected %v, got %v", v.q.Value.String(), i, p.coeffs[i].Value.String(), coeffsInt64[i])
+				break
+			}
+		}
+	}
+}
+
 // Cross-verify the correctness of NTT with kyber.NTT and loccs.NTT
 func TestNTTCross(t *testing.T) {
 	q := bigint.NewInt(7681)
@@ -129,7 +182,7 @@ func TestNTTCross(t *testing.T) {
 	nttResultBliss := nttResultBlissPoly.GetData()
 
 	// this.NTT
-	nttParams := GenerateNTTParams(uint32(n), *q)
+	nttParams, _ := GenerateNTTParams(uint32(n), *q)
 	p1, _ := NewPolynomial(n, *q, nttParams)
 	p1.SetCoefficients(coeffs1)
 	p2, _ := NewPolynomial(n, *q, nttParams)
@@ -179,7 +232,7 @@ func BenchmarkNTT(b *testing.B) {
 		}
 		coeffs[i].SetInt(int64(tmp))
 	}
-	nttParams := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
+	nttParams, _ := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
 	p, err := NewPolynomial(uint32(n), *bigint.NewInt(int64(q)), nttParams)
 	if err != nil {
 		b.Error("Error in creating new polynomial")
@@ -187,6 +240,7 @@ func BenchmarkNTT(b *testing.B) {
 	p.SetCoefficients(coeffs)
 	b.ResetTimer()
 	for i :=0; i < b.N; i++ {
+		p.isNTT = false // transform the same polynomial repeatedly
 		p.NTT()
 	}
 }
@@ -219,7 +273,7 @@ func BenchmarkNTTFast(b *testing.B) {
 		}
 		coeffs[i].SetInt(int64(tmp))
 	}
-	nttParams := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
+	nttParams, _ := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
 	p, err := NewPolynomial(uint32(n), *bigint.NewInt(int64(q)), nttParams)
 	if err != nil {
 		b.Error("Error in creating new polynomial")
@@ -227,6 +281,7 @@ func BenchmarkNTTFast(b *testing.B) {
 	p.SetCoefficients(coeffs)
 	b.ResetTimer()
 	for i :=0; i < b.N; i++ {
+		p.isNTT = false // transform the same polynomial repeatedly
 		p.NTTFast()
 	}
 }
@@ -259,18 +314,22 @@ func BenchmarkNTTFastInt64(b *testing.B) {
 		}
 		coeffs[i] = int64(tmp)
 	}
-	nttParams := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
+	nttParams, _ := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
 	p, err := NewPolynomial(uint32(n), *bigint.NewInt(int64(q)), nttParams)
 	if err != nil {
 		b.Error("Error in creating new polynomial")
 	}
 	psiReverse := make([]int64, n)
 	for i := range psiReverse {
-		psiReverse[i] = p.nttParams.PsiReverse[i].Int64()
+		psiReverse[i] = p.nttParams.PsiReverseMontgomery[i].Int64()
+	}
+	modulus, err := bigint.NewModulus(uint64(q))
+	if err != nil {
+		b.Error("Error in creating modulus")
 	}
 	b.ResetTimer()
 	for i :=0; i < b.N; i++ {
-		NTTFastInt64(coeffs, psiReverse, int64(q), int64(n))
+		NTTFastInt64(coeffs, psiReverse, modulus, int64(n))
 	}
 }
 
@@ -302,14 +361,14 @@ func BenchmarkNTTInt64(b *testing.B) {
 		}
 		coeffs[i] = int64(tmp)
 	}
-	nttParams := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
+	nttParams, _ := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
 	p, err := NewPolynomial(uint32(n), *bigint.NewInt(int64(q)), nttParams)
 	if err != nil {
 		b.Error("Error in creating new polynomial")
 	}
 	psiReverse := make([]int64, n)
 	for i := range psiReverse {
-		psiReverse[i] = p.nttParams.PsiReverse[i].Int64()
+		psiReverse[i] = p.nttParams.PsiReverseMontgomery[i].Int64()
 	}
 	b.ResetTimer()
 	for i :=0; i < b.N; i++ {
@@ -374,6 +433,27 @@ func BenchmarkBlissNTT(b *testing.B) {
 // The following codes implement the kyber.Ntt and kyber.Invntt.
 // for more details, please visit https://github.com/Yawning/kyber
 
+// montgomeryReduce implements the montgomery reduction of kyber with q = 7681 and R = 2^18
+func montgomeryReduce(a int64) int64 {
+	u := a * 7679
+	u &= (1 << 18) - 1
+	u *= 7681
+	a += u
+	a = int64(a >> 18)
+	if a >= 7681 {
+		return a - 7681
+	}
+	return a
+}
+
+// barrettReduce implements the short barrett reduction of kyber with q = 7681
+func barrettReduce(a int64) int64 {
+	u := int64(a >> 13) // ((uint32_t) a * sinv) >> 16
+	u *= 7681
+	a -= int64(u)
+	return a
+}
+
 func NttRef(p *[256]uint16) {
 	var j int
 	k := 1
@@ -2,6 +2,7 @@ package polynomial
 
 import (
 	"github.com/dedis/lago/bigint"
+	"math/bits"
 )
 
 type NttParams struct {
@@ -11,41 +12,77 @@ type NttParams struct {
 	PsiReverseMontgomery []bigint.Int
 	PsiInvReverse []bigint.Int
 	PsiInvReverseMontgomery []bigint.Int
-	bitLen uint32  // param of montgomery reduction
+	bitLen uint32  // param of montgomery reduction, R = 2^bitLen
 	qInv bigint.Int // (2^bitLen * (inverse(2^bitLen mod q)) - 1) / q, param of montgomery reduction
+	montgomeryMod bigint.Int // 2^bitLen - 1, param of montgomery reduction
+	barrettShift uint32 // param of barrett reduction
+	barrettMu bigint.Int // floor(2^barrettShift / q), param of barrett reduction
+	native *nativeParams // word-sized params, nil if q does not fit the native backend
+	rns *RNSParams // RNS basis of q for a product of primes of the native backend, nil otherwise
+}
+
+// RNSParams returns the RNS basis of the modulus of params when it is a product of primes generated by
+// GenerateNTTParamsRNS, the polynomials of params holding their residues in this basis, and nil otherwise.
+func (params *NttParams) RNSParams() *RNSParams {
+	return params.rns
 }
 
 // generateNTTParameters generates the parameters for NTT and inverse NTT transformations.
 func generateNTTParameters(N uint32, Q bigint.Int) (*NttParams, error) {
-	newNttParams := new(NttParams)
-	// set n
-	newNttParams.n = N
-	// set nReverse
-	var temp bigint.Int
-	temp.Inv(bigint.NewInt(int64(N)), &Q)
-	newNttParams.nReverse = temp.Uint32()
-	// set q
-	newNttParams.q.SetBigInt(&Q)
-
 	// In the following, we calculate PsiReverse, PsiReverseMontgomery, PsiInvReverse, PsiInvReverseMontgomery.
 	// 1. First, set primitive root g = 2, and fi = q-1
 	g := primitiveRoot(&Q)
 	fi := new(bigint.Int)
 	fi.Sub(&Q, bigint.NewInt(1))  // fi = q - 1
 
-	// 2. Second, calculate 2N-th root of unity and its inverse, i.e. psi = g^(fi/2N) mod q, and psi^-1 mod q.
+	// 2. Second, calculate 2N-th root of unity, i.e. psi = g^(fi/2N) mod q
 	_2n := bigint.NewInt(2)
 	_2n.Mul(_2n, bigint.NewInt(int64(N)))
 	power := new(bigint.Int)
-	power.SetBigInt(fi)
 	power.Div(fi, _2n)
 	psi := new(bigint.Int)
 	psi.Exp(g, power, &Q)
+	return newNTTParams(N, Q, psi)
+}
+
+// generateNTTParametersRNS generates the parameters for NTT and inverse NTT transformations modulo the product Q
+// of distinct primes, the 2N-th root of unity psi is the CRT composition of the roots modulo each prime.
+func generateNTTParametersRNS(N uint32, moduli []bigint.Int) (*NttParams, error) {
+	Q := bigint.NewInt(1)
+	for i := range moduli {
+		Q.Mul(Q, &moduli[i])
+	}
+	psi := bigint.NewInt(0)
+	var qHat, tmp bigint.Int
+	for i := range moduli {
+		params, err := generateNTTParameters(N, moduli[i])
+		if err != nil {
+			return nil, err
+		}
+		// psi = sum psi_i * (Q / q_i) * ((Q / q_i)^-1 mod q_i) mod Q
+		qHat.Div(Q, &moduli[i])
+		tmp.Inv(&qHat, &moduli[i])
+		tmp.Mul(&tmp, &params.PsiReverse[N / 2])
+		tmp.Mul(&tmp, &qHat)
+		psi.Add(psi, &tmp)
+	}
+	psi.Mod(psi, Q)
+	return newNTTParams(N, *Q, psi)
+}
+
+// newNTTParams computes the NTT params of degree N and modulus Q from the 2N-th root of unity psi
+func newNTTParams(N uint32, Q bigint.Int, psi *bigint.Int) (*NttParams, error) {
+	newNttParams := new(NttParams)
+	// set n
+	newNttParams.n = N
+	// set nReverse
+	var temp bigint.Int
+	temp.Inv(bigint.NewInt(int64(N)), &Q)
+	newNttParams.nReverse = temp.Uint32()
+	// set q
+	newNttParams.q.SetBigInt(&Q)
 
-	powerInv := new(bigint.Int)
-	powerInv.Sub(fi, power)
-	psiInv := new(bigint.Int)
-	psiInv.Exp(g, powerInv, &Q)
+	psiInv := new(bigint.Int).Inv(psi, &Q)
 
 	// 3. Third, calculate powers of psi and psiInv in bit-reversed order
 	newNttParams.PsiReverse = make([]bigint.Int, N)
@@ -74,7 +111,11 @@ func generateNTTParameters(N uint32, Q bigint.Int) (*NttParams, error) {
 	newNttParams.PsiReverseMontgomery = make([]bigint.Int, N)
 	newNttParams.PsiInvReverseMontgomery = make([]bigint.Int, N)
 
+	// word-sized moduli use R = 2^64, so that PsiReverseMontgomery can be used with bigint.Modulus
 	qBitLen := Q.Value.BitLen() + 5
+	if Q.Value.BitLen() <= bigint.ModulusMaxBitLen {
+		qBitLen = 64
+	}
 	r := new(bigint.Int).Exp(bigint.NewInt(2), bigint.NewInt(int64(qBitLen)), &Q)
 	for i := uint32(0); i < N; i++ {
 		newNttParams.PsiReverseMontgomery[i].Mul(r, &newNttParams.PsiReverse[i])
@@ -91,10 +132,24 @@ func generateNTTParameters(N uint32, Q bigint.Int) (*NttParams, error) {
 	newNttParams.qInv.Mul(r, rInv)
 	newNttParams.qInv.Sub(&newNttParams.qInv, bigint.NewInt(1))
 	newNttParams.qInv.Div(&newNttParams.qInv, &Q)
+	newNttParams.montgomeryMod.Sub(r, bigint.NewInt(1))
+
+	// set the params of barrett reduction, the reduced values are bounded by 2q in absolute value
+	newNttParams.barrettShift = 2 * uint32(Q.Value.BitLen() + 1)
+	newNttParams.barrettMu.SetBigInt(bigint.BarrettConstant(&Q, newNttParams.barrettShift))
+
+	// set the params of the native backend
+	newNttParams.native = newNativeParams(newNttParams)
 
 	return newNttParams, nil
 }
 
+// EvaluationIndex returns the index of the NTT form of a polynomial of degree N holding its evaluation at psi^e,
+// for any odd e, where psi is the 2N-th root of unity of the NttParams, i.e. PsiReverse[N/2].
+func EvaluationIndex(N, e uint32) uint32 {
+	return bitReverse((e % (2 * N) - 1) / 2, uint32(bits.TrailingZeros32(N)))
+}
+
 // bitReverse calculates the bit-reverse index.
 // for example, given index=6 (110) and its bit-length bitLen=3, the indexReverse would be 3 (011)
 func bitReverse(index, bitLen uint32)  uint32{
@@ -117,7 +172,8 @@ func polynomialPollardsRho(x1, x2, c *bigint.Int) *bigint.Int{
 }
 
 // factorizationPollardsRho realizes Pollard's Rho algorithm for fast prime factorization,
-// but this function only returns one factor a time
+// but this function only returns one factor a time, which might be composite.
+// It returns 0 if no proper factor of m is found.
 func factorizationPollardsRho (m *bigint.Int) *bigint.Int {
 	var x, y, d, c *bigint.Int
 	zero := bigint.NewInt(0)
@@ -129,17 +185,18 @@ func factorizationPollardsRho (m *bigint.Int) *bigint.Int {
 	// because Pollard's Rho algorithm sometimes will miss some small prime factors.
 	for c = bigint.NewInt(1); !c.EqualTo(ten); c.Add(c, one){
 		x, y, d = bigint.NewInt(2), bigint.NewInt(2), bigint.NewInt(1)
-		for !d.EqualTo(zero) {
+		for d.EqualTo(one) {
 			x = polynomialPollardsRho(x, m, c)
 			y = polynomialPollardsRho(polynomialPollardsRho(y, m, c), m, c)
 			sub := new(bigint.Int).Sub(x, y)
 			d.Value.GCD(nil, nil, sub.Value.Abs(&sub.Value), &m.Value)
-			if d.Compare(one) == 1.0 {
-				return d
-			}
+		}
+		// d = m means that x and y met before finding a factor, retry with another c
+		if !d.EqualTo(m) {
+			return d
 		}
 	}
-	return d
+	return zero
 }
 
 // getFactors returns all the prime factors of m
@@ -168,22 +225,40 @@ func getFactors(n *bigint.Int) []bigint.Int {
 		return factors
 	}
 
-	// second, find other prime factors
-	for {
-		factor = factorizationPollardsRho(&m)
-		if factor.EqualTo(zero) {
-			factors = append(factors, m)
-			break
+	// second, find other prime factors, the composite factors are split again until they are prime
+	composites := []bigint.Int{m}
+	for len(composites) > 0 {
+		c := composites[len(composites)-1]
+		composites = composites[:len(composites)-1]
+		if c.EqualTo(one) {
+			continue
 		}
-		m.Div(&m, factor)
-		if len(factors) > 0 && factor.EqualTo(&factors[len(factors)-1]) {
+		if IsPrime(&c) {
+			if !containsFactor(factors, &c) {
+				factors = append(factors, c)
+			}
 			continue
 		}
-		factors = append(factors, *factor)
+		factor = factorizationPollardsRho(&c)
+		if factor.EqualTo(zero) {
+			factors = append(factors, c)
+			continue
+		}
+		composites = append(composites, *factor, *new(bigint.Int).Div(&c, factor))
 	}
 	return factors
 }
 
+// containsFactor checks if factor is already in factors
+func containsFactor(factors []bigint.Int, factor *bigint.Int) bool {
+	for i := range factors {
+		if factors[i].EqualTo(factor) {
+			return true
+		}
+	}
+	return false
+}
+
 // primitiveRoot calculates one primitive root of prime q
 func primitiveRoot(q *bigint.Int) *bigint.Int {
 	tmp := new(bigint.Int)
@@ -1,10 +1,12 @@
 package polynomial
 
 import (
+	"errors"
 	"testing"
 	"github.com/dedis/lago/bigint"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"strings"
 	"strconv"
 )
@@ -65,7 +67,7 @@ func TestGenerateNTTParams(t *testing.T) {
 			t.Errorf("Invalid integer: %v", vs[1])
 		}
 
-		params := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
+		params, _ := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
 		psiReverseString := strings.Split(strings.TrimSpace(vs[2]), ", ")
 		psiReverse := make([]bigint.Int, n)
 		for i := range psiReverse {
@@ -92,3 +94,164 @@ func TestGenerateNTTParams(t *testing.T) {
 		}
 	}
 }
+
+// test vectors for the errors of function GenerateNTTParams
+var nttParamsErrVec = []struct {
+	n uint32
+	q bigint.Int
+	err error
+}{
+	{0, *bigint.NewInt(7681), ErrBadDegree},
+	{255, *bigint.NewInt(7681), ErrBadDegree},
+	{256, *bigint.NewInt(7680), ErrModulusNotNTTFriendly},
+	{1024, *bigint.NewInt(7681), ErrModulusNotNTTFriendly},
+	{256, *bigint.NewInt(7681), nil},
+}
+
+func TestGenerateNTTParamsErrors(t *testing.T) {
+	for i, testPair := range nttParamsErrVec {
+		if _, err := GenerateNTTParams(testPair.n, testPair.q); !errors.Is(err, testPair.err) {
+			t.Errorf("Error in GenerateNTTParams test pair %v: expected %v, got %v", i, testPair.err, err)
+		}
+	}
+	if _, err := NewPolynomial(100, *bigint.NewInt(7681), nil); !errors.Is(err, ErrBadDegree) {
+		t.Errorf("Error in NewPolynomial: expected %v, got %v", ErrBadDegree, err)
+	}
+	params, _ := GenerateNTTParams(256, *bigint.NewInt(7681))
+	if _, err := NewPolynomial(512, *bigint.NewInt(7681), params); !errors.Is(err, ErrParamMismatch) {
+		t.Errorf("Error in NewPolynomial: expected %v, got %v", ErrParamMismatch, err)
+	}
+}
+
+// test vectors for function IsPrime
+var primeVec = []struct {
+	q bigint.Int
+	prime bool
+}{
+	{*bigint.NewInt(7681), true},
+	{*bigint.NewInt(7680), false},
+	{*bigint.NewInt(8380417), true},
+	{*bigint.NewIntFromString("1152921504382476289"), true},
+	{*bigint.NewIntFromString("4611686018326724609"), true},
+	{*bigint.NewIntFromString("18446744073709551617"), false}, // 2^64 + 1 = 274177 * 67280421310721
+	{*bigint.NewInt(3215031751), false}, // strong pseudoprime to bases 2, 3, 5 and 7
+}
+
+func TestIsPrime(t *testing.T) {
+	for i, testPair := range primeVec {
+		if IsPrime(&testPair.q) != testPair.prime {
+			t.Errorf("IsPrime error in test pair %v", i)
+		}
+	}
+}
+
+func TestGenerateNTTPrimes(t *testing.T) {
+	n := uint32(4096)
+	bitLen := uint32(60)
+	primes, err := GenerateNTTPrimes(n, bitLen, 4)
+	if err != nil {
+		t.Fatalf("Error in GenerateNTTPrimes: %v", err)
+	}
+	if len(primes) != 4 {
+		t.Fatalf("Error in GenerateNTTPrimes: expected 4 primes, got %v", len(primes))
+	}
+	twoN := bigint.NewInt(int64(2 * n))
+	for i := range primes {
+		if !IsPrime(&primes[i]) {
+			t.Errorf("%v is not prime", primes[i].Value.String())
+		}
+		if uint32(primes[i].Value.BitLen()) != bitLen {
+			t.Errorf("%v has not %v bits", primes[i].Value.String(), bitLen)
+		}
+		if !new(bigint.Int).Mod(&primes[i], twoN).EqualTo(bigint.NewInt(1)) {
+			t.Errorf("%v is not 1 mod 2N", primes[i].Value.String())
+		}
+		if i > 0 && primes[i].Compare(&primes[i-1]) != -1 {
+			t.Errorf("primes are not distinct and decreasing")
+		}
+	}
+	// the generated primes can be used to build NTT params
+	if _, err := GenerateNTTParams(n, primes[0]); err != nil {
+		t.Errorf("Error in GenerateNTTParams: %v", err)
+	}
+
+	if _, err := GenerateNTTPrimes(n, 12, 1); err == nil {
+		t.Errorf("GenerateNTTPrimes should reject bit lengths too small for N")
+	}
+	for _, bitLen := range []uint32{0, 1, maxPrimeBitLen + 1, 1 << 31} {
+		if _, err := GenerateNTTPrimes(n, bitLen, 1); err == nil {
+			t.Errorf("GenerateNTTPrimes should reject the bit length %v", bitLen)
+		}
+	}
+	for _, count := range []int{0, -1, math.MaxInt64} {
+		if _, err := GenerateNTTPrimes(n, bitLen, count); err == nil {
+			t.Errorf("GenerateNTTPrimes should reject %v primes", count)
+		}
+	}
+}
+
+// Test that the NTT form holds the evaluations at the odd powers of psi given by EvaluationIndex
+func TestEvaluationIndex(t *testing.T) {
+	n := uint32(16)
+	q := *bigint.NewInt(7681)
+	params, _ := GenerateNTTParams(n, q)
+	p, _ := NewPolynomial(n, q, params)
+	coeffs := make([]bigint.Int, n)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * i + 3))
+	}
+	p.SetCoefficients(coeffs)
+	p.NTT()
+	psi := &params.PsiReverse[n/2]
+	var want, x, power bigint.Int
+	for e := uint32(1); e < 2 * n; e += 2 {
+		want.SetInt(0)
+		for i := range coeffs {
+			power.Exp(psi, bigint.NewInt(int64(e) * int64(i)), &q)
+			x.Mul(&coeffs[i], &power)
+			want.Add(&want, &x)
+		}
+		want.Mod(&want, &q)
+		if got := p.GetCoefficients()[EvaluationIndex(n, e)]; !got.EqualTo(&want) {
+			t.Errorf("Error in EvaluationIndex(%v, %v), expected %v, got %v", n, e, want.Int64(), got.Int64())
+		}
+	}
+}
+
+// Test the NTT modulo a product of primes against the naive multiplication
+func TestGenerateNTTParamsRNS(t *testing.T) {
+	n := uint32(64)
+	moduli, _ := GenerateNTTPrimes(n, 40, 2)
+	if _, err := GenerateNTTParamsRNS(n, []bigint.Int{moduli[0], moduli[0]}); err == nil {
+		t.Errorf("Error in GenerateNTTParamsRNS: repeated moduli should be rejected")
+	}
+	if _, err := GenerateNTTParamsRNS(n, []bigint.Int{moduli[0], *bigint.NewInt(7680)}); !errors.Is(err, ErrModulusNotNTTFriendly) {
+		t.Errorf("Error in GenerateNTTParamsRNS: expected %v, got %v", ErrModulusNotNTTFriendly, err)
+	}
+	params, err := GenerateNTTParamsRNS(n, moduli)
+	if err != nil {
+		t.Fatalf("Error in GenerateNTTParamsRNS: %v", err)
+	}
+	q := new(bigint.Int).Mul(&moduli[0], &moduli[1])
+	coeffs1 := make([]bigint.Int, n)
+	coeffs2 := make([]bigint.Int, n)
+	for i := range coeffs1 {
+		coeffs1[i].Lsh(bigint.NewInt(int64(i + 1)), 70)
+		coeffs2[i].Lsh(bigint.NewInt(int64(3 * i + 7)), 60)
+	}
+	p1, _ := NewPolynomial(n, *q, params)
+	p2, _ := NewPolynomial(n, *q, params)
+	p, _ := NewPolynomial(n, *q, params)
+	want, _ := NewPolynomial(n, *q, params)
+	p1.SetCoefficients(coeffs1)
+	p2.SetCoefficients(coeffs2)
+	want.NaiveMultPoly(p1, p2)
+	if _, err = p.MulPoly(p1, p2); err != nil {
+		t.Fatalf("Error in MulPoly: %v", err)
+	}
+	for i := range p.GetCoefficients() {
+		if !p.coeffs[i].EqualTo(&want.coeffs[i]) {
+			t.Fatalf("Error in MulPoly modulo a product of primes: index %v", i)
+		}
+	}
+}
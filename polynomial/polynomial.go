@@ -10,29 +10,83 @@ type Poly struct {
 	n      uint32
 	q      bigint.Int
 	nttParams *NttParams
+	isNTT bool // true if coeffs holds the NTT evaluations of the polynomial
+	nativeCoeffs []uint64 // word-sized mirror of coeffs, see native.go
+	rnsCoeffs *RNSPoly // word-sized mirror of coeffs for moduli with RNS params, see native.go
+	nativeValid bool
+	coeffsStale bool // true if coeffs is outdated by a native operation, see syncCoeffs
 }
 
-// NewPolynomial creates a new polynomial with a given degree N and module Q
+// NewPolynomial creates a new polynomial with a given degree N and module Q,
+// NttParams can be nil, otherwise it has to match N and Q.
 func NewPolynomial(N uint32, Q bigint.Int, NttParams *NttParams) (*Poly, error) {
-	p := &Poly{make([]bigint.Int, N), N, Q, NttParams}
+	if N == 0 || (N & (N - 1)) != 0 {
+		return nil, ErrBadDegree
+	}
+	if NttParams != nil && (NttParams.n != N || !NttParams.q.EqualTo(&Q)) {
+		return nil, ErrParamMismatch
+	}
+	p := &Poly{coeffs: make([]bigint.Int, N), n: N, q: Q, nttParams: NttParams}
 	return p, nil
 }
 
-// GenerateNTTParams generates the ntt params of polynomial p
-func GenerateNTTParams(N uint32, Q bigint.Int) *NttParams {
-	//TODO : Primality Test
-	if (N & (N - 1)) != 0 { // if N is power of 2
-		panic("polynomial degree N has to be power of 2")
+// GenerateNTTParams generates the ntt params of polynomial p.
+// It returns ErrBadDegree if N is not a power of 2, and ErrModulusNotNTTFriendly if Q is not a prime equal to 1 mod 2N.
+func GenerateNTTParams(N uint32, Q bigint.Int) (*NttParams, error) {
+	if err := checkNTTFriendly(N, Q); err != nil {
+		return nil, err
+	}
+	return generateNTTParameters(N, Q)
+}
+
+// checkNTTFriendly checks that N is a power of 2 and Q a prime equal to 1 mod 2N
+func checkNTTFriendly(N uint32, Q bigint.Int) error {
+	if N == 0 || (N & (N - 1)) != 0 { // if N is power of 2
+		return ErrBadDegree
+	}
+	if !IsPrime(&Q) { // the NTT tables are only valid for prime Q
+		return ErrModulusNotNTTFriendly
 	}
 	if !new(bigint.Int).Mod( // if Q mod 2N = 1
 		&Q, new(bigint.Int).Mul(bigint.NewInt(2), bigint.NewInt(int64(N)))).EqualTo(bigint.NewInt(1)) {
-			panic("polynomial modulus Q mod 2*N should be 1")
+			return ErrModulusNotNTTFriendly
+	}
+	return nil
+}
+
+// GenerateNTTParamsRNS generates the NTT params of degree N modulo the product of the moduli,
+// which have to be distinct primes equal to 1 mod 2N, so that large moduli can be built from NTT-friendly primes.
+// When every prime fits the native backend, the polynomials of the params hold their residues modulo each prime,
+// so that their operations avoid math/big.
+func GenerateNTTParamsRNS(N uint32, moduli []bigint.Int) (*NttParams, error) {
+	if len(moduli) == 0 {
+		return nil, errors.New("empty modulus chain")
+	}
+	if len(moduli) == 1 {
+		return GenerateNTTParams(N, moduli[0])
+	}
+	for i := range moduli {
+		for j := 0; j < i; j++ {
+			if moduli[i].EqualTo(&moduli[j]) {
+				return nil, errors.New("moduli of the chain should be distinct")
+			}
+		}
+		if err := checkNTTFriendly(N, moduli[i]); err != nil {
+			return nil, err
+		}
 	}
-	nttparams, err := generateNTTParameters(N, Q)
+	params, err := generateNTTParametersRNS(N, moduli)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	// the residues modulo primes too large for the native backend are not handled,
+	// and products of primes small enough for the native backend do not need them
+	if params.native == nil {
+		if rns, err := GenerateRNSParams(N, moduli); err == nil {
+			params.rns = rns
+		}
 	}
-	return nttparams
+	return params, nil
 }
 
 // SetNTTParams sets the nttParams of polynomial p to the given nttparams
@@ -40,6 +94,7 @@ func (p *Poly) SetNTTParams(nttparams *NttParams) error {
 	if nttparams == nil {
 		return errors.New("invalid ntt params")
 	}
+	p.invalidateNative()
 	p.n = nttparams.n
 	p.q = nttparams.q
 	p.nttParams = nttparams
@@ -51,24 +106,68 @@ func (p *Poly) GetNTTParams() *NttParams {
 	return p.nttParams
 }
 
-// SetCoefficients sets the coefficient of target polynomial p to coeffs
+// IsNTT reports whether polynomial p is in NTT form
+func (p *Poly) IsNTT() bool {
+	return p.isNTT
+}
+
+// Copy sets p to a copy of p1, including the form of p1
+func (p *Poly) Copy(p1 *Poly) (*Poly, error) {
+	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
+		return nil, ErrParamMismatch
+	}
+	if p == p1 {
+		return p, nil
+	}
+	if r, a, _, ok := nativeBinary(p, p1, p1); ok {
+		copy(r, a)
+		p.isNTT = p1.isNTT
+		p.setNative()
+		return p, nil
+	}
+	if r, a, _, ok := rnsBinary(p, p1, p1); ok {
+		if _, err := r.Copy(a); err != nil {
+			return nil, err
+		}
+		p.isNTT = p1.isNTT
+		p.setNative()
+		return p, nil
+	}
+	p.prepareBigint(p1)
+	for i := range p.coeffs {
+		p.coeffs[i].SetBigInt(&p1.coeffs[i])
+	}
+	p.isNTT = p1.isNTT
+	return p, nil
+}
+
+// SetCoefficients sets the coefficient of target polynomial p to coeffs,
+// the coefficients are interpreted in the current form of p
 func (p *Poly) SetCoefficients(coeffs []bigint.Int) error {
 	if uint32(len(coeffs)) != p.n {
 		return errors.New("provided coeffs has different length with target polynomial")
 	}
+	p.invalidateNative()
 	for i, c := range coeffs {
 		p.coeffs[i].SetBigInt(&c)
 	}
 	return nil
 }
 
-// GetCoefficients returns the coefficients of target polynomial p
+// GetCoefficients returns a copy of the coefficients of target polynomial p,
+// modifying it does not change p, see SetCoefficients
 func (p *Poly) GetCoefficients() []bigint.Int {
-	return p.coeffs
+	p.syncCoeffs()
+	coeffs := make([]bigint.Int, p.n)
+	for i := range coeffs {
+		coeffs[i].SetBigInt(&p.coeffs[i])
+	}
+	return coeffs
 }
 
 // GetCoefficientsInt64 returns the low 64 bits of coefficients of target polynomial p as int64
 func (p *Poly) GetCoefficientsInt64() []int64 {
+	p.syncCoeffs()
 	coeffs := make([]int64, p.n)
 	for i := range p.coeffs {
 		coeffs[i] = p.coeffs[i].Int64()
@@ -81,8 +180,28 @@ func (p *Poly) AddMod(p1, p2 *Poly) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) ||
 		p.n != p2.n || !p.q.EqualTo(&p2.q) ||
 		p1.n != p2.n || !p1.q.EqualTo(&p2.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
 	}
+	if p1.isNTT != p2.isNTT {
+		return nil, errors.New("mixed coefficient form and ntt form operands")
+	}
+	p.isNTT = p1.isNTT
+	if r, a, b, ok := nativeBinary(p, p1, p2); ok {
+		m := p.nttParams.native.modulus
+		for i := range r {
+			r[i] = m.Add(a[i], b[i])
+		}
+		p.setNative()
+		return p, nil
+	}
+	if r, a, b, ok := rnsBinary(p, p1, p2); ok {
+		if _, err := r.AddMod(a, b); err != nil {
+			return nil, err
+		}
+		p.setNative()
+		return p, nil
+	}
+	p.prepareBigint(p1, p2)
 	for i := range p.coeffs {
 		p.coeffs[i].Add(&p1.coeffs[i], &p2.coeffs[i])
 		p.coeffs[i].Mod(&p.coeffs[i], &p.q)
@@ -95,8 +214,28 @@ func (p *Poly) SubMod(p1, p2 *Poly) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) ||
 		p.n != p2.n || !p.q.EqualTo(&p2.q) ||
 		p1.n != p2.n || !p1.q.EqualTo(&p2.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
+	}
+	if p1.isNTT != p2.isNTT {
+		return nil, errors.New("mixed coefficient form and ntt form operands")
 	}
+	p.isNTT = p1.isNTT
+	if r, a, b, ok := nativeBinary(p, p1, p2); ok {
+		m := p.nttParams.native.modulus
+		for i := range r {
+			r[i] = m.Sub(a[i], b[i])
+		}
+		p.setNative()
+		return p, nil
+	}
+	if r, a, b, ok := rnsBinary(p, p1, p2); ok {
+		if _, err := r.SubMod(a, b); err != nil {
+			return nil, err
+		}
+		p.setNative()
+		return p, nil
+	}
+	p.prepareBigint(p1, p2)
 	for i := range p.coeffs {
 		p.coeffs[i].Sub(&p1.coeffs[i], &p2.coeffs[i])
 		p.coeffs[i].Mod(&p.coeffs[i], &p.q)
@@ -107,23 +246,61 @@ func (p *Poly) SubMod(p1, p2 *Poly) (*Poly, error) {
 // Neg sets the coefficients of polynomial p to the negative of p1'coefficients
 func (p *Poly) Neg(p1 *Poly) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
 	}
+	p.isNTT = p1.isNTT
+	if r, a, _, ok := nativeBinary(p, p1, p1); ok {
+		m := p.nttParams.native.modulus
+		for i := range r {
+			r[i] = m.Neg(a[i])
+		}
+		p.setNative()
+		return p, nil
+	}
+	if r, a, _, ok := rnsBinary(p, p1, p1); ok {
+		if _, err := r.Neg(a); err != nil {
+			return nil, err
+		}
+		p.setNative()
+		return p, nil
+	}
+	p.prepareBigint(p1)
 	for i := range p.coeffs {
 		p.coeffs[i].Neg(&p1.coeffs[i], &p.q)
 	}
 	return p, nil
 }
 
-// InnerProduct multiplies polynomials p1 and p2 in coefficient-wise
+// MulCoeffs multiplies then mod the coefficients of p1 and p2, both of them in the same form
 func (p *Poly) MulCoeffs(p1, p2 *Poly) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) ||
 		p.n != p2.n || !p.q.EqualTo(&p2.q) ||
 		p1.n != p2.n || !p1.q.EqualTo(&p2.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
+	}
+	if p1.isNTT != p2.isNTT {
+		return nil, errors.New("mixed coefficient form and ntt form operands")
 	}
+	p.isNTT = p1.isNTT
+	if r, a, b, ok := nativeBinary(p, p1, p2); ok {
+		m := p.nttParams.native.modulus
+		for i := range r {
+			r[i] = m.Mul(a[i], b[i])
+		}
+		p.setNative()
+		return p, nil
+	}
+	if r, a, b, ok := rnsBinary(p, p1, p2); ok {
+		if _, err := r.MulCoeffs(a, b); err != nil {
+			return nil, err
+		}
+		p.setNative()
+		return p, nil
+	}
+	p.prepareBigint(p1, p2)
 	for i := range p.coeffs {
 		p.coeffs[i].Mul(&p1.coeffs[i], &p2.coeffs[i])
+		p.coeffs[i].Mod(&p.coeffs[i], &p.q)
 	}
 	return p, nil
 }
@@ -131,36 +308,63 @@ func (p *Poly) MulCoeffs(p1, p2 *Poly) (*Poly, error) {
 // MulScalar multiplies each coefficients of p with scalar
 func (p *Poly) MulScalar(p1 *Poly, scalar bigint.Int) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
 	}
+	p.isNTT = p1.isNTT
+	p.prepareBigint(p1)
 	for i := range p.coeffs {
 		p.coeffs[i].Mul(&p1.coeffs[i], &scalar)
 	}
 	return p, nil
 }
 
-// MulPoly multiplies p1 and p2 in polynomial style
+// MulPoly multiplies p1 and p2 in polynomial style, p1 and p2 are left unchanged.
+// The operands are converted to NTT form when needed,
+// and the result is in NTT form only if both operands are.
 func (p *Poly) MulPoly(p1, p2 *Poly) (*Poly, error) {
-	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+	if p.n != p1.n || !p.q.EqualTo(&p1.q) ||
+		p.n != p2.n || !p.q.EqualTo(&p2.q) {
+		return nil, ErrParamMismatch
+	}
+	isNTT := p1.isNTT && p2.isNTT
+	a, err := p1.nttForm()
+	if err != nil {
+		return nil, err
 	}
-	p1.NTT()
-	p2.NTT()
-	p.MulCoeffs(p1, p2)
-	p.Mod(p, p.q)
-	p.InverseNTT()
-	if p != p1 {
-		p1.InverseNTT()
+	b, err := p2.nttForm()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.MulCoeffs(a, b); err != nil {
+		return nil, err
 	}
-	if p != p2 {
-		p2.InverseNTT()
+	if !isNTT {
+		return p.InverseNTT()
 	}
 	return p, nil
 }
 
+// nttForm returns p if it is in NTT form, or a copy of p converted to NTT form otherwise
+func (p *Poly) nttForm() (*Poly, error) {
+	if p.isNTT {
+		return p, nil
+	}
+	r, err := NewPolynomial(p.n, p.q, p.nttParams)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Copy(p); err != nil {
+		return nil, err
+	}
+	return r.NTT()
+}
+
 // NaiveMultPoly implements a very basic polynomial multiplication,
-// its results are the same with MulPoly.
+// its results are the same with MulPoly. p1 and p2 have to be in coefficient form.
 func (p *Poly) NaiveMultPoly(p1, p2 *Poly) (*Poly, error) {
+	if p1.isNTT || p2.isNTT {
+		return nil, errors.New("operation requires coefficient form")
+	}
 	r := make([]bigint.Int, p.n * 2)
 	coeffs := make([]bigint.Int, p.n)
 	coeffs1 := p1.GetCoefficients()
@@ -180,76 +384,123 @@ func (p *Poly) NaiveMultPoly(p1, p2 *Poly) (*Poly, error) {
 	for i := uint32(0); i < p.n; i++ {
 		coeffs[i].SetBigInt(&r[i])
 	}
+	p.isNTT = false
 	p.SetCoefficients(coeffs)
 	return p, nil
 }
 
-// Div divides each coefficient of p1 by scalar, and sets p to the floor division results
+// Div divides each coefficient of p1 by scalar, and sets p to the floor division results,
+// p1 has to be in coefficient form
 func (p *Poly) Div(p1 *Poly, scalar bigint.Int) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
 	}
 	if scalar.EqualTo(bigint.NewInt(int64(0))) {
 		return nil, errors.New("divisor cannot be zero")
 	}
+	if p1.isNTT {
+		return nil, errors.New("operation requires coefficient form")
+	}
+	p.isNTT = false
+	p.prepareBigint(p1)
 	for i := range p.coeffs {
 		p.coeffs[i].Div(&p1.coeffs[i], &scalar)
 	}
 	return p, nil
 }
 
-// DivRound divides each coefficient of p1 by scalar, and sets p to the round division results
+// DivRound divides each coefficient of p1 by scalar, and sets p to the round division results,
+// p1 has to be in coefficient form
 func (p *Poly) DivRound(p1 *Poly, scalar bigint.Int) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
 	}
 	if scalar.EqualTo(bigint.NewInt(int64(0))) {
 		return nil, errors.New("divisor cannot be zero")
 	}
+	if p1.isNTT {
+		return nil, errors.New("operation requires coefficient form")
+	}
+	p.isNTT = false
+	p.prepareBigint(p1)
 	for i := range p.coeffs {
 		p.coeffs[i].DivRound(&p1.coeffs[i], &scalar)
 	}
 	return p, nil
 }
 
-// Mod sets p to p1 mod m
+// Mod sets p to p1 mod m, p1 has to be in coefficient form unless m is the modulus of p
 func (p *Poly) Mod(p1 *Poly, m bigint.Int) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
+	}
+	if !m.EqualTo(&p.q) && p1.isNTT {
+		return nil, errors.New("operation requires coefficient form")
 	}
+	p.isNTT = p1.isNTT
+	if m.EqualTo(&p.q) {
+		if r, a, _, ok := nativeBinary(p, p1, p1); ok {
+			copy(r, a)
+			p.setNative()
+			return p, nil
+		}
+		if r, a, _, ok := rnsBinary(p, p1, p1); ok {
+			if _, err := r.Copy(a); err != nil {
+				return nil, err
+			}
+			p.setNative()
+			return p, nil
+		}
+	}
+	p.prepareBigint(p1)
 	for i := range p.coeffs {
 		p.coeffs[i].Mod(&p1.coeffs[i], &m)
 	}
 	return p, nil
 }
 
-// And sets p to p1&m
+// And sets p to p1&m, p1 has to be in coefficient form
 func (p *Poly) And(p1 *Poly, m bigint.Int) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
+	}
+	if p1.isNTT {
+		return nil, errors.New("operation requires coefficient form")
 	}
+	p.isNTT = false
+	p.prepareBigint(p1)
 	for i := range p.coeffs {
 		p.coeffs[i].And(&p1.coeffs[i], &m)
 	}
 	return p, nil
 }
 
-// Lsh sets p to p1 << m
+// Lsh sets p to p1 << m, p1 has to be in coefficient form
 func (p *Poly) Lsh(p1 *Poly, m uint32) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
 	}
+	if p1.isNTT {
+		return nil, errors.New("operation requires coefficient form")
+	}
+	p.isNTT = false
+	p.prepareBigint(p1)
 	for i := range p.coeffs {
 		p.coeffs[i].Lsh(&p1.coeffs[i], m)
 	}
 	return p, nil
 }
 
-// Rsh sets p to p1 >> m
+// Rsh sets p to p1 >> m, p1 has to be in coefficient form
 func (p *Poly) Rsh(p1 *Poly, m uint32) (*Poly, error) {
 	if p.n != p1.n || !p.q.EqualTo(&p1.q) {
-		return nil, errors.New("unmatched degree or module")
+		return nil, ErrParamMismatch
+	}
+	if p1.isNTT {
+		return nil, errors.New("operation requires coefficient form")
 	}
+	p.isNTT = false
+	p.prepareBigint(p1)
 	for i := range p.coeffs {
 		p.coeffs[i].Rsh(&p1.coeffs[i], m)
 	}
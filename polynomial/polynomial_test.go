@@ -44,7 +44,7 @@ func TestPolynomial(t *testing.T) {
 			p1Coeffs[i].SetInt(int64(tmp))
 		}
 
-		nttParams := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
+		nttParams, _ := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
 		p1, _ := NewPolynomial(uint32(n), *bigint.NewInt(int64(q)), nttParams)
 		p1.SetCoefficients(p1Coeffs)
 
@@ -161,21 +161,21 @@ func TestPolynomial(t *testing.T) {
 		pTest, _ := NewPolynomial(uint32(n), *bigint.NewInt(int64(q)), nttParams)
 		// Test add
 		pTest.AddMod(p1, p2)
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&addCoeffs[i]) {
 				t.Errorf("Error in add coeffs: index %v, value %v", i, pTest.coeffs[i])
 			}
 		}
 		// Test sub
 		pTest.SubMod(p1, p2)
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&subCoeffs[i]) {
 				t.Errorf("Error in sub coeffs: index %v, value %v", i, pTest.coeffs[i])
 			}
 		}
 		// Test neg
 		pTest.Neg(p1)
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&negCoeffs[i]) {
 				t.Errorf("Error in neg coeffs: index %v, value %v", i, pTest.coeffs[i])
 			}
@@ -183,7 +183,7 @@ func TestPolynomial(t *testing.T) {
 		// Test mulCoeffs
 		pTest.MulCoeffs(p1, p2)
 		pTest.Mod(pTest, *bigint.NewInt(int64(q)))
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&mulCoeffsCoeffs[i]) {
 				t.Errorf("Error in mulCoeffs coeffs: index %v, value %v", i, pTest.coeffs[i])
 			}
@@ -191,35 +191,35 @@ func TestPolynomial(t *testing.T) {
 		// Test mulScalar
 		pTest.MulScalar(p1, *bigint.NewInt(int64(scalar)))
 		pTest.Mod(pTest, *bigint.NewInt(int64(q)))
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&mulScalarCoeffs[i]) {
 				t.Errorf("Error in mulScalar coeffs: index %v, value %v", i, pTest.coeffs[i])
 			}
 		}
 		// Test mulPoly
 		pTest.MulPoly(p1, p2)
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&mulPolyCoeffs[i]) {
 				t.Errorf("Error in mulPoly coeffs: index %v, expected %v, got %v", i, mulPolyCoeffs[i], pTest.coeffs[i])
 			}
 		}
 		// Test nativeMulPoly
 		pTest.NaiveMultPoly(p1, p2)
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&mulPolyCoeffs[i]) {
 				t.Errorf("Error in nativeMulPoly coeffs: index %v, expected %v, got %v", i, mulPolyCoeffs[i], pTest.coeffs[i])
 			}
 		}
 		// Test div
 		pTest.Div(p1, *bigint.NewInt(int64(divisor)))
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&divCoeffs[i]) {
 				t.Errorf("Error in div coeffs: index %v, value %v", i, pTest.coeffs[i])
 			}
 		}
 		// Test divRound
 		pTest.DivRound(p1, *bigint.NewInt(int64(divisor)))
-		for i := range pTest.coeffs {
+		for i := range pTest.GetCoefficients() {
 			if !pTest.coeffs[i].EqualTo(&divRoundCoeffs[i]) {
 				t.Errorf("Error in divRound coeffs: DivRound(%v, %v), expected %v, got, %v", p1Coeffs[i].Int64(), divisor, divRoundCoeffs[i], pTest.coeffs[i])
 			}
@@ -227,6 +227,121 @@ func TestPolynomial(t *testing.T) {
 	}
 }
 
+// Test that the form of the polynomials is tracked, and that mixing forms is rejected
+func TestPolynomialForm(t *testing.T) {
+	n := uint32(256)
+	q := bigint.NewInt(7681)
+	nttParams, _ := GenerateNTTParams(n, *q)
+	coeffs1 := make([]bigint.Int, n)
+	coeffs2 := make([]bigint.Int, n)
+	for i := range coeffs1 {
+		coeffs1[i].SetInt(int64(i * 13 % 7681))
+		coeffs2[i].SetInt(int64(i * 29 % 7681))
+	}
+	p1, _ := NewPolynomial(n, *q, nttParams)
+	p2, _ := NewPolynomial(n, *q, nttParams)
+	p, _ := NewPolynomial(n, *q, nttParams)
+	want, _ := NewPolynomial(n, *q, nttParams)
+	p1.SetCoefficients(coeffs1)
+	p2.SetCoefficients(coeffs2)
+	want.NaiveMultPoly(p1, p2)
+
+	if _, err := p1.InverseNTT(); err == nil {
+		t.Errorf("Error in InverseNTT: coefficient form should be rejected")
+	}
+	p2.NTT()
+	if _, err := p2.NTT(); err == nil {
+		t.Errorf("Error in NTT: ntt form should be rejected")
+	}
+	if _, err := p.AddMod(p1, p2); err == nil {
+		t.Errorf("Error in AddMod: mixed forms should be rejected")
+	}
+	if _, err := p.MulCoeffs(p1, p2); err == nil {
+		t.Errorf("Error in MulCoeffs: mixed forms should be rejected")
+	}
+	if _, err := p.Rsh(p2, 1); err == nil {
+		t.Errorf("Error in Rsh: ntt form should be rejected")
+	}
+
+	// MulPoly converts its operands and leaves them unchanged
+	p.MulPoly(p1, p2)
+	if p.IsNTT() || p1.IsNTT() || !p2.IsNTT() {
+		t.Errorf("Error in MulPoly: unexpected forms %v, %v, %v", p.IsNTT(), p1.IsNTT(), p2.IsNTT())
+	}
+	for i := range p.GetCoefficients() {
+		if !p.coeffs[i].EqualTo(&want.coeffs[i]) || !p1.coeffs[i].EqualTo(&coeffs1[i]) {
+			t.Errorf("Error in MulPoly with mixed forms: index %v", i)
+			break
+		}
+	}
+	p1.NTT()
+	p.MulPoly(p1, p2)
+	if !p.IsNTT() {
+		t.Errorf("Error in MulPoly: result should be in ntt form")
+	}
+	p.InverseNTT()
+	for i := range p.GetCoefficients() {
+		if !p.coeffs[i].EqualTo(&want.coeffs[i]) {
+			t.Errorf("Error in MulPoly with ntt forms: index %v", i)
+			break
+		}
+	}
+}
+
+// Test that the automorphisms agree in both forms and compose as galois elements
+func TestAutomorphism(t *testing.T) {
+	n := uint32(256)
+	q := bigint.NewInt(7681)
+	nttParams, _ := GenerateNTTParams(n, *q)
+	coeffs := make([]bigint.Int, n)
+	for i := range coeffs {
+		coeffs[i].SetInt(int64(i * 37 % 7681))
+	}
+	p1, _ := NewPolynomial(n, *q, nttParams)
+	p1.SetCoefficients(coeffs)
+	p, _ := NewPolynomial(n, *q, nttParams)
+	pNTT, _ := NewPolynomial(n, *q, nttParams)
+	pComposed, _ := NewPolynomial(n, *q, nttParams)
+
+	if _, err := p.Automorphism(p1, 2); err == nil {
+		t.Errorf("Error in Automorphism: even galois element should be rejected")
+	}
+	// X -> X^3 maps X^(N/2) to X^(3N/2) = -X^(N/2)
+	p.Automorphism(p1, 3)
+	var want bigint.Int
+	want.Neg(&coeffs[n/2], q)
+	if !p.GetCoefficients()[n/2].EqualTo(&want) {
+		t.Errorf("Error in Automorphism, expected %v, got %v", want.Int64(), p.coeffs[n/2].Int64())
+	}
+
+	for _, k := range []uint32{1, 3, 5, 2 * n - 1, 9 * 2 * n + 7} {
+		p.Automorphism(p1, k)
+		pNTT.Copy(p1)
+		pNTT.NTT()
+		pNTT.Automorphism(pNTT, k)
+		if !pNTT.IsNTT() {
+			t.Errorf("Error in Automorphism: result should be in ntt form")
+		}
+		pNTT.InverseNTT()
+		// (X -> X^k) o (X -> X^3) = X -> X^3k
+		pComposed.Automorphism(p1, 3)
+		pComposed.Automorphism(pComposed, k)
+		p1.Automorphism(p1, 3 * k)
+		got, gotNTT := p.GetCoefficients(), pNTT.GetCoefficients()
+		composed, want := pComposed.GetCoefficients(), p1.GetCoefficients()
+		for i := range got {
+			if !got[i].EqualTo(&gotNTT[i]) {
+				t.Errorf("Error in Automorphism(%v): coefficient and ntt forms differ at index %v", k, i)
+				break
+			}
+			if !composed[i].EqualTo(&want[i]) {
+				t.Errorf("Error in Automorphism(%v): composition differs at index %v", k, i)
+				break
+			}
+		}
+		p1.SetCoefficients(coeffs)
+	}
+}
 
 func BenchmarkPolynomial(b *testing.B) {
 	for i := 0; i <=0; i++ {
@@ -247,7 +362,7 @@ func BenchmarkPolynomial(b *testing.B) {
 			tmp, _ := strconv.Atoi(p1String[i])
 			p1Coeffs[i].SetInt(int64(tmp))
 		}
-		nttParams := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
+		nttParams, _ := GenerateNTTParams(uint32(n), *bigint.NewInt(int64(q)))
 		p1, _ := NewPolynomial(uint32(n), *bigint.NewInt(int64(q)), nttParams)
 		p1.SetCoefficients(p1Coeffs)
 
@@ -0,0 +1,65 @@
+package polynomial
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+)
+
+// primalityRounds is the number of Miller-Rabin rounds used by IsPrime,
+// on top of the Baillie-PSW test, the probability of error is at most 4^-primalityRounds
+const primalityRounds = 20
+
+// IsPrime reports whether q is prime, using the Miller-Rabin and Baillie-PSW tests from math/big.
+// The test is 100% accurate for inputs less than 2^64.
+func IsPrime(q *bigint.Int) bool {
+	return q.Value.ProbablyPrime(primalityRounds)
+}
+
+// maxPrimeBitLen is the largest bit length of the primes generated by GenerateNTTPrimes
+const maxPrimeBitLen = 4096
+
+// GenerateNTTPrimes returns count distinct primes of bitLen bits which are equal to 1 mod 2N,
+// so that they can be used as NTT-friendly moduli of polynomials of degree N.
+// The primes are returned in decreasing order, starting from the largest one.
+// bitLen has to be in [2, maxPrimeBitLen] and count positive.
+func GenerateNTTPrimes(N uint32, bitLen uint32, count int) ([]bigint.Int, error) {
+	if N == 0 || (N & (N - 1)) != 0 {
+		return nil, ErrBadDegree
+	}
+	if bitLen < 2 || bitLen > maxPrimeBitLen {
+		return nil, errors.New("bit length of the primes out of range")
+	}
+	if count <= 0 {
+		return nil, errors.New("number of primes should be positive")
+	}
+	twoN := bigint.NewInt(2 * int64(N))
+	min := new(bigint.Int).Lsh(bigint.NewInt(1), bitLen-1)
+	if twoN.Compare(min) != -1 {
+		return nil, errors.New("bit length is too small for the polynomial degree N")
+	}
+
+	// there are 2^(bitLen - 1) / 2N candidates of bitLen bits, so that larger counts cannot be reached
+	if candidates := new(bigint.Int).Div(min, twoN); candidates.Compare(bigint.NewInt(int64(count))) == -1 {
+		return nil, errors.New("not enough NTT-friendly primes of the given bit length")
+	}
+
+	// candidates are of the form k * 2N + 1, starting from the largest one below 2^bitLen
+	candidate := new(bigint.Int).Lsh(bigint.NewInt(1), bitLen)
+	candidate.Sub(candidate, bigint.NewInt(1))
+	candidate.Sub(candidate, new(bigint.Int).Mod(candidate, twoN))
+	candidate.Add(candidate, bigint.NewInt(1))
+
+	var primes []bigint.Int
+	for len(primes) < count {
+		if candidate.Compare(min) == -1 {
+			return nil, errors.New("not enough NTT-friendly primes of the given bit length")
+		}
+		if IsPrime(candidate) {
+			prime := new(bigint.Int)
+			prime.SetBigInt(candidate)
+			primes = append(primes, *prime)
+		}
+		candidate.Sub(candidate, twoN)
+	}
+	return primes, nil
+}
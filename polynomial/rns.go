@@ -0,0 +1,299 @@
+package polynomial
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+)
+
+// RNSParams holds a chain of NTT-friendly primes q_0, ..., q_{k-1},
+// together with the constants used by the Chinese Remainder Theorem (CRT) reconstruction.
+// A polynomial modulo Q = q_0 * ... * q_{k-1} is represented by one residue polynomial per prime,
+// so that large moduli can be handled with the native backend.
+type RNSParams struct {
+	n uint32
+	Q bigint.Int // product of the moduli
+	Moduli []bigint.Int
+	NttParams []*NttParams // NTT params of each modulus
+	qHat []bigint.Int // Q / q_i
+	qHatInv []uint64 // (Q / q_i)^-1 mod q_i
+	qHatInvShoup []uint64
+}
+
+// GenerateRNSParams generates the RNS params of degree N for the given chain of primes,
+// every prime has to be smaller than 2^62 and equal to 1 mod 2N, otherwise ErrModulusNotNTTFriendly is returned.
+func GenerateRNSParams(N uint32, moduli []bigint.Int) (*RNSParams, error) {
+	if len(moduli) == 0 {
+		return nil, errors.New("empty modulus chain")
+	}
+	params := new(RNSParams)
+	params.n = N
+	params.Q.SetInt(1)
+	params.Moduli = make([]bigint.Int, len(moduli))
+	params.NttParams = make([]*NttParams, len(moduli))
+	for i := range moduli {
+		for j := 0; j < i; j++ {
+			if moduli[i].EqualTo(&moduli[j]) {
+				return nil, errors.New("moduli of the chain should be distinct")
+			}
+		}
+		if moduli[i].Value.BitLen() > bigint.ModulusMaxBitLen {
+			return nil, ErrModulusNotNTTFriendly
+		}
+		params.Moduli[i].SetBigInt(&moduli[i])
+		nttParams, err := GenerateNTTParams(N, moduli[i])
+		if err != nil {
+			return nil, err
+		}
+		params.NttParams[i] = nttParams
+		params.Q.Mul(&params.Q, &moduli[i])
+	}
+
+	params.qHat = make([]bigint.Int, len(moduli))
+	params.qHatInv = make([]uint64, len(moduli))
+	params.qHatInvShoup = make([]uint64, len(moduli))
+	var tmp bigint.Int
+	for i := range moduli {
+		params.qHat[i].Div(&params.Q, &moduli[i])
+		tmp.Mod(&params.qHat[i], &moduli[i])
+		tmp.Inv(&tmp, &moduli[i])
+		params.qHatInv[i] = tmp.Value.Uint64()
+		params.qHatInvShoup[i] = params.NttParams[i].native.modulus.ShoupConstant(params.qHatInv[i])
+	}
+	return params, nil
+}
+
+// N returns the polynomial degree of params
+func (params *RNSParams) N() uint32 {
+	return params.n
+}
+
+// RNSPoly is a polynomial modulo Q represented by its residues modulo each prime of an RNSParams chain
+type RNSPoly struct {
+	coeffs [][]uint64 // coeffs[i] holds the coefficients modulo the i-th prime
+	params *RNSParams
+	isNTT bool // true if the residues are the NTT evaluations of the polynomial
+}
+
+// NewRNSPolynomial creates a new zero RNS polynomial with the given params
+func NewRNSPolynomial(params *RNSParams) (*RNSPoly, error) {
+	if params == nil {
+		return nil, errors.New("invalid rns params")
+	}
+	p := new(RNSPoly)
+	p.params = params
+	p.coeffs = make([][]uint64, len(params.Moduli))
+	for i := range p.coeffs {
+		p.coeffs[i] = make([]uint64, params.n)
+	}
+	return p, nil
+}
+
+// GetRNSParams returns the RNS params of polynomial p
+func (p *RNSPoly) GetRNSParams() *RNSParams {
+	return p.params
+}
+
+// IsNTT reports whether polynomial p is in NTT form
+func (p *RNSPoly) IsNTT() bool {
+	return p.isNTT
+}
+
+// SetCoefficients decomposes coeffs into their residues modulo each prime of the chain,
+// the coefficients are interpreted in the current form of p
+func (p *RNSPoly) SetCoefficients(coeffs []bigint.Int) error {
+	if uint32(len(coeffs)) != p.params.n {
+		return errors.New("provided coeffs has different length with target polynomial")
+	}
+	var tmp bigint.Int
+	for i := range p.coeffs {
+		for j := range coeffs {
+			tmp.Mod(&coeffs[j], &p.params.Moduli[i])
+			p.coeffs[i][j] = tmp.Value.Uint64()
+		}
+	}
+	return nil
+}
+
+// GetCoefficients reconstructs the coefficients of p in [0, Q) with the CRT, in the current form of p
+func (p *RNSPoly) GetCoefficients() []bigint.Int {
+	coeffs := make([]bigint.Int, p.params.n)
+	p.reconstruct(coeffs)
+	return coeffs
+}
+
+// reconstruct sets coeffs to the coefficients of p in [0, Q) with the CRT
+func (p *RNSPoly) reconstruct(coeffs []bigint.Int) {
+	for j := range coeffs {
+		coeffs[j].Value.SetUint64(0)
+	}
+	var tmp bigint.Int
+	for i := range p.coeffs {
+		m := p.params.NttParams[i].native.modulus
+		for j := range coeffs {
+			// x = sum_i [x_i * (Q/q_i)^-1]_{q_i} * Q/q_i mod Q
+			tmp.Value.SetUint64(m.ShoupMul(p.coeffs[i][j], p.params.qHatInv[i], p.params.qHatInvShoup[i]))
+			tmp.Mul(&tmp, &p.params.qHat[i])
+			coeffs[j].Add(&coeffs[j], &tmp)
+		}
+	}
+	for j := range coeffs {
+		coeffs[j].Mod(&coeffs[j], &p.params.Q)
+	}
+}
+
+// GetResidues returns the coefficients of p modulo the i-th prime of the chain
+func (p *RNSPoly) GetResidues(i int) []uint64 {
+	return p.coeffs[i]
+}
+
+// Copy sets p to a copy of p1, including the form of p1
+func (p *RNSPoly) Copy(p1 *RNSPoly) (*RNSPoly, error) {
+	if p.params != p1.params {
+		return nil, ErrParamMismatch
+	}
+	for i := range p.coeffs {
+		copy(p.coeffs[i], p1.coeffs[i])
+	}
+	p.isNTT = p1.isNTT
+	return p, nil
+}
+
+// NTT performs the number theoretic transform on each residue polynomial of p,
+// p has to be in coefficient form, and is in NTT form afterwards.
+func (p *RNSPoly) NTT() (*RNSPoly, error) {
+	if p.isNTT {
+		return nil, errors.New("polynomial is already in ntt form")
+	}
+	for i := range p.coeffs {
+		nttNative(p.coeffs[i], p.params.NttParams[i].native)
+	}
+	p.isNTT = true
+	return p, nil
+}
+
+// InverseNTT performs the inverse number theoretic transform on each residue polynomial of p,
+// p has to be in NTT form, and is in coefficient form afterwards.
+func (p *RNSPoly) InverseNTT() (*RNSPoly, error) {
+	if !p.isNTT {
+		return nil, errors.New("polynomial is not in ntt form")
+	}
+	for i := range p.coeffs {
+		inverseNTTNative(p.coeffs[i], p.params.NttParams[i].native)
+	}
+	p.isNTT = false
+	return p, nil
+}
+
+// AddMod adds then mod the residues of p1 and p2
+func (p *RNSPoly) AddMod(p1, p2 *RNSPoly) (*RNSPoly, error) {
+	if p.params != p1.params || p.params != p2.params {
+		return nil, ErrParamMismatch
+	}
+	if p1.isNTT != p2.isNTT {
+		return nil, errors.New("mixed coefficient form and ntt form operands")
+	}
+	p.isNTT = p1.isNTT
+	for i := range p.coeffs {
+		m := p.params.NttParams[i].native.modulus
+		for j := range p.coeffs[i] {
+			p.coeffs[i][j] = m.Add(p1.coeffs[i][j], p2.coeffs[i][j])
+		}
+	}
+	return p, nil
+}
+
+// SubMod subtracts then mod the residues of p1 and p2
+func (p *RNSPoly) SubMod(p1, p2 *RNSPoly) (*RNSPoly, error) {
+	if p.params != p1.params || p.params != p2.params {
+		return nil, ErrParamMismatch
+	}
+	if p1.isNTT != p2.isNTT {
+		return nil, errors.New("mixed coefficient form and ntt form operands")
+	}
+	p.isNTT = p1.isNTT
+	for i := range p.coeffs {
+		m := p.params.NttParams[i].native.modulus
+		for j := range p.coeffs[i] {
+			p.coeffs[i][j] = m.Sub(p1.coeffs[i][j], p2.coeffs[i][j])
+		}
+	}
+	return p, nil
+}
+
+// Neg sets p to the negative of p1
+func (p *RNSPoly) Neg(p1 *RNSPoly) (*RNSPoly, error) {
+	if p.params != p1.params {
+		return nil, ErrParamMismatch
+	}
+	p.isNTT = p1.isNTT
+	for i := range p.coeffs {
+		m := p.params.NttParams[i].native.modulus
+		for j := range p.coeffs[i] {
+			p.coeffs[i][j] = m.Neg(p1.coeffs[i][j])
+		}
+	}
+	return p, nil
+}
+
+// MulCoeffs multiplies then mod the residues of p1 and p2 coefficient-wise
+func (p *RNSPoly) MulCoeffs(p1, p2 *RNSPoly) (*RNSPoly, error) {
+	if p.params != p1.params || p.params != p2.params {
+		return nil, ErrParamMismatch
+	}
+	if p1.isNTT != p2.isNTT {
+		return nil, errors.New("mixed coefficient form and ntt form operands")
+	}
+	p.isNTT = p1.isNTT
+	for i := range p.coeffs {
+		m := p.params.NttParams[i].native.modulus
+		for j := range p.coeffs[i] {
+			p.coeffs[i][j] = m.Mul(p1.coeffs[i][j], p2.coeffs[i][j])
+		}
+	}
+	return p, nil
+}
+
+// MulScalar multiplies each coefficient of p1 with scalar mod Q
+func (p *RNSPoly) MulScalar(p1 *RNSPoly, scalar bigint.Int) (*RNSPoly, error) {
+	if p.params != p1.params {
+		return nil, ErrParamMismatch
+	}
+	p.isNTT = p1.isNTT
+	var tmp bigint.Int
+	for i := range p.coeffs {
+		m := p.params.NttParams[i].native.modulus
+		s := tmp.Mod(&scalar, &p.params.Moduli[i]).Value.Uint64()
+		sShoup := m.ShoupConstant(s)
+		for j := range p.coeffs[i] {
+			p.coeffs[i][j] = m.ShoupMul(p1.coeffs[i][j], s, sShoup)
+		}
+	}
+	return p, nil
+}
+
+// MulPoly multiplies p1 and p2 in polynomial style, p1 and p2 are left unchanged.
+// The operands are converted to NTT form when needed,
+// and the result is in NTT form only if both operands are.
+func (p *RNSPoly) MulPoly(p1, p2 *RNSPoly) (*RNSPoly, error) {
+	if p.params != p1.params || p.params != p2.params {
+		return nil, ErrParamMismatch
+	}
+	isNTT := p1.isNTT && p2.isNTT
+	tmp, err := NewRNSPolynomial(p.params)
+	if err != nil {
+		return nil, err
+	}
+	tmp.Copy(p2)
+	if !tmp.isNTT {
+		tmp.NTT()
+	}
+	p.Copy(p1)
+	if !p.isNTT {
+		p.NTT()
+	}
+	p.MulCoeffs(p, tmp)
+	if !isNTT {
+		p.InverseNTT()
+	}
+	return p, nil
+}
@@ -0,0 +1,202 @@
+package polynomial
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+	"math/bits"
+)
+
+// This file implements the conversions between RNS bases used by the full-RNS variant of FV,
+// following https://eprint.iacr.org/2018/117.pdf (HPS). The rounding steps are computed exactly
+// with 128-bit fixed point fractions instead of floating point numbers.
+
+// fixedPoint accumulates sums of the form sum_i x_i * f_i,
+// where x_i are words and f_i are fractions in [0, 1) stored with 128 bits of precision.
+type fixedPoint struct {
+	wholeHi, wholeLo uint64 // integer part
+	fracHi, fracLo uint64 // fractional part
+}
+
+// addMul adds x * f to a, where f = (fHi * 2^64 + fLo) / 2^128
+func (a *fixedPoint) addMul(x, fHi, fLo uint64) {
+	var c uint64
+	// x * fLo contributes to the words 2^-64 and 2^-128
+	h, l := bits.Mul64(x, fLo)
+	a.fracLo, c = bits.Add64(a.fracLo, l, 0)
+	a.fracHi, c = bits.Add64(a.fracHi, h, c)
+	a.wholeLo, c = bits.Add64(a.wholeLo, 0, c)
+	a.wholeHi += c
+	// x * fHi contributes to the words 2^0 and 2^-64
+	h, l = bits.Mul64(x, fHi)
+	a.fracHi, c = bits.Add64(a.fracHi, l, 0)
+	a.wholeLo, c = bits.Add64(a.wholeLo, h, c)
+	a.wholeHi += c
+}
+
+// roundMod returns round(a) mod q
+func (a *fixedPoint) roundMod(m *bigint.Modulus) uint64 {
+	_, r := bits.Div64(a.wholeHi%m.Q, a.wholeLo, m.Q)
+	return m.Add(r, a.fracHi>>63)
+}
+
+// reset sets a to zero
+func (a *fixedPoint) reset() {
+	*a = fixedPoint{}
+}
+
+// fraction returns floor(x * 2^128 / q) as a pair of words, x has to be in [0, q)
+func fraction(x, q *bigint.Int) (uint64, uint64) {
+	f := new(bigint.Int).Lsh(x, 128)
+	f.Div(f, q)
+	lo := f.Value.Uint64()
+	f.Rsh(f, 64)
+	return f.Value.Uint64(), lo
+}
+
+// BasisExtender converts RNS polynomials from a basis Q to a basis P.
+// The coefficients are lifted exactly from their centered representatives in (-Q/2, Q/2].
+type BasisExtender struct {
+	from, to *RNSParams
+	qHatModP [][]uint64 // qHatModP[i][j] = (Q / q_i) mod p_j
+	qModP []uint64 // Q mod p_j
+	qInvHi, qInvLo []uint64 // 1 / q_i as fixed point fractions
+}
+
+// NewBasisExtender creates a BasisExtender from the basis from to the basis to
+func NewBasisExtender(from, to *RNSParams) (*BasisExtender, error) {
+	if from == nil || to == nil {
+		return nil, errors.New("invalid rns params")
+	}
+	if from.n != to.n {
+		return nil, ErrParamMismatch
+	}
+	be := &BasisExtender{from: from, to: to}
+	var tmp bigint.Int
+	be.qHatModP = make([][]uint64, len(from.Moduli))
+	be.qInvHi = make([]uint64, len(from.Moduli))
+	be.qInvLo = make([]uint64, len(from.Moduli))
+	for i := range from.Moduli {
+		be.qHatModP[i] = make([]uint64, len(to.Moduli))
+		for j := range to.Moduli {
+			be.qHatModP[i][j] = tmp.Mod(&from.qHat[i], &to.Moduli[j]).Value.Uint64()
+		}
+		be.qInvHi[i], be.qInvLo[i] = fraction(bigint.NewInt(1), &from.Moduli[i])
+	}
+	be.qModP = make([]uint64, len(to.Moduli))
+	for j := range to.Moduli {
+		be.qModP[j] = tmp.Mod(&from.Q, &to.Moduli[j]).Value.Uint64()
+	}
+	return be, nil
+}
+
+// Convert sets pTo to p expressed in the target basis, both polynomials have to be in coefficient form.
+// For each coefficient x, Convert computes y_i = [x_i * (Q/q_i)^-1]_{q_i} and
+// x = sum_i y_i * Q/q_i - v * Q with v = round(sum_i y_i / q_i).
+func (be *BasisExtender) Convert(p, pTo *RNSPoly) (*RNSPoly, error) {
+	if p.params != be.from || pTo.params != be.to {
+		return nil, ErrParamMismatch
+	}
+	if p.isNTT {
+		return nil, errors.New("operation requires coefficient form")
+	}
+	pTo.isNTT = false
+	var v fixedPoint
+	y := make([]uint64, len(p.coeffs))
+	for k := uint32(0); k < be.from.n; k++ {
+		v.reset()
+		for i := range p.coeffs {
+			m := be.from.NttParams[i].native.modulus
+			y[i] = m.ShoupMul(p.coeffs[i][k], be.from.qHatInv[i], be.from.qHatInvShoup[i])
+			v.addMul(y[i], be.qInvHi[i], be.qInvLo[i])
+		}
+		for j := range pTo.coeffs {
+			m := be.to.NttParams[j].native.modulus
+			var sum uint64
+			for i := range y {
+				sum = m.Add(sum, m.Mul(y[i], be.qHatModP[i][j]))
+			}
+			vQ := m.Mul(v.roundMod(m), be.qModP[j])
+			pTo.coeffs[j][k] = m.Sub(sum, vQ)
+		}
+	}
+	return pTo, nil
+}
+
+// Scaler computes round(t * x / Q) mod P, for x given by its residues in the basis Q ∪ P.
+// The result is exact as long as |x| < Q * P / 2.
+type Scaler struct {
+	q, p *RNSParams
+	wholeModP [][]uint64 // wholeModP[i][j] = floor(t * P * e_i / q_i) mod p_j, with e_i = (Q*P / q_i)^-1 mod q_i
+	fracHi, fracLo []uint64 // frac(t * P * e_i / q_i) as fixed point fractions
+	tQInvModP []uint64 // t * Q^-1 mod p_j
+	tQInvModPShoup []uint64
+}
+
+// NewScaler creates a Scaler dividing by the product of q and rounding into p
+func NewScaler(t bigint.Int, q, p *RNSParams) (*Scaler, error) {
+	if q == nil || p == nil {
+		return nil, errors.New("invalid rns params")
+	}
+	if q.n != p.n {
+		return nil, ErrParamMismatch
+	}
+	s := &Scaler{q: q, p: p}
+	var m, tmp, w, r bigint.Int
+	m.Mul(&q.Q, &p.Q)
+	s.wholeModP = make([][]uint64, len(q.Moduli))
+	s.fracHi = make([]uint64, len(q.Moduli))
+	s.fracLo = make([]uint64, len(q.Moduli))
+	for i := range q.Moduli {
+		// w = t * P * e_i, split into w / q_i = whole + r / q_i
+		tmp.Div(&m, &q.Moduli[i])
+		tmp.Mod(&tmp, &q.Moduli[i])
+		tmp.Inv(&tmp, &q.Moduli[i])
+		w.Mul(&t, &p.Q)
+		w.Mul(&w, &tmp)
+		r.Mod(&w, &q.Moduli[i])
+		w.Div(&w, &q.Moduli[i])
+		s.wholeModP[i] = make([]uint64, len(p.Moduli))
+		for j := range p.Moduli {
+			s.wholeModP[i][j] = tmp.Mod(&w, &p.Moduli[j]).Value.Uint64()
+		}
+		s.fracHi[i], s.fracLo[i] = fraction(&r, &q.Moduli[i])
+	}
+	s.tQInvModP = make([]uint64, len(p.Moduli))
+	s.tQInvModPShoup = make([]uint64, len(p.Moduli))
+	for j := range p.Moduli {
+		tmp.Inv(&q.Q, &p.Moduli[j])
+		tmp.Mul(&tmp, &t)
+		s.tQInvModP[j] = tmp.Mod(&tmp, &p.Moduli[j]).Value.Uint64()
+		s.tQInvModPShoup[j] = p.NttParams[j].native.modulus.ShoupConstant(s.tQInvModP[j])
+	}
+	return s, nil
+}
+
+// Scale sets pOut to round(t * x / Q) mod P, where x is given by its residues xQ in the basis Q
+// and xP in the basis P. All the polynomials have to be in coefficient form.
+func (s *Scaler) Scale(xQ, xP, pOut *RNSPoly) (*RNSPoly, error) {
+	if xQ.params != s.q || xP.params != s.p || pOut.params != s.p {
+		return nil, ErrParamMismatch
+	}
+	if xQ.isNTT || xP.isNTT {
+		return nil, errors.New("operation requires coefficient form")
+	}
+	pOut.isNTT = false
+	var frac fixedPoint
+	for k := uint32(0); k < s.q.n; k++ {
+		frac.reset()
+		for i := range xQ.coeffs {
+			frac.addMul(xQ.coeffs[i][k], s.fracHi[i], s.fracLo[i])
+		}
+		for j := range pOut.coeffs {
+			m := s.p.NttParams[j].native.modulus
+			sum := frac.roundMod(m)
+			for i := range xQ.coeffs {
+				sum = m.Add(sum, m.Mul(xQ.coeffs[i][k], s.wholeModP[i][j]))
+			}
+			sum = m.Add(sum, m.ShoupMul(xP.coeffs[j][k], s.tQInvModP[j], s.tQInvModPShoup[j]))
+			pOut.coeffs[j][k] = sum
+		}
+	}
+	return pOut, nil
+}
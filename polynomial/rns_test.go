@@ -0,0 +1,348 @@
+package polynomial
+
+import (
+	"testing"
+	"github.com/dedis/lago/bigint"
+	"math/rand"
+)
+
+// Cross-verify the RNS polynomials with the bigint polynomials modulo the product of the chain
+func TestRNSPolynomial(t *testing.T) {
+	n := uint32(256)
+	moduli := []bigint.Int{
+		*bigint.NewInt(7681),
+		*bigint.NewInt(12289),
+		*bigint.NewIntFromString("1152921504382476289"),
+		*bigint.NewIntFromString("4611686018326724609"),
+	}
+	params, err := GenerateRNSParams(n, moduli)
+	if err != nil {
+		t.Fatalf("Error in GenerateRNSParams: %v", err)
+	}
+
+	coeffs1 := make([]bigint.Int, n)
+	coeffs2 := make([]bigint.Int, n)
+	rnd := rand.New(rand.NewSource(1))
+	for i := range coeffs1 {
+		coeffs1[i].Value.Rand(rnd, &params.Q.Value)
+		coeffs2[i].Value.Rand(rnd, &params.Q.Value)
+	}
+	p1, _ := NewRNSPolynomial(params)
+	p2, _ := NewRNSPolynomial(params)
+	p, _ := NewRNSPolynomial(params)
+	p1.SetCoefficients(coeffs1)
+	p2.SetCoefficients(coeffs2)
+	b1, _ := NewPolynomial(n, params.Q, nil)
+	b2, _ := NewPolynomial(n, params.Q, nil)
+	b, _ := NewPolynomial(n, params.Q, nil)
+	b1.SetCoefficients(coeffs1)
+	b2.SetCoefficients(coeffs2)
+
+	check := func(name string) {
+		coeffs := p.GetCoefficients()
+		for i := range coeffs {
+			if !coeffs[i].EqualTo(&b.coeffs[i]) {
+				t.Errorf("Error in rns %v: index %v, expected %v, got %v", name, i, b.coeffs[i].Value.String(), coeffs[i].Value.String())
+				return
+			}
+		}
+	}
+
+	// Test CRT reconstruction
+	p.SetCoefficients(coeffs1)
+	b.SetCoefficients(coeffs1)
+	check("SetCoefficients")
+	// Test NTT and InverseNTT
+	p.NTT()
+	p.InverseNTT()
+	check("InverseNTT")
+
+	p.AddMod(p1, p2)
+	b.AddMod(b1, b2)
+	check("AddMod")
+	p.SubMod(p1, p2)
+	b.SubMod(b1, b2)
+	check("SubMod")
+	p.Neg(p1)
+	b.Neg(b1)
+	check("Neg")
+	p.MulCoeffs(p1, p2)
+	b.MulCoeffs(b1, b2)
+	b.Mod(b, params.Q)
+	check("MulCoeffs")
+	p.MulScalar(p1, coeffs2[0])
+	b.MulScalar(b1, coeffs2[0])
+	b.Mod(b, params.Q)
+	check("MulScalar")
+	p.MulPoly(p1, p2)
+	b.NaiveMultPoly(b1, b2)
+	check("MulPoly")
+}
+
+// Test that the form of the RNS polynomials is tracked, and that mixing forms is rejected
+func TestRNSPolynomialForm(t *testing.T) {
+	n := uint32(256)
+	params, _ := GenerateRNSParams(n, []bigint.Int{*bigint.NewInt(7681), *bigint.NewInt(12289)})
+	coeffs1 := make([]bigint.Int, n)
+	coeffs2 := make([]bigint.Int, n)
+	for i := range coeffs1 {
+		coeffs1[i].SetInt(int64(i * 13))
+		coeffs2[i].SetInt(int64(i * 29))
+	}
+	p1, _ := NewRNSPolynomial(params)
+	p2, _ := NewRNSPolynomial(params)
+	p, _ := NewRNSPolynomial(params)
+	want, _ := NewRNSPolynomial(params)
+	p1.SetCoefficients(coeffs1)
+	p2.SetCoefficients(coeffs2)
+	want.MulPoly(p1, p2)
+
+	if _, err := p1.InverseNTT(); err == nil {
+		t.Errorf("Error in InverseNTT: coefficient form should be rejected")
+	}
+	p2.NTT()
+	if !p2.IsNTT() {
+		t.Errorf("Error in NTT: polynomial should be in ntt form")
+	}
+	if _, err := p2.NTT(); err == nil {
+		t.Errorf("Error in NTT: ntt form should be rejected")
+	}
+	if _, err := p.AddMod(p1, p2); err == nil {
+		t.Errorf("Error in AddMod: mixed forms should be rejected")
+	}
+	if _, err := p.SubMod(p1, p2); err == nil {
+		t.Errorf("Error in SubMod: mixed forms should be rejected")
+	}
+	if _, err := p.MulCoeffs(p1, p2); err == nil {
+		t.Errorf("Error in MulCoeffs: mixed forms should be rejected")
+	}
+	p.Neg(p2)
+	if !p.IsNTT() {
+		t.Errorf("Error in Neg: result should be in ntt form")
+	}
+	extender, _ := NewBasisExtender(params, params)
+	if _, err := extender.Convert(p2, p); err == nil {
+		t.Errorf("Error in Convert: ntt form should be rejected")
+	}
+
+	// MulPoly converts its operands and leaves them unchanged
+	p.MulPoly(p1, p2)
+	if p.IsNTT() || p1.IsNTT() || !p2.IsNTT() {
+		t.Errorf("Error in MulPoly: unexpected forms %v, %v, %v", p.IsNTT(), p1.IsNTT(), p2.IsNTT())
+	}
+	got, expected := p.GetCoefficients(), want.GetCoefficients()
+	for i := range got {
+		if !got[i].EqualTo(&expected[i]) {
+			t.Errorf("Error in MulPoly with mixed forms: index %v", i)
+			break
+		}
+	}
+	p1.NTT()
+	p.MulPoly(p1, p2)
+	if !p.IsNTT() {
+		t.Errorf("Error in MulPoly: result should be in ntt form")
+	}
+	p.InverseNTT()
+	got = p.GetCoefficients()
+	for i := range got {
+		if !got[i].EqualTo(&expected[i]) {
+			t.Errorf("Error in MulPoly with ntt forms: index %v", i)
+			break
+		}
+	}
+}
+
+// Cross-verify the polynomials holding their residues modulo a product of primes with the bigint polynomials,
+// and check that the residues are read and written without going through the bigint coefficients
+func TestRNSBackend(t *testing.T) {
+	n := uint32(64)
+	moduli, _ := GenerateNTTPrimes(n, 61, 2)
+	nttParams, err := GenerateNTTParamsRNS(n, moduli)
+	if err != nil {
+		t.Fatalf("Error in GenerateNTTParamsRNS: %v", err)
+	}
+	rnsParams := nttParams.RNSParams()
+	if rnsParams == nil {
+		t.Fatalf("Error in GenerateNTTParamsRNS: no RNS params for a product of primes")
+	}
+	bigNttParams := *nttParams
+	bigNttParams.rns = nil
+	q := nttParams.q
+
+	coeffs1 := make([]bigint.Int, n)
+	coeffs2 := make([]bigint.Int, n)
+	rnd := rand.New(rand.NewSource(1))
+	for i := range coeffs1 {
+		coeffs1[i].Value.Rand(rnd, &q.Value)
+		coeffs2[i].Value.Rand(rnd, &q.Value)
+	}
+	p1, _ := NewPolynomial(n, q, nttParams)
+	p2, _ := NewPolynomial(n, q, nttParams)
+	p, _ := NewPolynomial(n, q, nttParams)
+	p1.SetCoefficients(coeffs1)
+	p2.SetCoefficients(coeffs2)
+	b1, _ := NewPolynomial(n, q, &bigNttParams)
+	b2, _ := NewPolynomial(n, q, &bigNttParams)
+	b, _ := NewPolynomial(n, q, &bigNttParams)
+	b1.SetCoefficients(coeffs1)
+	b2.SetCoefficients(coeffs2)
+
+	check := func(name string) {
+		if p.IsNTT() != b.IsNTT() {
+			t.Errorf("Error in rns backend %v: form %v, expected %v", name, p.IsNTT(), b.IsNTT())
+		}
+		coeffs, want := p.GetCoefficients(), b.GetCoefficients()
+		for i := range coeffs {
+			if !coeffs[i].EqualTo(&want[i]) {
+				t.Errorf("Error in rns backend %v: index %v, expected %v, got %v", name, i, want[i].Value.String(), coeffs[i].Value.String())
+				return
+			}
+		}
+	}
+
+	p.AddMod(p1, p2)
+	b.AddMod(b1, b2)
+	check("AddMod")
+	p.SubMod(p1, p2)
+	b.SubMod(b1, b2)
+	check("SubMod")
+	p.Neg(p1)
+	b.Neg(b1)
+	check("Neg")
+	p.MulCoeffs(p1, p2)
+	b.MulCoeffs(b1, b2)
+	check("MulCoeffs")
+	p.MulPoly(p1, p2)
+	b.MulPoly(b1, b2)
+	check("MulPoly")
+	p.Copy(p1)
+	b.Copy(b1)
+	p.NTT()
+	if !p.coeffsStale {
+		t.Errorf("Error in rns backend: bigint coefficients synced by NTT")
+	}
+	b.NTT()
+	check("NTT")
+	p.InverseNTT()
+	b.InverseNTT()
+	check("InverseNTT")
+
+	// the residues of the NTT form modulo Q are the NTT forms modulo each prime
+	p.NTT()
+	pRNS, _ := NewRNSPolynomial(rnsParams)
+	if err = p.GetRNS(pRNS); err != nil {
+		t.Fatalf("Error in GetRNS: %v", err)
+	}
+	if !pRNS.IsNTT() {
+		t.Errorf("Error in GetRNS: residues should be in ntt form")
+	}
+	pRNS.InverseNTT()
+	want, _ := NewRNSPolynomial(rnsParams)
+	want.SetCoefficients(coeffs1)
+	for i := range moduli {
+		residues, wantResidues := pRNS.GetResidues(i), want.GetResidues(i)
+		for j := range residues {
+			if residues[j] != wantResidues[j] {
+				t.Fatalf("Error in GetRNS: residue %v of index %v, expected %v, got %v", i, j, wantResidues[j], residues[j])
+			}
+		}
+	}
+	pRNS.NTT()
+	p.SetCoefficients(coeffs2)
+	if err = p.SetRNS(pRNS); err != nil {
+		t.Fatalf("Error in SetRNS: %v", err)
+	}
+	if !p.coeffsStale {
+		t.Errorf("Error in SetRNS: bigint coefficients should be synced lazily")
+	}
+	b.Copy(b1)
+	b.NTT()
+	check("SetRNS")
+
+	// other bases of the same modulus go through the CRT
+	otherParams, _ := GenerateRNSParams(n, moduli)
+	other, _ := NewRNSPolynomial(otherParams)
+	other.SetCoefficients(coeffs1)
+	if err = p.SetRNS(other); err != nil {
+		t.Fatalf("Error in SetRNS with another basis: %v", err)
+	}
+	b.Copy(b1)
+	check("SetRNS with another basis")
+}
+
+func TestGenerateRNSParams(t *testing.T) {
+	// moduli larger than 2^62 are not supported
+	primes, _ := GenerateNTTPrimes(32, 63, 1)
+	_, err := GenerateRNSParams(32, primes)
+	if err == nil {
+		t.Errorf("GenerateRNSParams should reject moduli larger than 2^62")
+	}
+	// duplicated moduli are not supported
+	_, err = GenerateRNSParams(32, []bigint.Int{*bigint.NewInt(7681), *bigint.NewInt(7681)})
+	if err == nil {
+		t.Errorf("GenerateRNSParams should reject duplicated moduli")
+	}
+}
+
+// Test the exact base conversion and the scaling by t/Q against bigint computations
+func TestRNSConversion(t *testing.T) {
+	n := uint32(32)
+	q, _ := GenerateRNSParams(n, []bigint.Int{*bigint.NewInt(8380417), *bigint.NewInt(7681)})
+	p, _ := GenerateRNSParams(n, []bigint.Int{*bigint.NewIntFromString("1916612249959137281"), *bigint.NewIntFromString("1584484193487290369")})
+	plainModulus := bigint.NewInt(65537)
+	extender, err := NewBasisExtender(q, p)
+	if err != nil {
+		t.Fatalf("Error in NewBasisExtender: %v", err)
+	}
+	scaler, err := NewScaler(*plainModulus, q, p)
+	if err != nil {
+		t.Fatalf("Error in NewScaler: %v", err)
+	}
+
+	// centered coefficients in (-Q/2, Q/2]
+	rnd := rand.New(rand.NewSource(1))
+	halfQ := new(bigint.Int).Div(&q.Q, bigint.NewInt(2))
+	coeffs := make([]bigint.Int, n)
+	for i := range coeffs {
+		coeffs[i].Value.Rand(rnd, &q.Q.Value)
+		if coeffs[i].Compare(halfQ) == 1 {
+			coeffs[i].Sub(&coeffs[i], &q.Q)
+		}
+	}
+	xQ, _ := NewRNSPolynomial(q)
+	xP, _ := NewRNSPolynomial(p)
+	xQ.SetCoefficients(coeffs)
+	extender.Convert(xQ, xP)
+	got := xP.GetCoefficients()
+	var want bigint.Int
+	for i := range coeffs {
+		want.Mod(&coeffs[i], &p.Q)
+		if !got[i].EqualTo(&want) {
+			t.Errorf("Error in Convert: index %v, expected %v, got %v", i, want.Value.String(), got[i].Value.String())
+		}
+	}
+
+	// coefficients bounded by Q * P / 4
+	bound := new(bigint.Int).Mul(&q.Q, &p.Q)
+	bound.Div(bound, bigint.NewInt(4))
+	for i := range coeffs {
+		coeffs[i].Value.Rand(rnd, &bound.Value)
+		if i&1 == 1 {
+			coeffs[i].Neg(&coeffs[i], bound)
+			coeffs[i].Sub(&coeffs[i], bound)
+		}
+	}
+	xQ.SetCoefficients(coeffs)
+	xP.SetCoefficients(coeffs)
+	yP, _ := NewRNSPolynomial(p)
+	scaler.Scale(xQ, xP, yP)
+	got = yP.GetCoefficients()
+	for i := range coeffs {
+		want.Mul(&coeffs[i], plainModulus)
+		want.DivRound(&want, &q.Q)
+		want.Mod(&want, &p.Q)
+		if !got[i].EqualTo(&want) {
+			t.Errorf("Error in Scale: index %v, expected %v, got %v", i, want.Value.String(), got[i].Value.String())
+		}
+	}
+}
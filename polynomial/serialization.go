@@ -0,0 +1,56 @@
+package polynomial
+
+import (
+	"errors"
+)
+
+// coeffWidth returns the number of bytes of each encoded coefficient, i.e. the byte length of q
+func (p *Poly) coeffWidth() int {
+	return (p.q.Value.BitLen() + 7) / 8
+}
+
+// BinarySize returns the length of the binary encoding of p
+func (p *Poly) BinarySize() int {
+	return 1 + int(p.n) * p.coeffWidth()
+}
+
+// MarshalBinary encodes p as one byte for its form, followed by its coefficients in big-endian,
+// each of them on the byte length of q. The coefficients have to be in [0, q).
+func (p *Poly) MarshalBinary() ([]byte, error) {
+	p.syncCoeffs()
+	width := p.coeffWidth()
+	data := make([]byte, p.BinarySize())
+	if p.isNTT {
+		data[0] = 1
+	}
+	for i := range p.coeffs {
+		c := &p.coeffs[i].Value
+		if c.Sign() < 0 || c.Cmp(&p.q.Value) != -1 {
+			return nil, errors.New("coefficients should be in [0, q)")
+		}
+		c.FillBytes(data[1 + i * width : 1 + (i + 1) * width])
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes data produced by MarshalBinary into p,
+// p has to be created with the same degree and modulus as the encoded polynomial.
+func (p *Poly) UnmarshalBinary(data []byte) error {
+	if len(data) != p.BinarySize() {
+		return errors.New("invalid length of encoded polynomial")
+	}
+	if data[0] > 1 {
+		return errors.New("invalid form of encoded polynomial")
+	}
+	p.invalidateNative()
+	width := p.coeffWidth()
+	for i := range p.coeffs {
+		c := &p.coeffs[i].Value
+		c.SetBytes(data[1 + i * width : 1 + (i + 1) * width])
+		if c.Cmp(&p.q.Value) != -1 {
+			return errors.New("coefficients should be in [0, q)")
+		}
+	}
+	p.isNTT = data[0] == 1
+	return nil
+}
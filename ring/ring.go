@@ -1,8 +1,10 @@
 package ring
 
 import (
+	"errors"
 	"github.com/dedis/lago/bigint"
 	"github.com/dedis/lago/polynomial"
+	"io"
 )
 
 type Ring struct {
@@ -18,7 +20,10 @@ func NewRing(n uint32, q bigint.Int, nttParams *polynomial.NttParams) (*Ring, er
 	r.N = n
 	r.Q = q
 	r.Poly, err = polynomial.NewPolynomial(n, q, nttParams)
-	return r, err
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 // CopyRing copies a polynomial ring.
@@ -28,58 +33,181 @@ func CopyRing(r1 *Ring) (*Ring, error) {
 	r.N = r1.N
 	r.Q = r1.Q
 	r.Poly, err = polynomial.NewPolynomial(r1.N, r1.Q, r1.Poly.GetNTTParams())
-	return r, err
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
 // NewGaussPoly creates a new polynomial ring,
-// the parameters of which obey discrete gaussian distribution with derivation sigma
-func NewGaussPoly(n uint32, q bigint.Int, nttParams *polynomial.NttParams, sigma float64) (*Ring, error) {
+// the parameters of which obey the discrete gaussian distribution of sampler, sampled with prng
+func NewGaussPoly(prng PRNG, n uint32, q bigint.Int, nttParams *polynomial.NttParams, sampler GaussSampler) (*Ring, error) {
 	r := new(Ring)
 	err := *new(error)
 	r.N = n
 	r.Q = q
 	r.Poly, err = polynomial.NewPolynomial(n, q, nttParams)
+	if err != nil {
+		return nil, err
+	}
 	coeffs := make([]bigint.Int, n)
-	var coeff bigint.Int
-
-	boundMultiplier := float64(6)  // this parameter is the same as the SEAL library
-	positiveBound := bigint.NewInt(int64(boundMultiplier * sigma))  // the suggested sigma from SEAL is 3.19
-	negativeBound := bigint.NewInt(-int64(boundMultiplier * sigma))
 	for i := range coeffs {
-		for {
-			coeff.SetInt(int64(GaussSampling(sigma)))
-			coeff.Mod(&coeff, &q)
-			if coeff.Compare(positiveBound) == 1 {
-				if coeff.Compare(negativeBound) == -1 {
-					continue
-				}
-			}
-			coeffs[i].SetBigInt(&coeff)
-			break
+		x, err := sampler.Sample(prng)
+		if err != nil {
+			return nil, err
 		}
+		coeffs[i].SetInt(x)
+		coeffs[i].Mod(&coeffs[i], &q)
 	}
 
 	r.Poly.SetCoefficients(coeffs)
-	return r, err
+	return r, nil
 }
 
 // NewUniformPoly creates a new polynomial ring,
-// the parameters of which obey uniform distribution [0, v)
-func NewUniformPoly(n uint32, q bigint.Int, nttParams *polynomial.NttParams, v bigint.Int) (*Ring, error) {
-	r := new(Ring)
-	err := *new(error)
-	r.N = n
-	r.Q = q
-	r.Poly, err = polynomial.NewPolynomial(n, q, nttParams)
+// the parameters of which obey uniform distribution [0, v), sampled with prng by rejection sampling
+// on random bytes of the bit length of v, so that v can be any positive integer, e.g. the modulus q
+func NewUniformPoly(prng PRNG, n uint32, q bigint.Int, nttParams *polynomial.NttParams, v bigint.Int) (*Ring, error) {
+	if v.Value.Sign() <= 0 {
+		return nil, errors.New("bound of the uniform distribution should be positive")
+	}
+	r, err := NewRing(n, q, nttParams)
+	if err != nil {
+		return nil, err
+	}
 	coeffs := make([]bigint.Int, n)
 	for i := range coeffs {
-		coeffs[i].SetInt(int64(randUniform(v.Uint32())))
+		if err = uniformMod(prng, &v, &coeffs[i]); err != nil {
+			return nil, err
+		}
 	}
 
 	r.Poly.SetCoefficients(coeffs)
+	return r, nil
+}
+
+// NewUniformPolyFromSeed creates a new polynomial ring, the parameters of which obey uniform distribution [0, q),
+// expanded from seed by SHAKE-128, so that the same seed always gives the same ring.
+// The seed should be SeedSize random bytes.
+func NewUniformPolyFromSeed(n uint32, q bigint.Int, nttParams *polynomial.NttParams, seed []byte) (*Ring, error) {
+	return NewUniformPoly(NewXOF(seed), n, q, nttParams, q)
+}
+
+// NewTernaryPoly creates a new polynomial ring, the parameters of which obey uniform distribution in {-1, 0, 1}
+// if h is 0, otherwise h parameters at uniform positions obey uniform distribution in {-1, 1} and the others are 0,
+// sampled with prng
+func NewTernaryPoly(prng PRNG, n uint32, q bigint.Int, nttParams *polynomial.NttParams, h uint32) (*Ring, error) {
+	if h > n {
+		return nil, errors.New("hamming weight should be at most the degree")
+	}
+	r, err := NewRing(n, q, nttParams)
+	if err != nil {
+		return nil, err
+	}
+	src := newBitSource(prng)
+	values := make([]int64, n)
+	if h == 0 {
+		for i := range values {
+			x, err := src.randUniform(3)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = int64(x) - 1
+		}
+	} else {
+		// the first h positions of a random permutation of [0, n), each one set to -1 or 1
+		positions := make([]uint32, n)
+		for i := range positions {
+			positions[i] = uint32(i)
+		}
+		for i := uint32(0); i < h; i++ {
+			j, err := src.randUniform(n - i)
+			if err != nil {
+				return nil, err
+			}
+			j += i
+			positions[i], positions[j] = positions[j], positions[i]
+			sign, err := src.randInt(1)
+			if err != nil {
+				return nil, err
+			}
+			values[positions[i]] = 2 * int64(sign) - 1
+		}
+	}
+	coeffs := make([]bigint.Int, n)
+	for i := range coeffs {
+		coeffs[i].SetInt(values[i])
+		coeffs[i].Mod(&coeffs[i], &q)
+	}
+	r.Poly.SetCoefficients(coeffs)
+	return r, nil
+}
+
+// NewCBDPoly creates a new polynomial ring, the parameters of which obey the centered binomial distribution
+// of parameter eta, i.e. a - b for a and b the sums of eta random bits, in [-eta, eta] with variance eta / 2.
+// The parameter i is computed from the bits 2 * i * eta to 2 * (i + 1) * eta of the output of prng,
+// bytes being read from their least significant bit as in Kyber.
+func NewCBDPoly(prng PRNG, n uint32, q bigint.Int, nttParams *polynomial.NttParams, eta uint32) (*Ring, error) {
+	if eta == 0 || eta > maxCBDEta {
+		return nil, errors.New("CBD parameter eta out of range")
+	}
+	r, err := NewRing(n, q, nttParams)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, (2 * int(eta) * int(n) + 7) / 8)
+	if _, err = io.ReadFull(prng, buf); err != nil {
+		return nil, err
+	}
+	bit := func(j int) int64 {
+		return int64(buf[j / 8] >> uint(j % 8) & 1)
+	}
+	coeffs := make([]bigint.Int, n)
+	for i := range coeffs {
+		var a, b int64
+		for j := 0; j < int(eta); j++ {
+			a += bit(2 * i * int(eta) + j)
+			b += bit(2 * i * int(eta) + int(eta) + j)
+		}
+		coeffs[i].SetInt(a - b)
+		coeffs[i].Mod(&coeffs[i], &q)
+	}
+	r.Poly.SetCoefficients(coeffs)
+	return r, nil
+}
+
+// IsNTT reports whether the polynomial of r is in NTT form
+func (r *Ring) IsNTT() bool {
+	return r.Poly.IsNTT()
+}
+
+// Copy sets r to a copy of r1, including the form of its polynomial
+func (r *Ring) Copy(r1 *Ring) (*Ring, error) {
+	_, err := r.Poly.Copy(r1.Poly)
+	return r, err
+}
+
+// Automorphism sets r to r1(X^k) for odd k, in the form of r1
+func (r *Ring) Automorphism(r1 *Ring, k uint32) (*Ring, error) {
+	_, err := r.Poly.Automorphism(r1.Poly, k)
 	return r, err
 }
 
+// BinarySize returns the length of the binary encoding of r
+func (r *Ring) BinarySize() int {
+	return r.Poly.BinarySize()
+}
+
+// MarshalBinary encodes the polynomial of r with fixed-width coefficients
+func (r *Ring) MarshalBinary() ([]byte, error) {
+	return r.Poly.MarshalBinary()
+}
+
+// UnmarshalBinary decodes data into the polynomial of r, which has the same degree and modulus as the encoded one
+func (r *Ring) UnmarshalBinary(data []byte) error {
+	return r.Poly.UnmarshalBinary(data)
+}
+
 func (r *Ring) GetCoefficients() []bigint.Int{
 	return r.Poly.GetCoefficients()
 }
@@ -0,0 +1,155 @@
+package ring
+
+import (
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/polynomial"
+	"testing"
+)
+
+// centeredCoefficients returns the coefficients of r centered in (-q/2, q/2]
+func centeredCoefficients(r *Ring) []int64 {
+	var qDiv2, v bigint.Int
+	qDiv2.Div(&r.Q, bigint.NewInt(2))
+	values := make([]int64, r.N)
+	for i, c := range r.GetCoefficients() {
+		v.SetBigInt(&c)
+		if v.Compare(&qDiv2) == 1 {
+			v.Sub(&v, &r.Q)
+		}
+		values[i] = v.Int64()
+	}
+	return values
+}
+
+// TestTernaryPoly checks the values of the uniform and fixed weight ternary rings
+func TestTernaryPoly(t *testing.T) {
+	n := uint32(256)
+	q := *bigint.NewInt(7681)
+	nttParams, _ := polynomial.GenerateNTTParams(n, q)
+	prng := NewXOF([]byte("ternary"))
+
+	r, err := NewTernaryPoly(prng, n, q, nttParams, 0)
+	if err != nil {
+		t.Fatalf("Error in NewTernaryPoly: %v", err)
+	}
+	counts := make(map[int64]int)
+	for _, v := range centeredCoefficients(r) {
+		counts[v]++
+	}
+	for v := int64(-1); v <= 1; v++ {
+		if counts[v] < int(n) / 4 {
+			t.Errorf("Error in NewTernaryPoly: %v coefficients equal to %v", counts[v], v)
+		}
+	}
+	if len(counts) != 3 {
+		t.Errorf("Error in NewTernaryPoly: coefficients out of {-1, 0, 1}: %v", counts)
+	}
+
+	for _, h := range []uint32{1, 64, n} {
+		r, err = NewTernaryPoly(prng, n, q, nttParams, h)
+		if err != nil {
+			t.Fatalf("Error in NewTernaryPoly(%v): %v", h, err)
+		}
+		weight := uint32(0)
+		for _, v := range centeredCoefficients(r) {
+			if v == 1 || v == -1 {
+				weight++
+			} else if v != 0 {
+				t.Fatalf("Error in NewTernaryPoly(%v): coefficient %v out of {-1, 0, 1}", h, v)
+			}
+		}
+		if weight != h {
+			t.Errorf("Error in NewTernaryPoly(%v): hamming weight %v", h, weight)
+		}
+	}
+	if _, err = NewTernaryPoly(prng, n, q, nttParams, n + 1); err == nil {
+		t.Errorf("Error in NewTernaryPoly: hamming weight larger than the degree should be rejected")
+	}
+}
+
+// TestCBDPoly checks the known answers of the centered binomial ring expanded by SHAKE-128,
+// with the bit order of Kyber, and the bounds and variance of its coefficients
+func TestCBDPoly(t *testing.T) {
+	n := uint32(256)
+	q := *bigint.NewInt(7681)
+	nttParams, _ := polynomial.GenerateNTTParams(n, q)
+
+	r, err := NewCBDPoly(NewXOF([]byte("cbd")), n, q, nttParams, 2)
+	if err != nil {
+		t.Fatalf("Error in NewCBDPoly: %v", err)
+	}
+	want := []int64{0, -2, 1, -2, 1, -1, 0, -1, 0, 0, -1, -1, 0, -1, 1, 0}
+	values := centeredCoefficients(r)
+	for i := range want {
+		if values[i] != want[i] {
+			t.Errorf("Error in NewCBDPoly: coefficient %v expected %v, got %v", i, want[i], values[i])
+		}
+	}
+
+	for _, eta := range []uint32{1, 2, 3} {
+		r, _ = NewCBDPoly(NewXOF([]byte("cbd")), n, q, nttParams, eta)
+		variance := 0.0
+		for _, v := range centeredCoefficients(r) {
+			if v < -int64(eta) || v > int64(eta) {
+				t.Fatalf("Error in NewCBDPoly(%v): coefficient %v out of bounds", eta, v)
+			}
+			variance += float64(v * v) / float64(n)
+		}
+		if variance < 0.6 * float64(eta) / 2 || variance > 1.4 * float64(eta) / 2 {
+			t.Errorf("Error in NewCBDPoly(%v): variance %v, expected %v", eta, variance, float64(eta) / 2)
+		}
+	}
+	if _, err = NewCBDPoly(NewXOF(nil), n, q, nttParams, 0); err == nil {
+		t.Errorf("Error in NewCBDPoly: eta 0 should be rejected")
+	}
+}
+
+// TestUniformPoly checks that the uniform rings cover moduli of more than 64 bits,
+// and that the rings expanded from a seed are the uniform rings of its XOF
+func TestUniformPoly(t *testing.T) {
+	n := uint32(256)
+	var q bigint.Int
+	q.Value.SetString("1267650600228229401496703205653", 10)  // 2^100 + 277
+	prng := NewXOF([]byte("uniform"))
+
+	r, err := NewUniformPoly(prng, n, q, nil, q)
+	if err != nil {
+		t.Fatalf("Error in NewUniformPoly: %v", err)
+	}
+	high := 0
+	for _, c := range r.GetCoefficients() {
+		if c.Value.Sign() < 0 || c.Compare(&q) != -1 {
+			t.Fatalf("Error in NewUniformPoly: coefficient %v out of [0, q)", c.Value.String())
+		}
+		if c.Value.BitLen() > 96 {
+			high++
+		}
+	}
+	// about 15/16 of the coefficients have more than 96 bits
+	if high < int(n) * 3 / 4 {
+		t.Errorf("Error in NewUniformPoly: %v coefficients of more than 96 bits out of %v", high, n)
+	}
+
+	// small bounds keep all their values
+	r, _ = NewUniformPoly(prng, n, q, nil, *bigint.NewInt(3))
+	counts := make(map[int64]int)
+	for _, c := range r.GetCoefficients() {
+		counts[c.Int64()]++
+	}
+	if len(counts) != 3 || counts[0] < int(n) / 4 || counts[1] < int(n) / 4 || counts[2] < int(n) / 4 {
+		t.Errorf("Error in NewUniformPoly: counts of the values of [0, 3) %v", counts)
+	}
+	if _, err = NewUniformPoly(prng, n, q, nil, *bigint.NewInt(0)); err == nil {
+		t.Errorf("Error in NewUniformPoly: bound 0 should be rejected")
+	}
+
+	seed := []byte("seed of the uniform ring of test")
+	r, _ = NewUniformPolyFromSeed(n, q, nil, seed)
+	r2, _ := NewUniformPoly(NewXOF(seed), n, q, nil, q)
+	coeffs2 := r2.GetCoefficients()
+	for i, c := range r.GetCoefficients() {
+		if !c.EqualTo(&coeffs2[i]) {
+			t.Fatalf("Error in NewUniformPolyFromSeed: coefficient %v differs from the XOF of the seed", i)
+		}
+	}
+}
@@ -2,88 +2,263 @@ package ring
 
 import (
 	"crypto/rand"
+	"crypto/sha3"
+	"encoding/binary"
+	"errors"
 	"github.com/dedis/lago/bigint"
+	"io"
 	"math"
 )
 
+// SeedSize is the byte length of the seeds expanded into uniform rings, see NewUniformPolyFromSeed
+const SeedSize = 32
+
+// PRNG is the source of the random bytes of the samplers, e.g. crypto/rand.Reader or NewXOF.
+// The samplers return the error of the PRNG if it fails to return random bytes.
+type PRNG interface {
+	io.Reader
+}
+
+// NewXOF returns the PRNG of the output of SHAKE-128 keyed with key, so that the same key always gives
+// the same random bytes, e.g. for known-answer tests. It is not safe for concurrent use.
+func NewXOF(key []byte) PRNG {
+	xof := sha3.NewSHAKE128()
+	xof.Write(key)
+	return xof
+}
+
+// NewPRNG returns an XOF keyed with SeedSize bytes of crypto/rand, which gives its random bytes from
+// a buffered output instead of reading crypto/rand for each of them
+func NewPRNG() (PRNG, error) {
+	key := make([]byte, SeedSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return NewXOF(key), nil
+}
+
+// GaussTail is the bound on the samples of the gaussian samplers in standard deviations,
+// the same as the SEAL library
+const GaussTail = 6
+
+// maxCBDEta is the largest parameter of NewCBDPoly
+const maxCBDEta = 16
+
+// maxCDTSize is the largest number of entries of the table of a CDTSampler
+const maxCDTSize = 1 << 16
+
+// GaussSampler samples the discrete gaussian distribution centered at zero,
+// truncated to [-GaussTail * sigma, GaussTail * sigma]
+type GaussSampler interface {
+	// Sample returns a value of the distribution drawn with the random bytes of prng,
+	// or the error of prng if it fails
+	Sample(prng PRNG) (int64, error)
+	// Sigma returns the standard deviation of the distribution
+	Sigma() float64
+}
+
+// CDTSampler samples the discrete gaussian distribution in constant time, by comparing a random 63-bit integer
+// to all the entries of the cumulative distribution table of the absolute value of the samples,
+// and applying a random sign with a mask
+type CDTSampler struct {
+	sigma float64
+	table []uint64  // table[i] = 2^63 * P(|x| <= i), for |x| <= len(table)
+}
+
+// NewCDTSampler creates the CDTSampler of standard deviation sigma, e.g. 3.19 for the noise of the HE standard.
+// Its table has GaussTail * sigma entries, each sample reading 8 bytes of the PRNG.
+func NewCDTSampler(sigma float64) (*CDTSampler, error) {
+	size := math.Floor(GaussTail * sigma)
+	if !(sigma > 0) || size < 1 || size > maxCDTSize {
+		return nil, errors.New("standard deviation of the CDT sampler out of range")
+	}
+	// P(|x| = 0) = rho(0) / S and P(|x| = k) = 2 * rho(k) / S, with rho(k) = exp(-k^2 / (2 * sigma^2))
+	rho := make([]float64, int(size) + 1)
+	sum := 0.0
+	for k := range rho {
+		rho[k] = math.Exp(-float64(k * k) / (2 * sigma * sigma))
+		if k > 0 {
+			rho[k] *= 2
+		}
+		sum += rho[k]
+	}
+	sampler := &CDTSampler{sigma: sigma, table: make([]uint64, int(size))}
+	cumulative := 0.0
+	for i := range sampler.table {
+		cumulative += rho[i] / sum
+		sampler.table[i] = uint64(math.Round(math.Ldexp(cumulative, 63)))
+	}
+	return sampler, nil
+}
+
+// Sample returns a value of the distribution, its running time and memory accesses being independent of the value
+func (sampler *CDTSampler) Sample(prng PRNG) (int64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(prng, buf[:]); err != nil {
+		return 0, err
+	}
+	w := binary.BigEndian.Uint64(buf[:])
+	r := w & (1 << 63 - 1)
+	sign := int64(w >> 63)
+
+	// |x| is the number of entries at most r, r - table[i] has its top bit set iff r < table[i]
+	var x int64
+	for _, c := range sampler.table {
+		x += int64(1 ^ ((r - c) >> 63))
+	}
+	// x = -x if sign = 1
+	mask := -sign
+	return (x ^ mask) - mask, nil
+}
+
+// Sigma returns the standard deviation of the distribution
+func (sampler *CDTSampler) Sigma() float64 {
+	return sampler.sigma
+}
+
+// RejectionSampler samples the discrete gaussian distribution with GaussSampling,
+// whose running time depends on the samples
+type RejectionSampler struct {
+	sigma float64
+}
+
+// NewRejectionSampler creates the RejectionSampler of standard deviation k * sqrt(1 / (2 * ln(2))),
+// for the integer k closest to sigma / sqrt(1 / (2 * ln(2))), the standard deviations GaussSampling is exact for.
+// k has to be positive, i.e. sigma at least about 0.42.
+func NewRejectionSampler(sigma float64) (*RejectionSampler, error) {
+	if !(math.Round(sigma / sigma2) >= 1) {
+		return nil, errors.New("standard deviation of the rejection sampler out of range")
+	}
+	return &RejectionSampler{sigma: sigma}, nil
+}
+
+// Sample returns a value of the distribution, rejecting the ones out of the tail bound
+func (sampler *RejectionSampler) Sample(prng PRNG) (int64, error) {
+	bound := int64(GaussTail * sampler.Sigma())
+	for {
+		x, err := GaussSampling(prng, sampler.sigma)
+		if err != nil {
+			return 0, err
+		}
+		if int64(x) <= bound && int64(x) >= -bound {
+			return int64(x), nil
+		}
+	}
+}
+
+// Sigma returns the standard deviation of the distribution
+func (sampler *RejectionSampler) Sigma() float64 {
+	return math.Round(sampler.sigma / sigma2) * sigma2
+}
+
 // This code is to sample a value from discrete gaussian distribution.
 // All the algorithms originate from https://eprint.iacr.org/2013/383.pdf
 
-// GaussSampling returns a value sampled from discrete gaussian distribution,
-// originates from Algorithm 11 & 12 in the paper.
-func GaussSampling(sigma float64) int32 {
-	const sigma2 = 0.8493218  // sigma2 = sqrt(1/(2*ln2)) -- page 28
+const sigma2 = 0.8493218  // sigma2 = sqrt(1/(2*ln2)) -- page 28
+
+// GaussSampling returns a value sampled from discrete gaussian distribution with the random bytes of prng,
+// originates from Algorithm 11 & 12 in the paper. The standard deviation is k * sigma2 for the integer k
+// closest to sigma / sigma2.
+func GaussSampling(prng PRNG, sigma float64) (int32, error) {
 	k := uint32(math.Round(sigma / sigma2))  // sigma = k * sigma2 -- page 29
-	var x, y, z uint32
-	var b1, b2 bool
+	src := newBitSource(prng)
 	for {
-		x = binaryGauss()
-		y = randUniform(k)
-		b1 = bernoulliExp(y*(y+2*k*x), 2*sigma*sigma)
+		x, err := src.binaryGauss()
+		if err != nil {
+			return 0, err
+		}
+		y, err := src.randUniform(k)
+		if err != nil {
+			return 0, err
+		}
+		b1, err := src.bernoulliExp(y*(y+2*k*x), 2*float64(k*k)*sigma2*sigma2)
+		if err != nil {
+			return 0, err
+		}
 		if b1 {
-			z = k * x + y
-			b2 = bernoulli(0.5)
+			z := k * x + y
+			b2, err := src.bernoulli(0.5)
+			if err != nil {
+				return 0, err
+			}
 			if z != 0 || b2 {
 				if b2 {
-					return int32(z)
+					return int32(z), nil
 				} else {
-					return -int32(z)
+					return -int32(z), nil
 				}
 			}
 		}
 	}
 }
 
+// bitSource reads the random integers of the samplers from prng, through a buffer reused by all of them
+type bitSource struct {
+	prng PRNG
+	buf [4]byte
+}
+
+// newBitSource creates the bitSource of prng
+func newBitSource(prng PRNG) *bitSource {
+	return &bitSource{prng: prng}
+}
+
 // binaryGauss returns a random uint value drawn from binary gaussian distribution,
 // originates from Algorithm 10 in the paper.
-func binaryGauss() uint32 {
-	if bernoulli(0.5) == false {
-		return 0
+func (src *bitSource) binaryGauss() (uint32, error) {
+	if b, err := src.bernoulli(0.5); err != nil || !b {
+		return 0, err
 	}
 	// i < 16 represents infinite
 	for i := 1; i < 16; i++ {
-		randomBits := randInt(uint32(2*i - 1))
-		if randomBits != 0 || randomBits != 1 {
-			return binaryGauss()
+		randomBits, err := src.randInt(uint32(2*i - 1))
+		if err != nil {
+			return 0, err
+		}
+		if randomBits != 0 && randomBits != 1 {
+			return src.binaryGauss()
 		}
 		if randomBits == 0 {
-			return uint32(i)
+			return uint32(i), nil
 		}
 	}
-	return 0
+	return 0, nil
 }
 
-// bernoulli returns a random bool value drawn from exponential bernoulli distribution
+// bernoulliExp returns a random bool value drawn from exponential bernoulli distribution
 // originates from Algorithm 8 in the paper.
-func bernoulliExp(x uint32, f float64) bool {
+func (src *bitSource) bernoulliExp(x uint32, f float64) (bool, error) {
 	xBinary, xBitlen := bigint.NewInt(int64(x)).Bits()
 	if xBitlen == 0 {
-		return true
+		return true, nil
 	}
 	for i := xBitlen; i > 0; i-- {
 		if xBinary[i-1] == 1 {
-			c := math.Exp(-math.Exp2(float64(i)) / f)
-			if bernoulli(c) == false {
-				return false
+			c := math.Exp(-math.Exp2(float64(i - 1)) / f)
+			if b, err := src.bernoulli(c); err != nil || !b {
+				return false, err
 			}
 		}
 	}
-	return true
+	return true, nil
 }
 
 // bernoulli returns a random bool value drawn from bernoulli distribution
-func bernoulli(p float64) bool {
+func (src *bitSource) bernoulli(p float64) (bool, error) {
 	pInt := uint32(p*(1<<31))
-	randomInt := randInt(32)
-	if randomInt < pInt {
-		return true
+	randomInt, err := src.randInt(31)
+	if err != nil {
+		return false, err
 	}
-	return false
+	return randomInt < pInt, nil
 }
 
-// randUniform returns a uniformly distributed value in [0, v)
-func randUniform(v uint32) uint32 {
-	var length, randomInt uint32
+// randUniform returns a uniformly distributed value in [0, v), v has to be positive
+func (src *bitSource) randUniform(v uint32) (uint32, error) {
+	if v == 0 {
+		return 0, errors.New("uniform distribution of an empty range")
+	}
+	var length uint32
 	maxLen:= 32
 	for i := maxLen-1; i >= 0; i-- {
 		if v & (1 << uint(i)) != 0 {
@@ -92,33 +267,45 @@ func randUniform(v uint32) uint32 {
 		}
 	}
 	for {
-		randomInt = randInt(length)
+		randomInt, err := src.randInt(length)
+		if err != nil {
+			return 0, err
+		}
 		if randomInt < v {
-			return randomInt
+			return randomInt, nil
 		}
 	}
 }
 
-// randInt generates a random uint32 value of given length
-func randInt(length uint32) uint32 {
+// randInt generates a random uint32 value of given length from 4 bytes of prng
+func (src *bitSource) randInt(length uint32) (uint32, error) {
 	// generate mask for given bit length
 	mask := 1<<length - 1
 
-	// generate random 4 bytes
-	randomBytes := make([]byte, 4)
-	_, err := rand.Read(randomBytes)
-	if err != nil {
-		panic("crypto rand error")
-	}
-
-	// convert 4 bytes to a uint32
-	var randomUint32 uint32
-	l := len(randomBytes)
-	for i, b := range randomBytes {
-		shift := uint32((l - i - 1) * 8)
-		randomUint32 |= uint32(b) << shift
+	// read 4 random bytes into the buffer and convert them to a uint32
+	if _, err := io.ReadFull(src.prng, src.buf[:]); err != nil {
+		return 0, err
 	}
+	randomUint32 := binary.BigEndian.Uint32(src.buf[:])
 
 	// return required bits
-	return uint32(mask) & randomUint32
+	return uint32(mask) & randomUint32, nil
+}
+
+// uniformMod sets x to a uniformly distributed value in [0, q), by rejection sampling on
+// the bytes of prng masked to the bit length of q
+func uniformMod(prng PRNG, q *bigint.Int, x *bigint.Int) error {
+	bitLen := q.Value.BitLen()
+	buf := make([]byte, (bitLen + 7) / 8)
+	mask := byte(0xff >> uint(len(buf) * 8 - bitLen))
+	for {
+		if _, err := io.ReadFull(prng, buf); err != nil {
+			return err
+		}
+		buf[0] &= mask
+		x.Value.SetBytes(buf)
+		if x.Compare(q) == -1 {
+			return nil
+		}
+	}
 }
@@ -0,0 +1,245 @@
+package ring
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/polynomial"
+	"math"
+	"testing"
+)
+
+// idealGauss returns the probabilities of the discrete gaussian distribution of standard deviation sigma
+// at the integers of [-bound, bound], normalized over all integers
+func idealGauss(sigma float64, bound int) []float64 {
+	sum := 0.0
+	for k := -20 * int(sigma + 1); k <= 20 * int(sigma + 1); k++ {
+		sum += math.Exp(-float64(k * k) / (2 * sigma * sigma))
+	}
+	probs := make([]float64, 2 * bound + 1)
+	for k := -bound; k <= bound; k++ {
+		probs[k + bound] = math.Exp(-float64(k * k) / (2 * sigma * sigma)) / sum
+	}
+	return probs
+}
+
+// statisticalDistance returns the statistical distance between the distributions of probabilities p and q
+// on the same support, the mass missing from p or q counting as well
+func statisticalDistance(p, q []float64) float64 {
+	d, sumP, sumQ := 0.0, 0.0, 0.0
+	for i := range p {
+		d += math.Abs(p[i] - q[i])
+		sumP += p[i]
+		sumQ += q[i]
+	}
+	d += math.Abs((1 - sumP) - (1 - sumQ))
+	return d / 2
+}
+
+// sampleDistribution returns the empirical distribution of count samples of sampler on [-bound, bound],
+// with their variance
+func sampleDistribution(t *testing.T, sampler GaussSampler, bound int, count int) ([]float64, float64) {
+	prng := NewXOF([]byte("gauss"))
+	probs := make([]float64, 2 * bound + 1)
+	variance := 0.0
+	for i := 0; i < count; i++ {
+		x, err := sampler.Sample(prng)
+		if err != nil {
+			t.Fatalf("Error in Sample: %v", err)
+		}
+		if x < -int64(bound) || x > int64(bound) {
+			t.Fatalf("Error in Sample: %v out of the tail bound %v", x, bound)
+		}
+		probs[x + int64(bound)] += 1 / float64(count)
+		variance += float64(x * x) / float64(count)
+	}
+	return probs, variance
+}
+
+// TestCDTSampler checks that the table of the CDT sampler and its samples are close to the discrete gaussian
+// distribution of standard deviation 3.19
+func TestCDTSampler(t *testing.T) {
+	sigma := 3.19
+	sampler, err := NewCDTSampler(sigma)
+	if err != nil {
+		t.Fatalf("Error in NewCDTSampler: %v", err)
+	}
+	bound := len(sampler.table)
+	ideal := idealGauss(sigma, bound)
+
+	// distribution of the table, P(x) = P(|x|) / 2 for x != 0
+	table := make([]float64, 2 * bound + 1)
+	previous := 0.0
+	for k := 0; k <= bound; k++ {
+		cumulative := 1.0
+		if k < bound {
+			cumulative = math.Ldexp(float64(sampler.table[k]), -63)
+		}
+		p := cumulative - previous
+		previous = cumulative
+		if k == 0 {
+			table[bound] = p
+		} else {
+			table[bound + k] = p / 2
+			table[bound - k] = p / 2
+		}
+	}
+	if d := statisticalDistance(table, ideal); d > math.Exp2(-28) {
+		t.Errorf("Error in NewCDTSampler: statistical distance of the table 2^%.1f", math.Log2(d))
+	}
+
+	samples, variance := sampleDistribution(t, sampler, bound, 1 << 18)
+	if d := statisticalDistance(samples, ideal); d > 0.01 {
+		t.Errorf("Error in CDTSampler.Sample: statistical distance of the samples %v", d)
+	}
+	if math.Abs(variance - sigma * sigma) > 0.05 * sigma * sigma {
+		t.Errorf("Error in CDTSampler.Sample: variance %v, expected %v", variance, sigma * sigma)
+	}
+
+	if _, err = NewCDTSampler(0); err == nil {
+		t.Errorf("Error in NewCDTSampler: zero standard deviation should be rejected")
+	}
+}
+
+// TestRejectionSampler checks that the samples of the rejection sampler are close to the discrete gaussian
+// distribution of its standard deviation, the closest one to 3.19 it is exact for
+func TestRejectionSampler(t *testing.T) {
+	sampler, err := NewRejectionSampler(3.19)
+	if err != nil {
+		t.Fatalf("Error in NewRejectionSampler: %v", err)
+	}
+	sigma := sampler.Sigma()
+	bound := int(GaussTail * sigma)
+	samples, variance := sampleDistribution(t, sampler, bound, 1 << 18)
+	if d := statisticalDistance(samples, idealGauss(sigma, bound)); d > 0.01 {
+		t.Errorf("Error in RejectionSampler.Sample: statistical distance of the samples %v", d)
+	}
+	if math.Abs(variance - sigma * sigma) > 0.05 * sigma * sigma {
+		t.Errorf("Error in RejectionSampler.Sample: variance %v, expected %v", variance, sigma * sigma)
+	}
+
+	// the standard deviations below sigma2 / 2 round to k = 0
+	for _, sigma := range []float64{0, 0.4, -1, math.NaN()} {
+		if _, err = NewRejectionSampler(sigma); err == nil {
+			t.Errorf("Error in NewRejectionSampler(%v): standard deviation should be rejected", sigma)
+		}
+	}
+	if _, err = GaussSampling(NewXOF([]byte("gauss")), 0.4); err == nil {
+		t.Errorf("Error in GaussSampling: standard deviation 0.4 should be rejected")
+	}
+}
+
+// failingPRNG is a PRNG whose reads always fail
+type failingPRNG struct{}
+
+func (failingPRNG) Read(p []byte) (int, error) {
+	return 0, errors.New("random source error")
+}
+
+// TestSamplerErrors checks that the samplers return the error of a failing PRNG
+func TestSamplerErrors(t *testing.T) {
+	cdt, _ := NewCDTSampler(3.19)
+	rejection, _ := NewRejectionSampler(3.19)
+	for _, sampler := range []GaussSampler{cdt, rejection} {
+		if _, err := sampler.Sample(failingPRNG{}); err == nil {
+			t.Errorf("Error in %T.Sample: failing PRNG should return an error", sampler)
+		}
+	}
+	if _, err := GaussSampling(failingPRNG{}, 3.19); err == nil {
+		t.Errorf("Error in GaussSampling: failing PRNG should return an error")
+	}
+	q := *bigint.NewInt(8380417)
+	nttParams, _ := polynomial.GenerateNTTParams(16, q)
+	if _, err := NewGaussPoly(failingPRNG{}, 16, q, nttParams, cdt); err == nil {
+		t.Errorf("Error in NewGaussPoly: failing PRNG should return an error")
+	}
+	if _, err := NewUniformPoly(failingPRNG{}, 16, q, nttParams, q); err == nil {
+		t.Errorf("Error in NewUniformPoly: failing PRNG should return an error")
+	}
+	for _, h := range []uint32{0, 4} {
+		if _, err := NewTernaryPoly(failingPRNG{}, 16, q, nttParams, h); err == nil {
+			t.Errorf("Error in NewTernaryPoly(%v): failing PRNG should return an error", h)
+		}
+	}
+}
+
+// TestGaussSampling pins the behaviour of the building blocks of GaussSampling: the binary gaussian of
+// Algorithm 10 takes the values x with probability proportional to 2^(-x^2), the exponential bernoulli
+// of Algorithm 8 is true with probability exp(-x / f), the bernoulli samples are exact at p = 0 and p = 1,
+// and the standard deviation is rounded to the closest multiple of sigma2
+func TestGaussSampling(t *testing.T) {
+	src := newBitSource(NewXOF([]byte("legacy gauss")))
+	count := 1 << 16
+	bound := 6
+	binary := make([]float64, 2 * bound + 1)
+	for i := 0; i < count; i++ {
+		x, err := src.binaryGauss()
+		if err != nil {
+			t.Fatalf("Error in binaryGauss: %v", err)
+		}
+		if x > uint32(bound) {
+			t.Fatalf("Error in binaryGauss: %v out of range", x)
+		}
+		binary[bound + int(x)] += 1 / float64(count)
+	}
+	// the binary gaussian is the gaussian of standard deviation sigma2 restricted to the nonnegative integers
+	ideal := make([]float64, 2 * bound + 1)
+	sum := 0.0
+	for x := 0; x <= bound; x++ {
+		sum += math.Exp2(-float64(x * x))
+	}
+	for x := 0; x <= bound; x++ {
+		ideal[bound + x] = math.Exp2(-float64(x * x)) / sum
+	}
+	if d := statisticalDistance(binary, ideal); d > 0.01 {
+		t.Errorf("Error in binaryGauss: statistical distance of the samples %v", d)
+	}
+
+	for _, tc := range []struct {
+		x uint32
+		f float64
+	}{{1, 2}, {5, 4}, {12, 8}} {
+		frequency := 0.0
+		for i := 0; i < count; i++ {
+			b, err := src.bernoulliExp(tc.x, tc.f)
+			if err != nil {
+				t.Fatalf("Error in bernoulliExp: %v", err)
+			}
+			if b {
+				frequency += 1 / float64(count)
+			}
+		}
+		if want := math.Exp(-float64(tc.x) / tc.f); math.Abs(frequency - want) > 0.01 {
+			t.Errorf("Error in bernoulliExp(%v, %v): frequency %v, expected %v", tc.x, tc.f, frequency, want)
+		}
+	}
+	for i := 0; i < 1024; i++ {
+		one, _ := src.bernoulli(1)
+		zero, _ := src.bernoulli(0)
+		if !one || zero {
+			t.Fatalf("Error in bernoulli: p = 1 gave %v, p = 0 gave %v", one, zero)
+		}
+	}
+
+	// 2.4 * sigma2 is rounded to 2 * sigma2
+	sampler, _ := NewRejectionSampler(2.4 * sigma2)
+	if sigma := sampler.Sigma(); math.Abs(sigma - 2 * sigma2) > 1e-9 {
+		t.Errorf("Error in RejectionSampler.Sigma: %v, expected %v", sigma, 2 * sigma2)
+	}
+	_, variance := sampleDistribution(t, sampler, int(GaussTail * sampler.Sigma()), 1 << 16)
+	if want := 4 * sigma2 * sigma2; math.Abs(variance - want) > 0.05 * want {
+		t.Errorf("Error in GaussSampling: variance %v, expected %v", variance, want)
+	}
+
+	// known answers of GaussSampling
+	prng := NewXOF([]byte("legacy gauss"))
+	want := []int32{-3, 1, -2, 1, 1, 0, -6, -5, 7, 2, 0, -1, -2, 7, -2, 1}
+	for i := range want {
+		x, err := GaussSampling(prng, 3.19)
+		if err != nil {
+			t.Fatalf("Error in GaussSampling: %v", err)
+		}
+		if x != want[i] {
+			t.Fatalf("Error in GaussSampling sample %v, expected %v, got %v", i, want[i], x)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package ring
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/polynomial"
+)
+
+// Vector is a vector of elements of R_q with the same parameters, e.g. a Module-LWE secret or error
+type Vector []*Ring
+
+// Matrix is a matrix of elements of R_q with the same parameters, stored as its rows
+type Matrix []Vector
+
+// ErrDimensionMismatch is returned by the operations on vectors and matrices of incompatible dimensions
+var ErrDimensionMismatch = errors.New("vector or matrix dimension mismatch")
+
+// maxMatrixSize is the largest number of rows or columns of the matrices expanded from a seed,
+// their indices being encoded in a byte
+const maxMatrixSize = 256
+
+// NewVector creates a zero vector of k rings with given parameters, ErrDimensionMismatch is returned for a negative k
+func NewVector(k int, n uint32, q bigint.Int, nttParams *polynomial.NttParams) (Vector, error) {
+	if k < 0 {
+		return nil, ErrDimensionMismatch
+	}
+	v := make(Vector, k)
+	var err error
+	for i := range v {
+		if v[i], err = NewRing(n, q, nttParams); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// NewMatrix creates a zero matrix of rows x cols rings with given parameters,
+// ErrDimensionMismatch is returned for negative dimensions
+func NewMatrix(rows, cols int, n uint32, q bigint.Int, nttParams *polynomial.NttParams) (Matrix, error) {
+	if rows < 0 || cols < 0 {
+		return nil, ErrDimensionMismatch
+	}
+	m := make(Matrix, rows)
+	var err error
+	for i := range m {
+		if m[i], err = NewVector(cols, n, q, nttParams); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// NewUniformMatrixFromSeed creates a matrix of rows x cols rings in NTT form, the parameters of which obey
+// uniform distribution [0, q), the ring of row i and column j being expanded by SHAKE-128 from seed || j || i
+// like the matrix A of Kyber, so that the same seed always gives the same matrix
+func NewUniformMatrixFromSeed(rows, cols int, n uint32, q bigint.Int, nttParams *polynomial.NttParams, seed []byte) (Matrix, error) {
+	if rows < 0 || cols < 0 || rows > maxMatrixSize || cols > maxMatrixSize {
+		return nil, ErrDimensionMismatch
+	}
+	m := make(Matrix, rows)
+	entrySeed := make([]byte, len(seed) + 2)
+	copy(entrySeed, seed)
+	var err error
+	for i := range m {
+		m[i] = make(Vector, cols)
+		for j := range m[i] {
+			entrySeed[len(seed)] = byte(j)
+			entrySeed[len(seed) + 1] = byte(i)
+			if m[i][j], err = NewUniformPolyFromSeed(n, q, nttParams, entrySeed); err != nil {
+				return nil, err
+			}
+			m[i][j].Poly.NTT()
+		}
+	}
+	return m, nil
+}
+
+// Rows returns the number of rows of m
+func (m Matrix) Rows() int {
+	return len(m)
+}
+
+// Cols returns the number of columns of m
+func (m Matrix) Cols() int {
+	if len(m) == 0 {
+		return 0
+	}
+	return len(m[0])
+}
+
+// Transpose returns the transpose of m, which shares the rings of m
+func (m Matrix) Transpose() Matrix {
+	t := make(Matrix, m.Cols())
+	for j := range t {
+		t[j] = make(Vector, m.Rows())
+		for i := range m {
+			t[j][i] = m[i][j]
+		}
+	}
+	return t
+}
+
+// NTT converts the rings of v in coefficient form to NTT form
+func (v Vector) NTT() {
+	for _, r := range v {
+		if !r.IsNTT() {
+			r.Poly.NTT()
+		}
+	}
+}
+
+// InverseNTT converts the rings of v in NTT form to coefficient form
+func (v Vector) InverseNTT() {
+	for _, r := range v {
+		if r.IsNTT() {
+			r.Poly.InverseNTT()
+		}
+	}
+}
+
+// Add sets v to v1 + v2, in the form of v1 and v2
+func (v Vector) Add(v1, v2 Vector) (Vector, error) {
+	if len(v) != len(v1) || len(v) != len(v2) {
+		return nil, ErrDimensionMismatch
+	}
+	for i := range v {
+		if _, err := v[i].Add(v1[i], v2[i]); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// Sub sets v to v1 - v2, in the form of v1 and v2
+func (v Vector) Sub(v1, v2 Vector) (Vector, error) {
+	if len(v) != len(v1) || len(v) != len(v2) {
+		return nil, ErrDimensionMismatch
+	}
+	for i := range v {
+		if _, err := v[i].Sub(v1[i], v2[i]); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// checkNTT checks that the rings of the operands of a product are in NTT form,
+// where MulCoeffs is the product of R_q
+func checkNTT(v Vector) error {
+	for _, r := range v {
+		if !r.IsNTT() {
+			return errors.New("products of vectors need operands in NTT form")
+		}
+	}
+	return nil
+}
+
+// InnerProduct sets r to the inner product sum v1[i] * v2[i] of vectors in NTT form, r being in NTT form
+func (r *Ring) InnerProduct(v1, v2 Vector) (*Ring, error) {
+	if len(v1) != len(v2) || len(v1) == 0 {
+		return nil, ErrDimensionMismatch
+	}
+	if err := checkNTT(v1); err != nil {
+		return nil, err
+	}
+	if err := checkNTT(v2); err != nil {
+		return nil, err
+	}
+	tmp, err := CopyRing(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.MulCoeffs(v1[0], v2[0]); err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(v1); i++ {
+		if _, err = tmp.MulCoeffs(v1[i], v2[i]); err != nil {
+			return nil, err
+		}
+		if _, err = r.Add(r, tmp); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// MulMatrix sets v to the product m * v1 of a matrix and a vector in NTT form, v being in NTT form.
+// v and v1 should not share rings, and m.Transpose() gives the product m^T * v1.
+func (v Vector) MulMatrix(m Matrix, v1 Vector) (Vector, error) {
+	if len(v) != m.Rows() {
+		return nil, ErrDimensionMismatch
+	}
+	for i := range m {
+		if _, err := v[i].InnerProduct(m[i], v1); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
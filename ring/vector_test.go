@@ -0,0 +1,112 @@
+package ring
+
+import (
+	"errors"
+	"github.com/dedis/lago/bigint"
+	"github.com/dedis/lago/polynomial"
+	"testing"
+)
+
+// TestMatrixVector checks the matrix-vector products in NTT form against the sums of the products of rings,
+// and the transpose and seeded expansion of matrices
+func TestMatrixVector(t *testing.T) {
+	n := uint32(16)
+	q := *bigint.NewInt(7681)
+	nttParams, _ := polynomial.GenerateNTTParams(n, q)
+	rows, cols := 3, 2
+	seed := []byte("seed of the matrix")
+
+	m, err := NewUniformMatrixFromSeed(rows, cols, n, q, nttParams, seed)
+	if err != nil {
+		t.Fatalf("Error in NewUniformMatrixFromSeed: %v", err)
+	}
+	if m.Rows() != rows || m.Cols() != cols {
+		t.Fatalf("Error in NewUniformMatrixFromSeed: matrix of %v x %v rings", m.Rows(), m.Cols())
+	}
+	m2, _ := NewUniformMatrixFromSeed(rows, cols, n, q, nttParams, seed)
+	for i := range m {
+		for j := range m[i] {
+			data, _ := m[i][j].MarshalBinary()
+			data2, _ := m2[i][j].MarshalBinary()
+			if string(data) != string(data2) {
+				t.Errorf("Error in NewUniformMatrixFromSeed: ring (%v, %v) differs for the same seed", i, j)
+			}
+			if !m[i][j].IsNTT() {
+				t.Errorf("Error in NewUniformMatrixFromSeed: ring (%v, %v) in coefficient form", i, j)
+			}
+		}
+	}
+	first, _ := m[0][0].MarshalBinary()
+	if other, _ := m[1][0].MarshalBinary(); string(first) == string(other) {
+		t.Errorf("Error in NewUniformMatrixFromSeed: rings (0, 0) and (1, 0) are equal")
+	}
+
+	v, _ := NewVector(cols, n, q, nttParams)
+	prng := NewXOF([]byte("vector"))
+	for i := range v {
+		v[i], _ = NewUniformPoly(prng, n, q, nttParams, q)
+	}
+	// m * v computed with the products of rings in coefficient form
+	want := make([][]bigint.Int, rows)
+	for i := range m {
+		sum, _ := NewRing(n, q, nttParams)
+		for j := range m[i] {
+			a, _ := CopyRing(m[i][j])
+			a.Copy(m[i][j])
+			a.Poly.InverseNTT()
+			product, _ := NewRing(n, q, nttParams)
+			product.MulPoly(a, v[j])
+			sum.Add(sum, product)
+		}
+		want[i] = sum.GetCoefficients()
+	}
+
+	v.NTT()
+	result, _ := NewVector(rows, n, q, nttParams)
+	if _, err = result.MulMatrix(m, v); err != nil {
+		t.Fatalf("Error in MulMatrix: %v", err)
+	}
+	result.InverseNTT()
+	for i := range result {
+		for k, c := range result[i].GetCoefficients() {
+			if !c.EqualTo(&want[i][k]) {
+				t.Fatalf("Error in MulMatrix: row %v coefficient %v expected %v, got %v", i, k, want[i][k].Int64(), c.Int64())
+			}
+		}
+	}
+
+	// the transpose shares the rings of the matrix
+	transpose := m.Transpose()
+	if transpose.Rows() != cols || transpose.Cols() != rows || transpose[1][2] != m[2][1] {
+		t.Errorf("Error in Transpose: matrix of %v x %v rings", transpose.Rows(), transpose.Cols())
+	}
+	if _, err = result.MulMatrix(transpose, v); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Error in MulMatrix: expected %v, got %v", ErrDimensionMismatch, err)
+	}
+	result.NTT()
+	tv, _ := NewVector(cols, n, q, nttParams)
+	if _, err = tv.MulMatrix(transpose, result); err != nil {
+		t.Errorf("Error in MulMatrix with the transpose: %v", err)
+	}
+
+	// products need operands in NTT form
+	v.InverseNTT()
+	if _, err = result.MulMatrix(m, v); err == nil {
+		t.Errorf("Error in MulMatrix: operands in coefficient form should be rejected")
+	}
+	if _, err = NewUniformMatrixFromSeed(maxMatrixSize + 1, 1, n, q, nttParams, seed); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Error in NewUniformMatrixFromSeed: expected %v, got %v", ErrDimensionMismatch, err)
+	}
+	// negative dimensions are rejected
+	if _, err = NewVector(-1, n, q, nttParams); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Error in NewVector: expected %v, got %v", ErrDimensionMismatch, err)
+	}
+	for _, dims := range [][2]int{{-1, 1}, {1, -1}, {0, -1}} {
+		if _, err = NewMatrix(dims[0], dims[1], n, q, nttParams); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("Error in NewMatrix(%v, %v): expected %v, got %v", dims[0], dims[1], ErrDimensionMismatch, err)
+		}
+		if _, err = NewUniformMatrixFromSeed(dims[0], dims[1], n, q, nttParams, seed); !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("Error in NewUniformMatrixFromSeed(%v, %v): expected %v, got %v", dims[0], dims[1], ErrDimensionMismatch, err)
+		}
+	}
+}